@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	insync "github.com/DragonSecurity/gomgr/internal/sync"
+	"github.com/DragonSecurity/gomgr/internal/util"
+)
+
+// assumeYes approves every delete and remove without asking (--yes).
+var assumeYes bool
+
+// Approval prompts are written to promptOut, keeping stdout for the plan,
+// and answered on promptIn. Tests replace all three.
+var (
+	promptIn  io.Reader = os.Stdin
+	promptOut io.Writer = os.Stderr
+	// stdinIsTerminal reports whether someone can answer a prompt.
+	stdinIsTerminal = func() bool {
+		fi, err := os.Stdin.Stat()
+		return err == nil && fi.Mode()&os.ModeCharDevice != 0
+	}
+)
+
+// cleanupApprover returns the ApplyOptions.Approve gate for applying plan to
+// org: nil when there is nothing to ask about or --yes was given, a prompt
+// when stdin is a terminal, and an error otherwise, so a non-interactive run
+// fails before it changes anything rather than at the cleanup phase.
+func cleanupApprover(org string, plan util.Plan) (func(context.Context, []util.Change) ([]bool, error), error) {
+	n := insync.CountDestructive(plan.Changes)
+	if n == 0 || assumeYes {
+		return nil, nil
+	}
+	if !stdinIsTerminal() {
+		return nil, fmt.Errorf("plan has %d delete/remove change(s) and stdin is not a terminal; review the plan and re-run with --yes to apply them", n)
+	}
+	return func(ctx context.Context, changes []util.Change) ([]bool, error) {
+		return promptApproval(ctx, org, changes)
+	}, nil
+}
+
+// promptApproval lists changes and asks for the org name to approve all of
+// them, or "each" to decide one change at a time. Any other answer declines
+// them all.
+func promptApproval(ctx context.Context, org string, changes []util.Change) ([]bool, error) {
+	rd := bufio.NewReader(promptIn)
+	verdicts := make([]bool, len(changes))
+
+	_, _ = fmt.Fprintf(promptOut, "\n%d delete/remove change(s) are ready to apply:\n", len(changes))
+	for i, ch := range changes {
+		_, _ = fmt.Fprintf(promptOut, "  %d. %s:%s %s\n", i+1, ch.Scope, ch.Action, ch.Target)
+	}
+	_, _ = fmt.Fprintf(promptOut, "Type the org name (%s) to apply all of them, \"each\" to decide one by one, or anything else to skip them: ", org)
+	answer, err := readAnswer(ctx, rd)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case strings.EqualFold(answer, org):
+		for i := range verdicts {
+			verdicts[i] = true
+		}
+	case strings.EqualFold(answer, "each"):
+		for i, ch := range changes {
+			_, _ = fmt.Fprintf(promptOut, "  %s:%s %s — apply? [y/N]: ", ch.Scope, ch.Action, ch.Target)
+			a, err := readAnswer(ctx, rd)
+			if err != nil {
+				return nil, err
+			}
+			verdicts[i] = strings.EqualFold(a, "y") || strings.EqualFold(a, "yes")
+		}
+	}
+	return verdicts, nil
+}
+
+// readAnswer reads one line from rd, giving up when ctx ends (the --timeout).
+func readAnswer(ctx context.Context, rd *bufio.Reader) (string, error) {
+	type line struct {
+		s   string
+		err error
+	}
+	ch := make(chan line, 1)
+	go func() {
+		s, err := rd.ReadString('\n')
+		ch <- line{s, err}
+	}()
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case l := <-ch:
+		if l.err != nil && (!errors.Is(l.err, io.EOF) || l.s == "") {
+			return "", fmt.Errorf("read answer: %w", l.err)
+		}
+		return strings.TrimSpace(l.s), nil
+	}
+}
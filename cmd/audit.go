@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/DragonSecurity/gomgr/internal/audit"
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Inspect gomgr audit trails",
+}
+
+var auditVerifyCmd = &cobra.Command{
+	Use:     "verify <file.jsonl>",
+	Short:   "Verify the hash chain of a JSONL audit trail",
+	Example: `  gomgr audit verify ./audit/gomgr.jsonl`,
+	Args:    cobra.ExactArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return fmt.Errorf("open audit trail: %w", err)
+		}
+		defer func() { _ = f.Close() }()
+		n, err := audit.Verify(f)
+		if err != nil {
+			return fmt.Errorf("audit trail %s is NOT intact after %d valid record(s): %w", args[0], n, err)
+		}
+		fmt.Printf("Audit trail intact: %d record(s) verified.\n", n)
+		return nil
+	},
+}
+
+func init() {
+	auditCmd.AddCommand(auditVerifyCmd)
+	rootCmd.AddCommand(auditCmd)
+}
@@ -2,15 +2,21 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
+
+	"github.com/DragonSecurity/gomgr/internal/audit"
+	insync "github.com/DragonSecurity/gomgr/internal/sync"
+	"github.com/DragonSecurity/gomgr/internal/util"
 )
 
 // runCmd invokes rootCmd with the given args, capturing anything written to
@@ -26,8 +32,28 @@ func runCmd(t *testing.T, args ...string) (stdout, stderr string, err error) {
 	debug = false
 	dryRun = false
 	timeout = 10 * time.Minute
+	concurrency = insync.DefaultConcurrency
 	auditLog = false
+	logFormat = "text"
+	logLevel = "info"
+	logFile = ""
+	metricsFile = ""
+	metricsPushURL = ""
+	metricsJob = "gomgr"
+	traceExporter = ""
+	traceFile = ""
+	listenAddr = ""
+	reconcileInterval = 15 * time.Minute
+	reconcileJitter = 0.1
+	statusAddr = "127.0.0.1:8080"
 	teamName = ""
+	resume = false
+	journalPath = ""
+	syncTeams = nil
+	syncRepos = nil
+	syncScopes = nil
+	allowDestructive = -1
+	assumeYes = false
 	outFile = ""
 	resetFlagsChanged(rootCmd)
 
@@ -227,9 +253,155 @@ func TestSync_MissingConfigFlag(t *testing.T) {
 	}
 }
 
+func TestReconcile_RejectsBadJitter(t *testing.T) {
+	dir := writeConfigDir(t, t.TempDir())
+	_, _, err := runCmd(t, "reconcile", "-c", dir, "--jitter", "1.5")
+	if err == nil || !strings.Contains(err.Error(), "jitter") {
+		t.Errorf("expected a jitter error, got %v", err)
+	}
+}
+
+func TestServe_RequiresWebhookSecret(t *testing.T) {
+	t.Setenv("GOMGR_WEBHOOK_SECRET", "")
+	dir := writeConfigDir(t, t.TempDir())
+	_, _, err := runCmd(t, "serve", "-c", dir)
+	if err == nil || !strings.Contains(err.Error(), "webhook secret") {
+		t.Errorf("expected a webhook secret error, got %v", err)
+	}
+}
+
+func TestDoctor_MissingConfigFlag(t *testing.T) {
+	_, _, err := runCmd(t, "doctor")
+	if err == nil || !strings.Contains(err.Error(), "--config") {
+		t.Errorf("expected a --config error, got %v", err)
+	}
+}
+
 func TestRoot_UnknownCommand(t *testing.T) {
 	_, _, err := runCmd(t, "does-not-exist")
 	if err == nil {
 		t.Fatal("expected error for unknown command")
 	}
 }
+
+func TestAuditVerify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := audit.NewFileSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := audit.New(audit.Run{Org: "testorg"}, sink)
+	l.Change(context.Background(), util.Change{Scope: "team", Target: "backend", Action: "create"}, nil)
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, _, err := runCmd(t, "audit", "verify", path)
+	if err != nil {
+		t.Fatalf("audit verify failed: %v", err)
+	}
+	if !strings.Contains(stdout, "1 record(s) verified") {
+		t.Errorf("unexpected output %q", stdout)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"seq":1,"prev_hash":"","hash":"bogus"}`+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := runCmd(t, "audit", "verify", path); err == nil || !strings.Contains(err.Error(), "NOT intact") {
+		t.Errorf("expected tampered trail to fail verification, got %v", err)
+	}
+}
+
+func TestSync_RejectsBadScope(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "test-token")
+	dir := writeConfigDir(t, t.TempDir())
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--scope", "teams,everything"}, `unknown scope "everything"`},
+		{[]string{"--team", "platform", "--resume"}, "cannot be combined"},
+	}
+	for _, tt := range tests {
+		_, _, err := runCmd(t, append([]string{"sync", "-c", dir}, tt.args...)...)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("sync %v: expected error containing %q, got %v", tt.args, tt.want, err)
+		}
+	}
+}
+
+func TestSync_ResumeRequiresJournal(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "test-token")
+	dir := writeConfigDir(t, t.TempDir())
+	missing := filepath.Join(t.TempDir(), "none.jsonl")
+	_, _, err := runCmd(t, "sync", "-c", dir, "--resume", "--journal", missing)
+	if err == nil || !strings.Contains(err.Error(), "journal") {
+		t.Errorf("expected a missing journal error, got %v", err)
+	}
+}
+
+func TestCleanupApprover(t *testing.T) {
+	t.Cleanup(func() { assumeYes = false })
+	orig := stdinIsTerminal
+	t.Cleanup(func() { stdinIsTerminal = orig })
+
+	plan := util.Plan{Changes: []util.Change{
+		{Scope: "team", Action: "create", Target: "web"},
+		{Scope: "repo", Action: "delete", Target: "legacy"},
+	}}
+
+	stdinIsTerminal = func() bool { return false }
+	if _, err := cleanupApprover("acme", plan); err == nil || !strings.Contains(err.Error(), "--yes") {
+		t.Fatalf("expected a non-interactive run to require --yes, got %v", err)
+	}
+	if approve, err := cleanupApprover("acme", util.Plan{Changes: plan.Changes[:1]}); err != nil || approve != nil {
+		t.Fatalf("expected no gate for a plan without deletes, got %v", err)
+	}
+	assumeYes = true
+	if approve, err := cleanupApprover("acme", plan); err != nil || approve != nil {
+		t.Fatalf("expected --yes to skip the gate, got %v", err)
+	}
+	assumeYes = false
+	stdinIsTerminal = func() bool { return true }
+	if approve, err := cleanupApprover("acme", plan); err != nil || approve == nil {
+		t.Fatalf("expected a prompt on a terminal, got %v", err)
+	}
+}
+
+func TestPromptApproval(t *testing.T) {
+	origIn, origOut := promptIn, promptOut
+	t.Cleanup(func() { promptIn, promptOut = origIn, origOut })
+
+	changes := []util.Change{
+		{Scope: "repo", Action: "delete", Target: "legacy"},
+		{Scope: "org-member", Action: "remove", Target: "mallory"},
+	}
+	tests := []struct {
+		input string
+		want  []bool
+	}{
+		{"ACME\n", []bool{true, true}},
+		{"each\ny\nn\n", []bool{true, false}},
+		{"each\n\nyes", []bool{false, true}},
+		{"no\n", []bool{false, false}},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		promptIn, promptOut = strings.NewReader(tt.input), &out
+		got, err := promptApproval(context.Background(), "acme", changes)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.input, err)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%q: verdicts %v, want %v", tt.input, got, tt.want)
+		}
+		if !strings.Contains(out.String(), "repo:delete legacy") {
+			t.Errorf("%q: expected the prompt to list the changes, got %q", tt.input, out.String())
+		}
+	}
+
+	promptIn = strings.NewReader("")
+	if _, err := promptApproval(context.Background(), "acme", changes); err == nil {
+		t.Error("expected an error when stdin closes before an answer")
+	}
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/DragonSecurity/gomgr/internal/config"
+	"github.com/DragonSecurity/gomgr/internal/doctor"
+	"github.com/DragonSecurity/gomgr/internal/gh"
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check that the GitHub credentials can do everything the config needs",
+	Long: `Resolve credentials the way sync does, then compare the token scopes or
+GitHub App installation permissions against the features the config enables.
+Prints a pass/fail table with a fix for every failure and exits non-zero if
+any check fails. Nothing is changed.`,
+	Example: `  gomgr doctor -c ./config`,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		if cfgDir == "" {
+			return fmt.Errorf("--config/-c flag is required")
+		}
+		cfg, err := config.Load(cfgDir)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		client, authSource, err := gh.NewClientFromEnv(ctx, cfg.App)
+		if err != nil {
+			_ = doctor.Print(os.Stdout, []doctor.Check{{
+				Name: "authentication", Status: doctor.Fail, Detail: err.Error(),
+				Hint: "set GITHUB_TOKEN, or app_id and private_key (GITHUB_APP_ID / GITHUB_APP_PRIVATE_KEY)",
+			}})
+			return fmt.Errorf("doctor: authentication failed")
+		}
+
+		checks := doctor.Run(ctx, client, cfg, authSource)
+		if err := doctor.Print(os.Stdout, checks); err != nil {
+			return err
+		}
+		if n := doctor.Failed(checks); n > 0 {
+			return fmt.Errorf("doctor: %d check(s) failed", n)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
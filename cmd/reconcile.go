@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/DragonSecurity/gomgr/internal/config"
+	"github.com/DragonSecurity/gomgr/internal/gh"
+	"github.com/DragonSecurity/gomgr/internal/notify"
+	"github.com/DragonSecurity/gomgr/internal/reconcile"
+)
+
+var (
+	reconcileInterval time.Duration
+	reconcileJitter   float64
+	statusAddr        string
+)
+
+var reconcileCmd = &cobra.Command{
+	Use:   "reconcile",
+	Short: "Keep the org in sync by planning and applying on an interval",
+	Long: `Run sync in a loop: plan and apply now, then again every --interval (spread
+by --jitter). Config changes on disk are picked up within a few seconds and
+trigger a run. The last run's status and plan are served on --listen.`,
+	Example: `  gomgr reconcile -c ./config --interval 15m
+  gomgr reconcile -c ./config --interval 1h --jitter 0.2 --listen 127.0.0.1:8081
+  gomgr reconcile -c ./config --dry --listen ""`,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		if cfgDir == "" {
+			return fmt.Errorf("--config/-c flag is required")
+		}
+		r, err := reconcile.New(reconcile.Options{
+			Interval:    reconcileInterval,
+			Jitter:      reconcileJitter,
+			Fingerprint: func() (string, error) { return config.Fingerprint(cfgDir) },
+			Load:        func() (*config.Root, error) { return config.Load(cfgDir) },
+			Reconcile:   reconcileOnce,
+		})
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		if statusAddr == "" {
+			r.Run(ctx)
+			return nil
+		}
+		return serveHTTP(ctx, statusAddr, r.Handler(), r.Run)
+	},
+}
+
+// reconcileOnce is one pass of the loop: a sync of cfg bounded by
+// --timeout. A fresh client per pass picks up auth changes in app.yaml and
+// keeps the exported API metrics per run.
+func reconcileOnce(ctx context.Context, cfg *config.Root) (res reconcile.Result, err error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var client *gh.Client
+	run := newMetricsRun()
+	defer func() { exportMetrics(context.WithoutCancel(ctx), run, client, err) }()
+
+	notifiers, err := notify.New(cfg.App.Notifications)
+	if err != nil {
+		return res, err
+	}
+	client, _, err = gh.NewClientFromEnv(ctx, cfg.App)
+	if err != nil {
+		return res, err
+	}
+	plan, summary, err := syncOnce(ctx, cfg, client, notifiers, run, syncOptions{})
+	return reconcile.Result{Plan: plan, Applied: len(summary.Applied), Failed: len(summary.Failed)}, err
+}
+
+func init() {
+	reconcileCmd.Flags().DurationVar(&reconcileInterval, "interval", 15*time.Minute, "Time between reconcile runs")
+	reconcileCmd.Flags().Float64Var(&reconcileJitter, "jitter", 0.1, "Spread each interval randomly by up to this fraction (0 to disable)")
+	reconcileCmd.Flags().StringVar(&statusAddr, "listen", "127.0.0.1:8080", `Address for the unauthenticated /status and /plan endpoints ("" to disable)`)
+	rootCmd.AddCommand(reconcileCmd)
+}
@@ -1,11 +1,17 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"time"
 
 	"github.com/spf13/cobra"
+
+	insync "github.com/DragonSecurity/gomgr/internal/sync"
+	"github.com/DragonSecurity/gomgr/internal/tracing"
+	"github.com/DragonSecurity/gomgr/internal/util"
 )
 
 var (
@@ -15,16 +21,74 @@ var (
 	timeout         time.Duration
 	auditLog        bool
 	continueOnError bool
+	concurrency     int
+	logFormat       string
+	logLevel        string
+	logFile         string
+	metricsFile     string
+	metricsPushURL  string
+	metricsJob      string
+	traceExporter   string
+	traceFile       string
+
+	// logCloser releases the --log-file handle once the command finishes.
+	logCloser io.Closer
+	// traceShutdown flushes buffered spans once the command finishes.
+	traceShutdown func(context.Context) error
 )
 
 var rootCmd = &cobra.Command{
 	Use:   "gomgr",
 	Short: "GitHub Organization Manager (Go)",
 	Long:  "Sync GitHub org owners, teams, members, and repo permissions from YAML.",
+	PersistentPreRunE: func(_ *cobra.Command, _ []string) error {
+		if err := setupLogging(); err != nil {
+			return err
+		}
+		return setupTracing()
+	},
+}
+
+// setupLogging applies the --log-* flags to the package logger. --debug
+// implies --log-level debug and adds file:line to every record.
+func setupLogging() error {
+	level := logLevel
+	if debug {
+		util.EnableDebug()
+		level = "debug"
+	}
+	closer, err := util.ConfigureLogging(util.LogOptions{Format: logFormat, Level: level, File: logFile})
+	if err != nil {
+		return err
+	}
+	logCloser = closer
+	return nil
+}
+
+// setupTracing installs the exporter selected by --trace-exporter,
+// --trace-file or OTEL_TRACES_EXPORTER.
+func setupTracing() error {
+	shutdown, err := tracing.Setup(context.Background(), tracing.Options{Exporter: traceExporter, File: traceFile})
+	if err != nil {
+		return err
+	}
+	traceShutdown = shutdown
+	return nil
 }
 
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	err := rootCmd.Execute()
+	if traceShutdown != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if serr := traceShutdown(ctx); serr != nil {
+			util.Warnf("tracing: flush spans: %v", serr)
+		}
+		cancel()
+	}
+	if logCloser != nil {
+		_ = logCloser.Close()
+	}
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
@@ -35,6 +99,15 @@ func init() {
 	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "Enable verbose debug logs")
 	rootCmd.PersistentFlags().BoolVar(&dryRun, "dry", false, "Show a plan without applying changes")
 	rootCmd.PersistentFlags().DurationVar(&timeout, "timeout", 10*time.Minute, "Overall context timeout for the sync operation")
-	rootCmd.PersistentFlags().BoolVar(&auditLog, "audit-log", false, "Emit structured JSON audit log entries to stderr")
+	rootCmd.PersistentFlags().BoolVar(&auditLog, "audit-log", false, "Also print hash-chained JSON audit records to stderr (see app.audit for persistent sinks)")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", util.LogFormatText, "Log output format: text or json")
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "Minimum log level: debug, info, warn or error")
+	rootCmd.PersistentFlags().StringVar(&logFile, "log-file", "", "Also append log records to this file (same format as the console)")
+	rootCmd.PersistentFlags().StringVar(&metricsFile, "metrics-file", "", "Write run metrics to this file in Prometheus text format (node_exporter textfile collector)")
+	rootCmd.PersistentFlags().StringVar(&metricsPushURL, "metrics-push-url", "", "Push run metrics to this Prometheus Pushgateway URL")
+	rootCmd.PersistentFlags().StringVar(&metricsJob, "metrics-job", "gomgr", "Job name used when pushing metrics to the Pushgateway")
+	rootCmd.PersistentFlags().StringVar(&traceExporter, "trace-exporter", "", "OpenTelemetry span exporter: none, otlp or file (default from OTEL_TRACES_EXPORTER)")
+	rootCmd.PersistentFlags().StringVar(&traceFile, "trace-file", "", "Append spans as JSON lines to this file (implies --trace-exporter file)")
 	rootCmd.PersistentFlags().BoolVar(&continueOnError, "continue-on-error", false, "Keep applying remaining changes after a failure, then report all errors at the end")
+	rootCmd.PersistentFlags().IntVar(&concurrency, "concurrency", insync.DefaultConcurrency, "Maximum number of independent changes to apply at once")
 }
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/DragonSecurity/gomgr/internal/config"
+	"github.com/DragonSecurity/gomgr/internal/gh"
+	"github.com/DragonSecurity/gomgr/internal/notify"
+	"github.com/DragonSecurity/gomgr/internal/server"
+	insync "github.com/DragonSecurity/gomgr/internal/sync"
+	"github.com/DragonSecurity/gomgr/internal/util"
+)
+
+var listenAddr string
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run a webhook server that re-plans teams and repos as GitHub reports changes",
+	Long: `Run an HTTP server for GitHub organization webhooks. Each verified event
+triggers a plan scoped to the team or repository it touched; app.server.mode
+decides whether the resulting drift is reported (default) or applied.`,
+	Example: `  GOMGR_WEBHOOK_SECRET=... gomgr serve -c ./config
+  gomgr serve -c ./config --listen :9000`,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		if cfgDir == "" {
+			return fmt.Errorf("--config/-c flag is required")
+		}
+		cfg, err := config.Load(cfgDir)
+		if err != nil {
+			return err
+		}
+		secret, err := server.Secret(cfg.App.Server)
+		if err != nil {
+			return err
+		}
+		notifiers, err := notify.New(cfg.App.Notifications)
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		client, appInfo, err := gh.NewClientFromEnv(ctx, cfg.App)
+		if err != nil {
+			return err
+		}
+		if appInfo != "" {
+			util.Infof("auth: %s", appInfo)
+		}
+
+		srv := server.New(server.Options{
+			Org:     cfg.App.Org,
+			Secret:  secret,
+			Mode:    cfg.App.Server.Mode,
+			Path:    cfg.App.Server.Path,
+			Timeout: timeout,
+			Plan: func(ctx context.Context, scope insync.Scope) (util.Plan, error) {
+				return insync.BuildScopedPlan(ctx, client, cfg, scope)
+			},
+			Apply: func(ctx context.Context, plan util.Plan, onChange func(util.Change, error)) error {
+				auditor, err := newAuditLogger(ctx, cfg, client)
+				if err != nil {
+					return err
+				}
+				applyErr := insync.ApplyWithOptions(ctx, client, plan, insync.ApplyOptions{
+					ContinueOnError: true,
+					Concurrency:     concurrency,
+					Limit:           insync.DestructiveLimitFor(cfg.App, -1),
+					Audit:           auditor,
+					OnChange:        onChange,
+				})
+				return errors.Join(applyErr, auditor.Close())
+			},
+			Notifiers: notifiers,
+		})
+
+		addr := listenAddr
+		if addr == "" {
+			addr = cfg.App.Server.Listen
+		}
+		if addr == "" {
+			addr = ":8080"
+		}
+		return serveHTTP(ctx, addr, srv.Handler(), srv.Run)
+	},
+}
+
+// serveHTTP serves handler on addr next to the background worker until ctx
+// is cancelled or the listener fails, then stops accepting requests and
+// waits for the worker to finish its current run.
+func serveHTTP(ctx context.Context, addr string, handler http.Handler, worker func(context.Context)) error {
+	httpSrv := &http.Server{Addr: addr, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+
+	workerCtx, stopWorker := context.WithCancel(ctx)
+	defer stopWorker()
+	workerDone := make(chan struct{})
+	go func() {
+		defer close(workerDone)
+		worker(workerCtx)
+	}()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		util.Infof("listening on %s", addr)
+		serveErr <- httpSrv.ListenAndServe()
+	}()
+
+	var err error
+	select {
+	case err = <-serveErr:
+		// The listener failed (port in use, …); stop the worker too.
+	case <-ctx.Done():
+		util.Infof("shutting down")
+	}
+	stopWorker()
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	defer cancel()
+	if serr := httpSrv.Shutdown(shutdownCtx); serr != nil && err == nil {
+		err = fmt.Errorf("shutdown: %w", serr)
+	}
+	<-workerDone
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&listenAddr, "listen", "", "Address to listen on (default app.server.listen or :8080)")
+	rootCmd.AddCommand(serveCmd)
+}
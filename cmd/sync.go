@@ -2,67 +2,327 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel/attribute"
 
+	"github.com/DragonSecurity/gomgr/internal/audit"
 	"github.com/DragonSecurity/gomgr/internal/config"
 	"github.com/DragonSecurity/gomgr/internal/gh"
+	"github.com/DragonSecurity/gomgr/internal/journal"
+	"github.com/DragonSecurity/gomgr/internal/metrics"
+	"github.com/DragonSecurity/gomgr/internal/notify"
 	insync "github.com/DragonSecurity/gomgr/internal/sync"
+	"github.com/DragonSecurity/gomgr/internal/tracing"
 	"github.com/DragonSecurity/gomgr/internal/util"
 )
 
+var (
+	resume      bool
+	journalPath string
+	syncTeams   []string
+	syncRepos   []string
+	syncScopes  []string
+
+	// allowDestructive overrides the destructive change guardrail when not
+	// negative.
+	allowDestructive = -1
+)
+
 var syncCmd = &cobra.Command{
 	Use:   "sync",
 	Short: "Synchronize org state to match YAML configuration",
 	Example: `  gomgr sync -c ./config
   gomgr sync -c ./config --dry
   gomgr sync -c ./config --timeout 5m --audit-log
-  gomgr sync -c ./config --continue-on-error`,
+  gomgr sync -c ./config --continue-on-error
+  gomgr sync -c ./config --resume
+  gomgr sync -c ./config --yes
+  gomgr sync -c ./config --allow-destructive 25
+  gomgr sync -c ./config --team platform --repo api
+  gomgr sync -c ./config --scope repos,cleanups
+  gomgr sync -c ./config --metrics-file /var/lib/node_exporter/textfile/gomgr.prom`,
 	RunE: func(_ *cobra.Command, _ []string) error {
-		if cfgDir == "" {
-			return fmt.Errorf("--config/-c flag is required")
-		}
+		return runSync()
+	},
+}
+
+func runSync() (err error) {
+	if cfgDir == "" {
+		return fmt.Errorf("--config/-c flag is required")
+	}
+
+	scope, err := insync.ParseScope(syncTeams, syncRepos, syncScopes)
+	if err != nil {
+		return err
+	}
+	if resume && !scope.IsZero() {
+		return fmt.Errorf("--resume continues the journaled plan and cannot be combined with --team, --repo or --scope")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	ctx, span := tracing.Start(ctx, "gomgr sync", attribute.Bool("gomgr.dry_run", dryRun))
+	defer func() { tracing.End(span, err) }()
+
+	var client *gh.Client
+	run := newMetricsRun()
+	defer func() { exportMetrics(context.WithoutCancel(ctx), run, client, err) }()
 
-		ctx, cancel := context.WithTimeout(context.Background(), timeout)
-		defer cancel()
+	cfg, err := config.Load(cfgDir)
+	if err != nil {
+		return err
+	}
 
-		if debug {
-			util.EnableDebug()
+	notifiers, err := notify.New(cfg.App.Notifications)
+	if err != nil {
+		return err
+	}
+
+	client, appInfo, err := gh.NewClientFromEnv(ctx, cfg.App)
+	if err != nil {
+		return err
+	}
+	if appInfo != "" {
+		util.Infof("auth: %s", appInfo)
+	}
+
+	_, _, err = syncOnce(ctx, cfg, client, notifiers, run, syncOptions{
+		printPlan: true,
+		journal:   journalFile(cfg.App.Org),
+		resume:    resume,
+		scope:     scope,
+		approve:   true,
+	})
+	return err
+}
+
+// syncOptions tunes one syncOnce call.
+type syncOptions struct {
+	// printPlan writes the JSON plan, and the human summary on dry runs, to
+	// stdout.
+	printPlan bool
+	// journal is the apply journal path; "" disables journaling.
+	journal string
+	// resume continues the plan recorded in journal instead of planning.
+	resume bool
+	// scope limits planning to part of the org; the zero Scope plans
+	// everything.
+	scope insync.Scope
+	// approve asks before the cleanup phase, unless --yes is set.
+	approve bool
+}
+
+// syncOnce plans cfg and, unless --dry is set, applies the plan. Applied
+// changes go to the audit trail and run, and the summary it returns is sent
+// to notifiers (planning failures too, outside dry runs).
+func syncOnce(ctx context.Context, cfg *config.Root, client *gh.Client, notifiers []*notify.Notifier, run *metrics.Run, opts syncOptions) (util.Plan, *notify.Summary, error) {
+	start := time.Now()
+	summary := &notify.Summary{Org: cfg.App.Org}
+	var plan util.Plan
+	var jrnl *journal.Journal
+	var err error
+	if opts.resume {
+		jrnl, plan, err = openJournal(cfg, opts.journal)
+	} else {
+		if !opts.scope.IsZero() {
+			util.Infof("sync: planning %s only", opts.scope)
+		}
+		plan, err = insync.BuildScopedPlan(ctx, client, cfg, opts.scope)
+	}
+	if err != nil {
+		if !dryRun {
+			summary.Duration = time.Since(start)
+			summary.Error = err.Error()
+			notify.SendAll(context.WithoutCancel(ctx), notifiers, summary)
 		}
-		util.AuditLog = auditLog
+		return plan, summary, err
+	}
+	run.ObservePlan(plan)
 
-		cfg, err := config.Load(cfgDir)
-		if err != nil {
-			return err
+	if opts.printPlan {
+		if err := util.PrintPlan(plan); err != nil {
+			return plan, summary, fmt.Errorf("print plan: %w", err)
 		}
+	}
 
-		client, appInfo, err := gh.NewClientFromEnv(ctx, cfg.App)
-		if err != nil {
-			return err
+	limit := insync.DestructiveLimitFor(cfg.App, allowDestructive)
+	if dryRun {
+		if opts.printPlan {
+			util.PrintSummary(plan)
 		}
-		if appInfo != "" {
-			util.Infof("auth: %s", appInfo)
+		if err := limit.Check(plan); err != nil {
+			util.Warnf("%v", err)
 		}
+		util.Infof("dry-run: no changes applied")
+		return plan, summary, nil
+	}
 
-		plan, err := insync.BuildPlan(ctx, client, cfg)
-		if err != nil {
-			return err
+	var approve func(context.Context, []util.Change) ([]bool, error)
+	if opts.approve {
+		if approve, err = cleanupApprover(cfg.App.Org, plan); err != nil {
+			return plan, summary, errors.Join(err, jrnl.Close(err))
 		}
+	}
 
-		if err := util.PrintPlan(plan); err != nil {
-			return fmt.Errorf("print plan: %w", err)
+	if jrnl == nil && opts.journal != "" {
+		jrnl, err = journal.Create(opts.journal, journal.Header{Org: cfg.App.Org, ConfigSHA: configFingerprint()}, plan)
+		if err != nil {
+			return plan, summary, err
 		}
+	}
+	auditor, err := newAuditLogger(ctx, cfg, client)
+	if err != nil {
+		return plan, summary, errors.Join(err, jrnl.Close(err))
+	}
+	applyErr := insync.ApplyWithOptions(ctx, client, plan, insync.ApplyOptions{
+		ContinueOnError: continueOnError,
+		Concurrency:     concurrency,
+		Limit:           limit,
+		Approve:         approve,
+		Audit:           auditor,
+		Journal:         jrnl,
+		OnChange: func(ch util.Change, err error) {
+			if errors.Is(err, insync.ErrDeclined) {
+				summary.RecordDeclined(ch)
+				return
+			}
+			summary.Record(ch, err)
+			run.RecordApply(ch, err)
+		},
+	})
+	if len(summary.Declined) > 0 {
+		util.Warnf("%d delete/remove change(s) declined and not applied", len(summary.Declined))
+	}
 
-		if dryRun {
-			util.PrintSummary(plan)
-			util.Infof("dry-run: no changes applied")
-			return nil
+	summary.RunID = auditor.RunID()
+	summary.Duration = time.Since(start)
+	summary.Warnings = plan.Warnings
+	// Per-change failures are already listed; only report errors that
+	// are not tied to a change (timeouts, aborted custom-role sync).
+	if applyErr != nil && len(summary.Failed) == 0 {
+		summary.Error = applyErr.Error()
+	}
+	notify.SendAll(context.WithoutCancel(ctx), notifiers, summary)
+
+	return plan, summary, errors.Join(applyErr, auditor.Close(), jrnl.Close(applyErr))
+}
+
+// journalFile returns the apply journal path for org: --journal, or a file
+// in the user cache directory.
+func journalFile(org string) string {
+	if journalPath != "" {
+		return journalPath
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "gomgr", org+".journal.jsonl")
+}
+
+// openJournal opens the journal at path to resume the apply it records. It
+// refuses journals for another org or for a config that has changed since,
+// because their plan no longer says what the config asks for.
+func openJournal(cfg *config.Root, path string) (*journal.Journal, util.Plan, error) {
+	if dryRun {
+		return nil, util.Plan{}, fmt.Errorf("--resume cannot be combined with --dry")
+	}
+	j, plan, err := journal.Open(path)
+	if err != nil {
+		return nil, plan, err
+	}
+	h := j.Header()
+	switch {
+	case h.Org != cfg.App.Org:
+		err = fmt.Errorf("journal %s is for org %q, not %q", path, h.Org, cfg.App.Org)
+	case h.ConfigSHA != configFingerprint():
+		err = fmt.Errorf("config changed since the journaled apply; run without --resume to plan again")
+	}
+	if err == nil {
+		plan, err = insync.RestorePlan(plan)
+	}
+	if err != nil {
+		_ = j.Close(err)
+		return nil, plan, err
+	}
+	util.Infof("resume: continuing plan %s from %s (created %s)", h.PlanHash, path, h.Created.Format(time.RFC3339))
+	return j, plan, nil
+}
+
+// configFingerprint hashes the config directory, or returns "" if it cannot
+// be read.
+func configFingerprint() string {
+	fp, err := config.Fingerprint(cfgDir)
+	if err != nil {
+		return ""
+	}
+	return fp
+}
+
+// newMetricsRun starts collecting metrics when --metrics-file or
+// --metrics-push-url is set, and returns nil (metrics disabled) otherwise.
+func newMetricsRun() *metrics.Run {
+	if metricsFile == "" && metricsPushURL == "" {
+		return nil
+	}
+	return metrics.NewRun()
+}
+
+// exportMetrics finishes run with the command's result and writes it to the
+// configured destinations. Export problems are only warned about: metrics
+// describe the run, they must not change its outcome.
+func exportMetrics(ctx context.Context, run *metrics.Run, client *gh.Client, runErr error) {
+	if run == nil {
+		return
+	}
+	run.ObserveAPI(client.Stats())
+	run.Finish(runErr)
+	if metricsFile != "" {
+		if err := run.WriteFile(metricsFile); err != nil {
+			util.Warnf("%v", err)
 		}
-		return insync.ApplyWithOptions(ctx, client, plan, insync.ApplyOptions{ContinueOnError: continueOnError})
-	},
+	}
+	if metricsPushURL != "" {
+		if err := run.Push(ctx, metricsPushURL, metricsJob); err != nil {
+			util.Warnf("%v", err)
+		}
+	}
+}
+
+// newAuditLogger builds the audit trail for an apply from app.audit and
+// --audit-log. It returns nil (auditing disabled) when no sink is configured,
+// which also skips the identity lookup.
+func newAuditLogger(ctx context.Context, cfg *config.Root, client *gh.Client) (*audit.Logger, error) {
+	sinks, err := audit.NewSinks(cfg.App.Audit, auditLog)
+	if err != nil {
+		return nil, err
+	}
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+	l := audit.New(audit.Run{
+		ConfigSHA: audit.ConfigSHA(ctx, cfgDir),
+		Actor:     client.Identity(ctx),
+		Org:       cfg.App.Org,
+	}, sinks...)
+	util.Infof("audit: run %s", l.RunID())
+	return l, nil
 }
 
 func init() {
+	syncCmd.Flags().BoolVar(&resume, "resume", false, "Continue the apply recorded in the journal instead of planning again")
+	syncCmd.Flags().StringVar(&journalPath, "journal", "", "Apply journal file (default <user cache dir>/gomgr/<org>.journal.jsonl)")
+	syncCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "Apply deletes and removals without asking; required when stdin is not a terminal")
+	syncCmd.Flags().IntVar(&allowDestructive, "allow-destructive", -1, "Allow up to N delete/remove changes this run, replacing the guardrails limit")
+	syncCmd.Flags().StringSliceVar(&syncTeams, "team", nil, "Only sync these team slugs (repeatable or comma-separated)")
+	syncCmd.Flags().StringSliceVar(&syncRepos, "repo", nil, "Only sync these repositories (repeatable or comma-separated)")
+	syncCmd.Flags().StringSliceVar(&syncScopes, "scope", nil, "Only plan these phases: teams, members, repos, custom-roles; add cleanups to allow deletions in a scoped run")
 	rootCmd.AddCommand(syncCmd)
 }
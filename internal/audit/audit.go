@@ -0,0 +1,246 @@
+// Package audit writes a tamper-evident trail of every change gomgr applies.
+//
+// Each Record carries the run ID, the git SHA of the config that produced the
+// plan, the identity gomgr authenticated as, the change details (secrets
+// redacted) and the outcome. Records are hash-chained: Hash is the SHA-256 of
+// the previous record's hash followed by the record's own canonical JSON, so
+// editing, dropping or reordering any record breaks every hash after it.
+// Verify recomputes the chain.
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DragonSecurity/gomgr/internal/util"
+)
+
+// Record kinds.
+const (
+	KindRunStart = "run_start"
+	KindChange   = "change"
+	KindRunEnd   = "run_end"
+)
+
+// Record statuses.
+const (
+	StatusOK    = "ok"
+	StatusError = "error"
+)
+
+// Record is one line of the audit trail. Field order is the canonical JSON
+// order the hash is computed over; do not reorder.
+type Record struct {
+	Seq       int64  `json:"seq"`
+	Time      string `json:"ts"`
+	Kind      string `json:"kind"`
+	RunID     string `json:"run_id"`
+	ConfigSHA string `json:"config_sha,omitempty"`
+	Actor     string `json:"actor,omitempty"`
+	Org       string `json:"org,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	Target    string `json:"target,omitempty"`
+	Action    string `json:"action,omitempty"`
+	Status    string `json:"status,omitempty"`
+	Details   any    `json:"details,omitempty"`
+	Error     string `json:"error,omitempty"`
+	PrevHash  string `json:"prev_hash"`
+	Hash      string `json:"hash"`
+}
+
+// Sink receives every serialized record (one JSON object, no newline).
+type Sink interface {
+	Write(ctx context.Context, rec Record, line []byte) error
+	Close() error
+}
+
+// chainSource is implemented by sinks that persist the trail and can tell
+// where the previous run left off, so the chain spans runs.
+type chainSource interface {
+	Last() (seq int64, hash string)
+}
+
+// Run describes the run every record is stamped with.
+type Run struct {
+	ID        string // generated by NewRunID when empty
+	ConfigSHA string // see ConfigSHA
+	Actor     string // authenticated identity
+	Org       string
+}
+
+// Logger hash-chains records and fans them out to its sinks. A nil *Logger
+// is valid and records nothing, so callers never need to nil-check.
+type Logger struct {
+	run   Run
+	sinks []Sink
+	now   func() time.Time
+
+	mu   sync.Mutex
+	seq  int64
+	prev string
+	errs []error
+}
+
+// New returns a Logger writing to sinks. The chain continues from the first
+// sink that remembers a previous run (the JSONL file sink).
+func New(run Run, sinks ...Sink) *Logger {
+	if run.ID == "" {
+		run.ID = NewRunID()
+	}
+	l := &Logger{run: run, sinks: sinks, now: time.Now}
+	for _, s := range sinks {
+		if cs, ok := s.(chainSource); ok {
+			l.seq, l.prev = cs.Last()
+			break
+		}
+	}
+	return l
+}
+
+// RunID returns the ID stamped on every record of this run.
+func (l *Logger) RunID() string {
+	if l == nil {
+		return ""
+	}
+	return l.run.ID
+}
+
+// Start records the beginning of an apply with the number of planned changes.
+func (l *Logger) Start(ctx context.Context, changes int) {
+	l.write(ctx, Record{Kind: KindRunStart, Status: StatusOK, Details: map[string]any{"changes": changes}})
+}
+
+// Change records the outcome of applying ch; err is nil on success.
+func (l *Logger) Change(ctx context.Context, ch util.Change, err error) {
+	rec := Record{
+		Kind:    KindChange,
+		Scope:   ch.Scope,
+		Target:  ch.Target,
+		Action:  ch.Action,
+		Status:  StatusOK,
+		Details: Redact(ch.Details),
+	}
+	if err != nil {
+		rec.Status = StatusError
+		rec.Error = err.Error()
+	}
+	l.write(ctx, rec)
+}
+
+// Finish records the end of the apply and its overall result.
+func (l *Logger) Finish(ctx context.Context, err error) {
+	rec := Record{Kind: KindRunEnd, Status: StatusOK}
+	if err != nil {
+		rec.Status = StatusError
+		rec.Error = err.Error()
+	}
+	l.write(ctx, rec)
+}
+
+func (l *Logger) write(ctx context.Context, rec Record) {
+	if l == nil || len(l.sinks) == 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rec.Seq = l.seq + 1
+	rec.Time = l.now().UTC().Format(time.RFC3339Nano)
+	rec.RunID = l.run.ID
+	rec.ConfigSHA = l.run.ConfigSHA
+	rec.Actor = l.run.Actor
+	rec.Org = l.run.Org
+	rec.PrevHash = l.prev
+	hash, err := hashRecord(rec)
+	if err != nil {
+		l.fail(fmt.Errorf("audit: hash record: %w", err))
+		return
+	}
+	rec.Hash = hash
+	line, err := json.Marshal(rec)
+	if err != nil {
+		l.fail(fmt.Errorf("audit: marshal record: %w", err))
+		return
+	}
+	l.seq, l.prev = rec.Seq, rec.Hash
+
+	// Delivery must not depend on the apply context: the records that matter
+	// most are written right as a run times out or is interrupted.
+	ctx = context.WithoutCancel(ctx)
+	for _, s := range l.sinks {
+		if err := s.Write(ctx, rec, line); err != nil {
+			l.fail(fmt.Errorf("audit: %w", err))
+		}
+	}
+}
+
+// fail remembers a sink error for Close and warns immediately, so a broken
+// sink never goes unnoticed but also never aborts the apply midway.
+func (l *Logger) fail(err error) {
+	util.Warnf("%v", err)
+	l.errs = append(l.errs, err)
+}
+
+// Close closes every sink and returns any error seen while writing or
+// closing, so an incomplete audit trail fails the command.
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	errs := l.errs
+	for _, s := range l.sinks {
+		if err := s.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("audit: close sink: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// hashRecord returns hex(SHA-256(prev_hash + "\n" + canonical JSON)), where
+// the canonical JSON is the record with Hash empty.
+func hashRecord(rec Record) (string, error) {
+	rec.Hash = ""
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(append([]byte(rec.PrevHash+"\n"), b...))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// NewRunID returns a random 16-byte hex ID.
+func NewRunID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// ConfigSHA returns the HEAD commit of the git checkout containing dir, with
+// a "-dirty" suffix when it has uncommitted changes, or "" when dir is not in
+// a git repository (or git is unavailable).
+func ConfigSHA(ctx context.Context, dir string) string {
+	out, err := exec.CommandContext(ctx, "git", "-C", dir, "rev-parse", "HEAD").Output() //nolint:gosec // fixed binary, dir is an argument
+	if err != nil {
+		return ""
+	}
+	sha := strings.TrimSpace(string(out))
+	status, err := exec.CommandContext(ctx, "git", "-C", dir, "status", "--porcelain", "--", ".").Output() //nolint:gosec // fixed binary, dir is an argument
+	if err == nil && len(bytes.TrimSpace(status)) > 0 {
+		sha += "-dirty"
+	}
+	return sha
+}
@@ -0,0 +1,76 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// redacted replaces every value Redact considers secret.
+const redacted = "[REDACTED]"
+
+// secretKeyRe matches detail keys whose values are credentials.
+var secretKeyRe = regexp.MustCompile(`(?i)(token|secret|password|passwd|private_?key|credential|authorization|api_?key)`)
+
+// secretValueRe matches GitHub token formats regardless of the key they sit
+// under, e.g. a PAT pasted into a templated file.
+var secretValueRe = regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{20,}|github_pat_[A-Za-z0-9_]{20,})\b`)
+
+// Redact returns details as plain JSON values (maps, slices, strings,
+// json.Number, bools) with secrets masked: values under secret-looking keys,
+// PEM private keys and GitHub tokens. Typed details such as teamMemberChange
+// are converted through their JSON form, so the result hashes and verifies
+// the same way after a round trip through the audit file.
+func Redact(details any) any {
+	if details == nil {
+		return nil
+	}
+	b, err := json.Marshal(details)
+	if err != nil {
+		return redacted
+	}
+	v, err := decodeJSON(b)
+	if err != nil {
+		return redacted
+	}
+	return redactValue(v)
+}
+
+func redactValue(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, val := range t {
+			if secretKeyRe.MatchString(k) {
+				t[k] = redacted
+				continue
+			}
+			t[k] = redactValue(val)
+		}
+		return t
+	case []any:
+		for i, val := range t {
+			t[i] = redactValue(val)
+		}
+		return t
+	case string:
+		if strings.Contains(t, "PRIVATE KEY-----") {
+			return redacted
+		}
+		return secretValueRe.ReplaceAllString(t, redacted)
+	default:
+		return v
+	}
+}
+
+// decodeJSON decodes b keeping numbers as json.Number so they re-encode
+// byte-for-byte.
+func decodeJSON(b []byte) (any, error) {
+	var v any
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
@@ -0,0 +1,162 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/DragonSecurity/gomgr/internal/config"
+)
+
+// NewSinks builds the sinks configured in app.yaml. stderr adds the
+// --audit-log sink that prints records to standard error.
+func NewSinks(cfg config.AuditConfig, stderr bool) ([]Sink, error) {
+	var sinks []Sink
+	if stderr {
+		sinks = append(sinks, &writerSink{})
+	}
+	if cfg.File != "" {
+		s, err := NewFileSink(cfg.File)
+		if err != nil {
+			closeAll(sinks)
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	if cfg.Syslog != nil {
+		s, err := newSyslogSink(*cfg.Syslog)
+		if err != nil {
+			closeAll(sinks)
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	if cfg.HTTP != nil {
+		sinks = append(sinks, NewHTTPSink(*cfg.HTTP))
+	}
+	return sinks, nil
+}
+
+func closeAll(sinks []Sink) {
+	for _, s := range sinks {
+		_ = s.Close()
+	}
+}
+
+// writerSink prints records to w, or to os.Stderr (resolved at write time)
+// when w is nil.
+type writerSink struct {
+	w io.Writer
+}
+
+func (s *writerSink) Write(_ context.Context, _ Record, line []byte) error {
+	w := s.w
+	if w == nil {
+		w = os.Stderr
+	}
+	_, err := fmt.Fprintln(w, string(line))
+	return err
+}
+
+func (s *writerSink) Close() error { return nil }
+
+// FileSink appends records to a JSONL file and syncs after every record, so
+// a crash mid-apply loses at most the record being written.
+type FileSink struct {
+	f        *os.File
+	lastSeq  int64
+	lastHash string
+}
+
+// NewFileSink opens (or creates) path for appending and reads its last
+// record so the hash chain continues across runs.
+func NewFileSink(path string) (*FileSink, error) {
+	s := &FileSink{}
+	if existing, err := os.ReadFile(path); err == nil { //nolint:gosec // operator-configured audit path
+		if last := lastLine(existing); len(last) > 0 {
+			rec, err := decodeRecord(last)
+			if err != nil {
+				return nil, fmt.Errorf("audit file %s: last record: %w", path, err)
+			}
+			s.lastSeq, s.lastHash = rec.Seq, rec.Hash
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read audit file: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600) //nolint:gosec // operator-configured audit path
+	if err != nil {
+		return nil, fmt.Errorf("open audit file: %w", err)
+	}
+	s.f = f
+	return s, nil
+}
+
+func lastLine(b []byte) []byte {
+	var last []byte
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	sc.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for sc.Scan() {
+		if line := bytes.TrimSpace(sc.Bytes()); len(line) > 0 {
+			last = append(last[:0], line...)
+		}
+	}
+	return last
+}
+
+// Last implements chainSource.
+func (s *FileSink) Last() (int64, string) { return s.lastSeq, s.lastHash }
+
+func (s *FileSink) Write(_ context.Context, _ Record, line []byte) error {
+	if _, err := s.f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write audit file: %w", err)
+	}
+	return s.f.Sync()
+}
+
+func (s *FileSink) Close() error { return s.f.Close() }
+
+// HTTPSink POSTs each record as a JSON body. Any non-2xx response is an
+// error; delivery is not retried beyond the client's transport.
+type HTTPSink struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+// NewHTTPSink returns a sink for cfg. ${VAR} references in header values are
+// expanded from the environment.
+func NewHTTPSink(cfg config.AuditHTTP) *HTTPSink {
+	headers := make(map[string]string, len(cfg.Headers))
+	for k, v := range cfg.Headers {
+		headers[k] = os.ExpandEnv(v)
+	}
+	return &HTTPSink{url: cfg.URL, headers: headers, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (s *HTTPSink) Write(ctx context.Context, _ Record, line []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(line))
+	if err != nil {
+		return fmt.Errorf("audit http request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("audit http post: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("audit http post: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *HTTPSink) Close() error { return nil }
@@ -0,0 +1,13 @@
+//go:build windows || plan9
+
+package audit
+
+import (
+	"errors"
+
+	"github.com/DragonSecurity/gomgr/internal/config"
+)
+
+func newSyslogSink(config.AuditSyslog) (Sink, error) {
+	return nil, errors.New("audit.syslog is not supported on this platform")
+}
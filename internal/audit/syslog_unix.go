@@ -0,0 +1,38 @@
+//go:build !windows && !plan9
+
+package audit
+
+import (
+	"context"
+	"fmt"
+	"log/syslog"
+
+	"github.com/DragonSecurity/gomgr/internal/config"
+)
+
+// syslogSink writes each record as one syslog message: facility AUTH (audit
+// trails belong with security logs), severity INFO or ERR by status.
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+func newSyslogSink(cfg config.AuditSyslog) (Sink, error) {
+	tag := cfg.Tag
+	if tag == "" {
+		tag = "gomgr"
+	}
+	w, err := syslog.Dial(cfg.Network, cfg.Address, syslog.LOG_AUTH|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, fmt.Errorf("connect audit syslog: %w", err)
+	}
+	return &syslogSink{w: w}, nil
+}
+
+func (s *syslogSink) Write(_ context.Context, rec Record, line []byte) error {
+	if rec.Status == StatusError {
+		return s.w.Err(string(line))
+	}
+	return s.w.Info(string(line))
+}
+
+func (s *syslogSink) Close() error { return s.w.Close() }
@@ -0,0 +1,66 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Verify reads a JSONL audit trail and recomputes its hash chain. It returns
+// the number of records checked, or an error naming the first line that was
+// modified, removed or reordered. The first record's prev_hash is trusted as
+// is, so a trail that was rotated can still be verified on its own.
+func Verify(r io.Reader) (int, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	var (
+		n        int
+		line     int
+		prevSeq  int64
+		prevHash string
+	)
+	for sc.Scan() {
+		line++
+		raw := bytes.TrimSpace(sc.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		rec, err := decodeRecord(raw)
+		if err != nil {
+			return n, fmt.Errorf("line %d: %w", line, err)
+		}
+		if n > 0 {
+			if rec.PrevHash != prevHash {
+				return n, fmt.Errorf("line %d: prev_hash does not match the preceding record (record removed or reordered)", line)
+			}
+			if rec.Seq != prevSeq+1 {
+				return n, fmt.Errorf("line %d: seq %d follows %d (record removed or reordered)", line, rec.Seq, prevSeq)
+			}
+		}
+		want, err := hashRecord(rec)
+		if err != nil {
+			return n, fmt.Errorf("line %d: %w", line, err)
+		}
+		if rec.Hash != want {
+			return n, fmt.Errorf("line %d: hash mismatch (record modified)", line)
+		}
+		prevSeq, prevHash = rec.Seq, rec.Hash
+		n++
+	}
+	if err := sc.Err(); err != nil {
+		return n, fmt.Errorf("read audit trail: %w", err)
+	}
+	return n, nil
+}
+
+func decodeRecord(raw []byte) (Record, error) {
+	var rec Record
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&rec); err != nil {
+		return rec, fmt.Errorf("decode record: %w", err)
+	}
+	return rec, nil
+}
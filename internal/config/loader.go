@@ -3,16 +3,19 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"unicode/utf8"
 
 	"gopkg.in/yaml.v3"
 )
 
 func Load(dir string) (*Root, error) {
-	r := &Root{}
+	r := &Root{dir: dir}
 	// app.yaml
 	if err := readYAML(filepath.Join(dir, "app.yaml"), &r.App); err != nil {
 		return nil, err
@@ -27,6 +30,13 @@ func Load(dir string) (*Root, error) {
 	if err != nil && !os.IsNotExist(err) {
 		return nil, fmt.Errorf("read teams directory %s: %w", teamDir, err)
 	}
+	if os.IsNotExist(err) {
+		// No teams reads as "nothing is managed"; with cleanups on that is
+		// far more likely a wrong -c path than an intent to empty the org.
+		if enabled := r.App.cleanupSettings(); len(enabled) > 0 {
+			return nil, fmt.Errorf("teams directory %s does not exist but cleanups are enabled (%s)", teamDir, strings.Join(enabled, ", "))
+		}
+	}
 	for _, e := range entries {
 		if e.IsDir() {
 			continue
@@ -47,9 +57,36 @@ func Load(dir string) (*Root, error) {
 	if err := r.Validate(); err != nil {
 		return nil, err
 	}
+	if err := r.loadFileContents(); err != nil {
+		return nil, err
+	}
 	return r, nil
 }
 
+// resolvePath returns p joined onto the config directory.
+func (r *Root) resolvePath(p string) string {
+	return filepath.Join(r.dir, p)
+}
+
+// loadFileContents reads every FileSpec.ContentFile into Content so the rest
+// of the pipeline only ever deals with inline content. ContentFile is kept for
+// error messages. Must run after Validate, which has already checked that the
+// files exist and that Content was not also set.
+func (r *Root) loadFileContents() error {
+	for i := range r.App.Files {
+		f := &r.App.Files[i]
+		if f.ContentFile == "" {
+			continue
+		}
+		b, err := os.ReadFile(r.resolvePath(f.ContentFile))
+		if err != nil {
+			return fmt.Errorf("app.files[%d] (%s): read content_file %s: %w", i, f.Path, f.ContentFile, err)
+		}
+		f.Content = string(b)
+	}
+	return nil
+}
+
 func readYAML(path string, out any) error {
 	b, err := os.ReadFile(path)
 	if err != nil {
@@ -102,24 +139,192 @@ func (r *Root) Validate() error {
 			return fmt.Errorf("org owner: %w", err)
 		}
 	}
-	if err := validateFileSpecs(r.App.Files); err != nil {
+	if err := r.validateFileSpecs(r.App.Files); err != nil {
+		return err
+	}
+	if err := validateProtected(r.App.Protected); err != nil {
 		return err
 	}
+	if err := validateIgnore(r.App.Ignore); err != nil {
+		return err
+	}
+	if err := validateUnmanagedRepos(r.App); err != nil {
+		return err
+	}
+	if p := r.App.Guardrails.MaxDestructivePercent; p < 0 || p > 100 {
+		return fmt.Errorf("guardrails.max_destructive_percent %d must be between 0 and 100", p)
+	}
+	if err := validateAudit(r.App.Audit); err != nil {
+		return err
+	}
+	if r.App.PrivateKey != "" && r.App.PrivateKeyCommand != "" {
+		return fmt.Errorf("private_key and private_key_command are mutually exclusive")
+	}
+	for _, f := range []struct{ name, raw string }{
+		{"base_url", r.App.BaseURL},
+		{"upload_url", r.App.UploadURL},
+		{"graphql_url", r.App.GraphQLURL},
+	} {
+		if f.raw == "" {
+			continue
+		}
+		u, err := url.Parse(f.raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%s %q must be an absolute http(s) URL", f.name, f.raw)
+		}
+	}
+	switch r.App.Server.Mode {
+	case "", ServerModeReport, ServerModeApply:
+	default:
+		return fmt.Errorf("server.mode %q is invalid (must be report or apply)", r.App.Server.Mode)
+	}
+	if p := r.App.Server.Path; p != "" && !strings.HasPrefix(p, "/") {
+		return fmt.Errorf("server.path %q must start with /", p)
+	}
+	for i, n := range r.App.Notifications {
+		if err := validateNotification(n); err != nil {
+			return fmt.Errorf("app.notifications[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// validateNotification checks a notification target's type and URL. The URL
+// is only checked when it does not depend on the environment, since ${VAR} is
+// expanded at send time. Templates are parsed by notify.New.
+func validateNotification(n NotificationConfig) error {
+	if n.Type != NotifySlack && n.Type != NotifyWebhook {
+		return fmt.Errorf("invalid type %q (must be slack or webhook)", n.Type)
+	}
+	if n.URL == "" {
+		return fmt.Errorf("url is required")
+	}
+	if !strings.Contains(n.URL, "$") {
+		u, err := url.Parse(n.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("url %q must be an absolute http(s) URL", n.URL)
+		}
+	}
+	return nil
+}
+
+// validateProtected rejects protected names that could never match, which
+// would otherwise leave a resource unprotected without anyone noticing.
+func validateProtected(p ProtectedConfig) error {
+	for _, repo := range p.Repos {
+		if err := validateRepoName(repo); err != nil {
+			return fmt.Errorf("protected.repos: %w", err)
+		}
+	}
+	for _, slug := range p.Teams {
+		if !validTeamSlug.MatchString(slug) {
+			return fmt.Errorf("protected.teams: invalid team slug %q", slug)
+		}
+	}
+	for _, u := range p.Users {
+		if err := validateUsername(u); err != nil {
+			return fmt.Errorf("protected.users: %w", err)
+		}
+	}
+	return nil
+}
+
+// validateIgnore rejects malformed ignore globs, which would otherwise
+// silently match nothing.
+func validateIgnore(ig IgnoreConfig) error {
+	for _, list := range []struct {
+		field    string
+		patterns []string
+	}{{"teams", ig.Teams}, {"repos", ig.Repos}, {"users", ig.Users}, {"custom_roles", ig.CustomRoles}} {
+		for _, p := range list.patterns {
+			if _, err := path.Match(p, ""); err != nil {
+				return fmt.Errorf("invalid ignore.%s glob %q: %w", list.field, p, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateUnmanagedRepos checks the unmanaged repository settings, including
+// that unmanaged_repo_action does not contradict delete_unmanaged_repos.
+func validateUnmanagedRepos(a AppConfig) error {
+	switch a.UnmanagedRepoAction {
+	case "", UnmanagedRepoWarn, UnmanagedRepoArchive:
+		if a.UnmanagedRepoAction != "" && a.DeleteUnmanagedRepos {
+			return fmt.Errorf("unmanaged_repo_action %q conflicts with delete_unmanaged_repos: true", a.UnmanagedRepoAction)
+		}
+	case UnmanagedRepoDelete:
+	default:
+		return fmt.Errorf("unmanaged_repo_action %q is invalid (must be warn, archive or delete)", a.UnmanagedRepoAction)
+	}
+	if a.UnmanagedRepoGraceDays < 0 {
+		return fmt.Errorf("unmanaged_repo_grace_days %d must not be negative", a.UnmanagedRepoGraceDays)
+	}
+	if t := a.UnmanagedRepoTopic; t != "" && !validTopic.MatchString(t) {
+		return fmt.Errorf("unmanaged_repo_topic %q is invalid (lowercase letters, digits and hyphens, up to 50 characters)", t)
+	}
 	return nil
 }
 
-// validateFileSpecs ensures every templated file has a path and content and
-// that no two specs target the same path (which would make apply order
-// ambiguous).
-func validateFileSpecs(files []FileSpec) error {
+// validateAudit checks the audit sink settings that would otherwise only
+// fail once the first change is applied.
+func validateAudit(a AuditConfig) error {
+	if a.Syslog != nil {
+		switch a.Syslog.Network {
+		case "", "udp", "tcp", "unix", "unixgram":
+		default:
+			return fmt.Errorf("audit.syslog.network %q is invalid (must be udp, tcp, unix or unixgram)", a.Syslog.Network)
+		}
+		if a.Syslog.Network != "" && a.Syslog.Address == "" {
+			return fmt.Errorf("audit.syslog.address is required when network is set")
+		}
+	}
+	if a.HTTP != nil {
+		u, err := url.Parse(a.HTTP.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("audit.http.url %q must be an absolute http(s) URL", a.HTTP.URL)
+		}
+	}
+	return nil
+}
+
+// validateFileSpecs ensures every templated file has a path and exactly one
+// content source, and that no two specs target the same path (which would
+// make apply order ambiguous). A content_file must exist and be readable;
+// binary content is only accepted with raw: true because text/template would
+// mangle it, and raw content cannot be combined with block mode or merge,
+// which both treat the content as text.
+func (r *Root) validateFileSpecs(files []FileSpec) error {
 	seen := map[string]bool{}
 	for i, f := range files {
 		if strings.TrimSpace(f.Path) == "" {
 			return fmt.Errorf("app.files[%d]: path must not be empty", i)
 		}
-		if strings.TrimSpace(f.Content) == "" {
+		if f.ContentFile != "" {
+			if f.Content != "" {
+				return fmt.Errorf("app.files[%d] (%s): content and content_file are mutually exclusive", i, f.Path)
+			}
+			if err := r.validateContentFile(f); err != nil {
+				return fmt.Errorf("app.files[%d] (%s): %w", i, f.Path, err)
+			}
+		} else if strings.TrimSpace(f.Content) == "" {
 			return fmt.Errorf("app.files[%d] (%s): content must not be empty", i, f.Path)
 		}
+		if f.Mode != "" && f.Mode != FileModeBlock {
+			return fmt.Errorf("app.files[%d] (%s): invalid mode %q (must be %s or omitted)", i, f.Path, f.Mode, FileModeBlock)
+		}
+		if f.Raw && f.Mode == FileModeBlock {
+			return fmt.Errorf("app.files[%d] (%s): raw and mode: %s are mutually exclusive", i, f.Path, FileModeBlock)
+		}
+		if f.Raw && f.Merge != "" {
+			return fmt.Errorf("app.files[%d] (%s): raw and merge are mutually exclusive", i, f.Path)
+		}
+		if err := validateMerge(f); err != nil {
+			return fmt.Errorf("app.files[%d] (%s): %w", i, f.Path, err)
+		}
+		if err := validateFileSelectors(f); err != nil {
+			return fmt.Errorf("app.files[%d] (%s): %w", i, f.Path, err)
+		}
 		if seen[f.Path] {
 			return fmt.Errorf("app.files[%d]: duplicate path %q", i, f.Path)
 		}
@@ -128,6 +333,77 @@ func validateFileSpecs(files []FileSpec) error {
 	return nil
 }
 
+// validateContentFile checks that f.ContentFile is a readable regular file
+// and, unless f.Raw is set, that it holds valid UTF-8 text.
+func (r *Root) validateContentFile(f FileSpec) error {
+	p := r.resolvePath(f.ContentFile)
+	info, err := os.Stat(p)
+	if err != nil {
+		return fmt.Errorf("content_file %s: %w", f.ContentFile, err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("content_file %s is a directory", f.ContentFile)
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return fmt.Errorf("content_file %s is not readable: %w", f.ContentFile, err)
+	}
+	if !f.Raw && !utf8.Valid(b) {
+		return fmt.Errorf("content_file %s is binary; set raw: true to skip templating", f.ContentFile)
+	}
+	return nil
+}
+
+// validateMerge checks the structured-merge settings of a FileSpec. Whether
+// the rendered content actually parses is checked at plan time, once the
+// template has been executed.
+func validateMerge(f FileSpec) error {
+	switch f.Merge {
+	case "":
+		if f.MergeArrays != "" {
+			return fmt.Errorf("merge_arrays requires merge")
+		}
+		return nil
+	case MergeJSON, MergeYAML:
+	default:
+		return fmt.Errorf("invalid merge %q (must be %s or %s)", f.Merge, MergeJSON, MergeYAML)
+	}
+	if f.Mode == FileModeBlock {
+		return fmt.Errorf("merge and mode: %s are mutually exclusive", FileModeBlock)
+	}
+	switch f.MergeArrays {
+	case "", MergeArraysReplace, MergeArraysUnion:
+		return nil
+	}
+	return fmt.Errorf("invalid merge_arrays %q (must be %s or %s)", f.MergeArrays, MergeArraysReplace, MergeArraysUnion)
+}
+
+// validateFileSelectors rejects malformed only/exclude globs (which would
+// otherwise silently match nothing) and unknown match.visibility values.
+func validateFileSelectors(f FileSpec) error {
+	for _, list := range []struct {
+		field    string
+		patterns []string
+	}{{"only", f.Only}, {"exclude", f.Exclude}} {
+		for _, p := range list.patterns {
+			if _, err := path.Match(p, ""); err != nil {
+				return fmt.Errorf("invalid %s glob %q: %w", list.field, p, err)
+			}
+		}
+	}
+	if f.Match == nil {
+		return nil
+	}
+	for _, v := range f.Match.Visibility {
+		switch v {
+		case "public", "private", "internal":
+		default:
+			return fmt.Errorf("invalid match.visibility %q (must be public, private, or internal)", v)
+		}
+	}
+	return nil
+}
+
 var validRepoName = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
 
 func validateRepoName(name string) error {
@@ -160,6 +436,8 @@ func validateUsername(name string) error {
 
 var validTeamSlug = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
 
+var validTopic = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,49}$`)
+
 // ValidateCodeOwner checks that a CODEOWNERS entry is well-formed. Accepts
 // bare usernames (octocat), explicit user refs (@octocat), and team refs
 // (@org/team-slug). Emails are not yet supported.
@@ -190,6 +468,61 @@ func ValidateCodeOwner(co string) error {
 	return nil
 }
 
+// ValidateCodeOwnersPattern checks a CODEOWNERS path pattern. CODEOWNERS
+// follows gitignore rules except that GitHub silently ignores lines using
+// negation (!), character ranges ([ ]) or a backslash-escaped leading #, so
+// those are rejected here instead of producing a rule that never applies.
+func ValidateCodeOwnersPattern(pattern string) error {
+	switch {
+	case pattern == "":
+		return fmt.Errorf("codeowners pattern must not be empty")
+	case strings.ContainsAny(pattern, " \t\n\r"):
+		return fmt.Errorf("codeowners pattern contains whitespace: %q", pattern)
+	case strings.HasPrefix(pattern, "#"), strings.HasPrefix(pattern, `\#`):
+		return fmt.Errorf("codeowners pattern %q starts with #, which GitHub treats as a comment", pattern)
+	case strings.HasPrefix(pattern, "!"):
+		return fmt.Errorf("codeowners pattern %q uses ! negation, which GitHub ignores", pattern)
+	case strings.ContainsAny(pattern, "[]"):
+		return fmt.Errorf("codeowners pattern %q uses a [ ] character range, which GitHub ignores", pattern)
+	}
+	return nil
+}
+
+var validEmail = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+
+// ValidateCodeOwnersFile checks every rule line of a rendered CODEOWNERS
+// file: the pattern must be one GitHub honors and each owner must be a
+// well-formed @user or @org/team ref, or an email address. Blank lines and
+// comments are skipped. A pattern with no owners is valid — it deliberately
+// un-owns matching paths.
+func ValidateCodeOwnersFile(content string) error {
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if err := ValidateCodeOwnersPattern(fields[0]); err != nil {
+			return fmt.Errorf("CODEOWNERS line %d: %w", i+1, err)
+		}
+		for _, owner := range fields[1:] {
+			if strings.HasPrefix(owner, "#") {
+				break // trailing comment
+			}
+			if !strings.HasPrefix(owner, "@") {
+				if validEmail.MatchString(owner) {
+					continue
+				}
+				return fmt.Errorf("CODEOWNERS line %d: owner %q must start with @ or be an email address", i+1, owner)
+			}
+			if err := ValidateCodeOwner(owner); err != nil {
+				return fmt.Errorf("CODEOWNERS line %d: %w", i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
 func BootstrapTeamYAML(path string, name string) error {
 	t := TeamConfig{
 		Name:         name,
@@ -103,6 +103,30 @@ func TestLoad_NoTeamsDir(t *testing.T) {
 	}
 }
 
+func TestLoad_NoTeamsDirWithCleanups(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "app.yaml"), "org: myorg\ndelete_unconfigured_teams: true\nunmanaged_repo_action: archive\n")
+	writeFile(t, filepath.Join(dir, "org.yaml"), `owners: []`)
+
+	_, err := Load(dir)
+	if err == nil {
+		t.Fatal("expected an error for a missing teams directory with cleanups enabled")
+	}
+	for _, want := range []string{"does not exist", "delete_unconfigured_teams", "unmanaged_repo_action: archive"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error containing %q, got: %v", want, err)
+		}
+	}
+
+	// An existing but empty teams directory is left to the plan guardrails.
+	if err := os.MkdirAll(filepath.Join(dir, "teams"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(dir); err != nil {
+		t.Errorf("unexpected error with an empty teams directory: %v", err)
+	}
+}
+
 func TestLoad_IgnoresNonYAMLFiles(t *testing.T) {
 	dir := t.TempDir()
 	writeFile(t, filepath.Join(dir, "app.yaml"), `org: myorg`)
@@ -210,3 +234,193 @@ func TestValidateCodeOwner(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateCodeOwnersPattern(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		wantErr bool
+	}{
+		{"catch-all", "*", false},
+		{"directory", "/infra/", false},
+		{"extension", "*.sql", false},
+		{"double star", "docs/**/*.md", false},
+		{"empty", "", true},
+		{"whitespace", "my dir/", true},
+		{"negation", "!vendor/", true},
+		{"comment", "#notes", true},
+		{"escaped hash", `\#notes`, true},
+		{"character range", "*.[ch]", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateCodeOwnersPattern(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateCodeOwnersPattern(%q) err=%v, wantErr=%v", tt.in, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateCodeOwnersFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		wantErr bool
+	}{
+		{"valid", "# owners\n* @org/platform\n\n/infra/ @org/devops @octocat # ops\n", false},
+		{"unowned path", "* @org/platform\n/generated/\n", false},
+		{"owner without @", "* octocat\n", true},
+		{"email owner", "*.go dev@example.com @org/go\n", false},
+		{"bad owner", "* @bad--user\n", true},
+		{"ignored pattern", "* @org/platform\n!vendor/ @org/platform\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateCodeOwnersFile(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateCodeOwnersFile(%q) err=%v, wantErr=%v", tt.in, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad_ContentFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "app.yaml"), `org: myorg
+files:
+  - path: LICENSE
+    content_file: files/LICENSE
+  - path: .github/logo.png
+    content_file: files/logo.png
+    raw: true
+`)
+	writeFile(t, filepath.Join(dir, "org.yaml"), `owners: []`)
+	if err := os.MkdirAll(filepath.Join(dir, "files"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "files", "LICENSE"), "MIT License\nCopyright (c) {{.Org}}\n")
+	logo := "\x89PNG\r\n\x1a\n\x00\xff"
+	writeFile(t, filepath.Join(dir, "files", "logo.png"), logo)
+
+	root, err := Load(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := root.App.Files[0].Content; got != "MIT License\nCopyright (c) {{.Org}}\n" {
+		t.Errorf("expected LICENSE content loaded from file, got %q", got)
+	}
+	if got := root.App.Files[1].Content; got != logo {
+		t.Errorf("expected binary content preserved byte for byte, got %q", got)
+	}
+}
+
+func TestLoad_ContentFileErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		files     string
+		errSubstr string
+	}{
+		{
+			name: "missing file",
+			files: `  - path: LICENSE
+    content_file: files/nope
+`,
+			errSubstr: "content_file files/nope",
+		},
+		{
+			name: "both content and content_file",
+			files: `  - path: LICENSE
+    content: MIT
+    content_file: files/LICENSE
+`,
+			errSubstr: "mutually exclusive",
+		},
+		{
+			name: "binary without raw",
+			files: `  - path: logo.png
+    content_file: files/logo.png
+`,
+			errSubstr: "raw: true",
+		},
+		{
+			name: "directory",
+			files: `  - path: LICENSE
+    content_file: files
+`,
+			errSubstr: "is a directory",
+		},
+		{
+			name: "raw with block mode",
+			files: `  - path: logo.png
+    content_file: files/logo.png
+    raw: true
+    mode: block
+`,
+			errSubstr: "raw and mode: block are mutually exclusive",
+		},
+		{
+			name: "raw with merge",
+			files: `  - path: renovate.json
+    content: '{"extends": []}'
+    raw: true
+    merge: json
+`,
+			errSubstr: "raw and merge are mutually exclusive",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile(t, filepath.Join(dir, "app.yaml"), "org: myorg\nfiles:\n"+tt.files)
+			writeFile(t, filepath.Join(dir, "org.yaml"), `owners: []`)
+			if err := os.MkdirAll(filepath.Join(dir, "files"), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			writeFile(t, filepath.Join(dir, "files", "LICENSE"), "MIT")
+			writeFile(t, filepath.Join(dir, "files", "logo.png"), "\x89PNG\xff\xfe")
+
+			_, err := Load(dir)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.errSubstr) {
+				t.Errorf("expected error containing %q, got: %v", tt.errSubstr, err)
+			}
+		})
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "app.yaml"), "org: myorg\n")
+	if err := os.MkdirAll(filepath.Join(dir, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := Fingerprint(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, ".git", "HEAD"), "ref: refs/heads/main\n")
+	if again, _ := Fingerprint(dir); again != first {
+		t.Error("changes under .git should not change the fingerprint")
+	}
+
+	writeFile(t, filepath.Join(dir, "app.yaml"), "org: other\n")
+	edited, _ := Fingerprint(dir)
+	if edited == first {
+		t.Error("editing app.yaml should change the fingerprint")
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "teams"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "teams", "web.yaml"), "name: Web\n")
+	if added, _ := Fingerprint(dir); added == edited {
+		t.Error("adding a team file should change the fingerprint")
+	}
+
+	if _, err := Fingerprint(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+}
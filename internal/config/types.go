@@ -5,7 +5,22 @@ import "strings"
 type AppConfig struct {
 	AppID      int64  `yaml:"app_id,omitempty"`
 	PrivateKey string `yaml:"private_key,omitempty"`
-	Org        string `yaml:"org"`
+	// PrivateKeyCommand is a shell command whose output is the App's PEM
+	// private key, e.g. a secret manager CLI. Mutually exclusive with
+	// PrivateKey.
+	PrivateKeyCommand string `yaml:"private_key_command,omitempty"`
+	// InstallationID pins the App installation to use instead of looking up
+	// the org's installation (GITHUB_APP_INSTALLATION_ID also works).
+	InstallationID int64  `yaml:"installation_id,omitempty"`
+	Org            string `yaml:"org"`
+
+	// BaseURL points gomgr at GitHub Enterprise Server (or GHE.com), e.g.
+	// https://ghe.example.com/api/v3. UploadURL and GraphQLURL are derived
+	// from it when empty. GOMGR_BASE_URL, GOMGR_UPLOAD_URL and
+	// GOMGR_GRAPHQL_URL override all three.
+	BaseURL    string `yaml:"base_url,omitempty"`
+	UploadURL  string `yaml:"upload_url,omitempty"`
+	GraphQLURL string `yaml:"graphql_url,omitempty"`
 
 	DryWarnings struct {
 		WarnUnmanagedTeams        bool `yaml:"warn_unmanaged_teams"`
@@ -13,12 +28,42 @@ type AppConfig struct {
 		WarnUnmanagedRepos        bool `yaml:"warn_unmanaged_repos"`
 		WarnUnmanagedCustomRoles  bool `yaml:"warn_unmanaged_custom_roles"`
 	} `yaml:"dry_warnings"`
-	RemoveMembersWithoutTeam   bool `yaml:"remove_members_without_team"`
-	DeleteUnconfiguredTeams    bool `yaml:"delete_unconfigured_teams"`
+	RemoveMembersWithoutTeam bool `yaml:"remove_members_without_team"`
+	DeleteUnconfiguredTeams  bool `yaml:"delete_unconfigured_teams"`
+	// RemoveExtraTeamMembers removes members of configured teams who are not
+	// listed as a maintainer or member of that team.
+	RemoveExtraTeamMembers     bool `yaml:"remove_extra_team_members"`
 	DeleteUnmanagedRepos       bool `yaml:"delete_unmanaged_repos"`
 	DeleteUnmanagedCustomRoles bool `yaml:"delete_unmanaged_custom_roles"`
 	DeleteStaleCodeowners      bool `yaml:"delete_stale_codeowners"`
-	CreateRepo                 bool `yaml:"create_repo"`
+	// UnmanagedRepoAction is what happens to repositories no team lists:
+	// UnmanagedRepoWarn, UnmanagedRepoArchive or UnmanagedRepoDelete. Empty
+	// falls back to delete_unmanaged_repos and warn_unmanaged_repos; see
+	// RepoCleanupAction.
+	UnmanagedRepoAction string `yaml:"unmanaged_repo_action,omitempty"`
+	// UnmanagedRepoGraceDays, when positive, leaves unmanaged repositories
+	// pushed to within that many days alone.
+	UnmanagedRepoGraceDays int `yaml:"unmanaged_repo_grace_days,omitempty"`
+	// UnmanagedRepoTopic is added to repositories before they are archived,
+	// marking them as archived by gomgr.
+	UnmanagedRepoTopic string `yaml:"unmanaged_repo_topic,omitempty"`
+	// UnarchiveManagedRepos unarchives archived repositories a team lists.
+	// With UnmanagedRepoTopic set, only repositories carrying the topic are
+	// unarchived, and the topic is removed.
+	UnarchiveManagedRepos bool `yaml:"unarchive_managed_repos,omitempty"`
+	// StrictCodeowners turns codeowners that GitHub would ignore (unknown
+	// teams, owners without write access) from plan warnings into errors.
+	StrictCodeowners bool `yaml:"strict_codeowners"`
+	CreateRepo       bool `yaml:"create_repo"`
+
+	// Guardrails caps how many delete and remove changes one apply may make.
+	Guardrails GuardrailsConfig `yaml:"guardrails,omitempty"`
+	// Protected lists resources gomgr never deletes or removes, whatever
+	// the cleanup settings say.
+	Protected ProtectedConfig `yaml:"protected,omitempty"`
+	// Ignore lists resources the cleanups treat as if they were not there:
+	// no warning, no delete or remove.
+	Ignore IgnoreConfig `yaml:"ignore,omitempty"`
 
 	// SignOff is the identity used for the Signed-off-by trailer appended to
 	// every commit gomgr writes, in "Name <email>" form. Set it when the org
@@ -33,7 +78,7 @@ type AppConfig struct {
 
 	// Files declares templated files that should exist in every managed
 	// repository. Each entry's Content is rendered through text/template with
-	// {Org, Repo} context. Only (optional) limits which repos an entry applies
+	// {Org, Repo} context unless Raw is set. Only (optional) limits which repos an entry applies
 	// to via path.Match-style globs.
 	Files []FileSpec `yaml:"files,omitempty"`
 
@@ -42,6 +87,173 @@ type AppConfig struct {
 	AddRenovateConfig bool   `yaml:"add_renovate_config,omitempty"`
 	RenovateConfig    string `yaml:"renovate_config,omitempty"`
 	AddDefaultReadme  bool   `yaml:"add_default_readme,omitempty"`
+
+	// Audit configures the tamper-evident audit trail of applied changes.
+	Audit AuditConfig `yaml:"audit,omitempty"`
+
+	// Notifications are sent after every non-dry sync with a summary of
+	// applied changes, failures and plan warnings.
+	Notifications []NotificationConfig `yaml:"notifications,omitempty"`
+
+	// Server configures `gomgr serve`.
+	Server ServerConfig `yaml:"server,omitempty"`
+}
+
+// Unmanaged repository actions.
+const (
+	UnmanagedRepoWarn    = "warn"
+	UnmanagedRepoArchive = "archive"
+	UnmanagedRepoDelete  = "delete"
+)
+
+// RepoCleanupAction returns the action for unmanaged repositories:
+// UnmanagedRepoAction when set, otherwise delete or warn as the legacy
+// delete_unmanaged_repos and dry_warnings.warn_unmanaged_repos flags say,
+// or "" to leave them alone.
+func (a AppConfig) RepoCleanupAction() string {
+	switch {
+	case a.UnmanagedRepoAction != "":
+		return a.UnmanagedRepoAction
+	case a.DeleteUnmanagedRepos:
+		return UnmanagedRepoDelete
+	case a.DryWarnings.WarnUnmanagedRepos:
+		return UnmanagedRepoWarn
+	}
+	return ""
+}
+
+// cleanupSettings returns the names of the enabled settings that delete,
+// remove or archive resources gomgr does not find in the config.
+func (a AppConfig) cleanupSettings() []string {
+	var out []string
+	for _, s := range []struct {
+		name string
+		on   bool
+	}{
+		{"remove_members_without_team", a.RemoveMembersWithoutTeam},
+		{"delete_unconfigured_teams", a.DeleteUnconfiguredTeams},
+		{"remove_extra_team_members", a.RemoveExtraTeamMembers},
+		{"delete_unmanaged_custom_roles", a.DeleteUnmanagedCustomRoles},
+		{"delete_stale_codeowners", a.DeleteStaleCodeowners},
+	} {
+		if s.on {
+			out = append(out, s.name)
+		}
+	}
+	switch a.RepoCleanupAction() {
+	case UnmanagedRepoDelete:
+		if a.UnmanagedRepoAction == "" {
+			out = append(out, "delete_unmanaged_repos")
+		} else {
+			out = append(out, "unmanaged_repo_action: delete")
+		}
+	case UnmanagedRepoArchive:
+		out = append(out, "unmanaged_repo_action: archive")
+	}
+	return out
+}
+
+// DefaultMaxDestructive is the guardrail on delete and remove changes per
+// apply when guardrails.max_destructive_changes is not set.
+const DefaultMaxDestructive = 10
+
+// GuardrailsConfig limits destructive changes. MaxDestructiveChanges caps
+// their number (0 means DefaultMaxDestructive, negative disables the cap);
+// MaxDestructivePercent, when positive, also caps them as a percentage of
+// the teams, team memberships, repositories and custom roles that exist.
+type GuardrailsConfig struct {
+	MaxDestructiveChanges int `yaml:"max_destructive_changes,omitempty"`
+	MaxDestructivePercent int `yaml:"max_destructive_percent,omitempty"`
+}
+
+// ProtectedConfig names repositories, team slugs and user logins that are
+// exempt from every delete and remove. Names match case-insensitively.
+type ProtectedConfig struct {
+	Repos []string `yaml:"repos,omitempty"`
+	Teams []string `yaml:"teams,omitempty"`
+	Users []string `yaml:"users,omitempty"`
+}
+
+// IgnoreConfig holds path.Match globs for team slugs, repositories, user
+// logins and custom role names that cleanups leave alone, such as bot
+// accounts or teams synced from an identity provider. Matching is
+// case-insensitive.
+type IgnoreConfig struct {
+	Teams       []string `yaml:"teams,omitempty"`
+	Repos       []string `yaml:"repos,omitempty"`
+	Users       []string `yaml:"users,omitempty"`
+	CustomRoles []string `yaml:"custom_roles,omitempty"`
+}
+
+// Server modes: what `gomgr serve` does with the drift a webhook reveals.
+const (
+	ServerModeReport = "report"
+	ServerModeApply  = "apply"
+)
+
+// ServerConfig configures the webhook server. Mode report (the default) only
+// logs and notifies about drift; apply reverts it. WebhookSecret may
+// reference an environment variable as ${VAR} and falls back to
+// GOMGR_WEBHOOK_SECRET; the server refuses to start without one.
+type ServerConfig struct {
+	Listen        string `yaml:"listen,omitempty"` // defaults to ":8080"
+	Path          string `yaml:"path,omitempty"`   // defaults to "/webhook"
+	WebhookSecret string `yaml:"webhook_secret,omitempty"`
+	Mode          string `yaml:"mode,omitempty"`
+}
+
+// Notification target types.
+const (
+	NotifySlack   = "slack"
+	NotifyWebhook = "webhook"
+)
+
+// NotificationConfig is one post-sync notification target.
+//
+// Type NotifySlack posts {"text": body} to a Slack-compatible incoming
+// webhook; NotifyWebhook posts body as-is, defaulting to the JSON summary.
+// Template, when set, is a text/template rendered with the run summary and
+// replaces the default body. OnlyOnChange skips runs that applied and failed
+// nothing; OnlyOnFailure skips runs without failures. Both may be set.
+//
+// URL and Headers values may reference environment variables as ${VAR} so
+// webhook secrets stay out of the config repo.
+type NotificationConfig struct {
+	Type          string            `yaml:"type"`
+	URL           string            `yaml:"url"`
+	Headers       map[string]string `yaml:"headers,omitempty"`
+	Template      string            `yaml:"template,omitempty"`
+	OnlyOnChange  bool              `yaml:"only_on_change,omitempty"`
+	OnlyOnFailure bool              `yaml:"only_on_failure,omitempty"`
+}
+
+// AuditConfig selects the sinks that receive audit records. Every configured
+// sink receives every record; with none configured (and no --audit-log) no
+// audit trail is written.
+type AuditConfig struct {
+	// File is a JSONL file records are appended to. Relative paths are
+	// resolved against the working directory, not the config directory, so
+	// the trail does not end up inside the config checkout. The hash chain
+	// continues from the file's last record across runs.
+	File   string       `yaml:"file,omitempty"`
+	Syslog *AuditSyslog `yaml:"syslog,omitempty"`
+	HTTP   *AuditHTTP   `yaml:"http,omitempty"`
+}
+
+// AuditSyslog sends records to syslog. An empty Address uses the local
+// syslog daemon; otherwise Network (udp, tcp, unix or unixgram) and Address
+// name a remote collector.
+type AuditSyslog struct {
+	Network string `yaml:"network,omitempty"`
+	Address string `yaml:"address,omitempty"`
+	Tag     string `yaml:"tag,omitempty"` // defaults to "gomgr"
+}
+
+// AuditHTTP POSTs each record as JSON to URL. Header values may reference
+// environment variables as ${VAR} so tokens stay out of the config repo.
+type AuditHTTP struct {
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers,omitempty"`
 }
 
 // FileSpec declares a file that gomgr should ensure exists in managed repos.
@@ -54,15 +266,76 @@ type AppConfig struct {
 // hand-edited content alone. When true gomgr compares the rendered content to
 // what is on the default branch and pushes an update commit if they differ —
 // useful for config-derived files like CODEOWNERS that should track the YAML.
+//
+// Branch defaults to the repository's own default branch. When it names a
+// different branch that does not exist, apply fails with a clear error unless
+// CreateBranch is set, in which case the branch is created from the default
+// branch first.
+//
+// ContentFile is an alternative to inline Content: a path relative to the
+// config directory whose bytes Load reads into Content. Raw skips templating
+// entirely, which is required for binary assets such as logos and useful for
+// files that legitimately contain {{ }} (e.g. GitHub Actions workflows).
+//
+// Mode selects how much of the file gomgr owns. Empty (the default) means the
+// whole file, governed by Reconcile. FileModeBlock means only the text between
+// "BEGIN gomgr" / "END gomgr" marker lines: the block is inserted when
+// missing and kept in sync on every run, while everything around it is left
+// to humans. Reconcile is ignored in block mode.
+//
+// Merge selects a structured merge strategy (MergeJSON or MergeYAML) for
+// config files such as renovate.json: the rendered document is deep-merged
+// into the existing file, so gomgr-owned keys roll out org-wide while keys
+// only present in the repo survive. MergeArrays picks how arrays combine
+// (MergeArraysReplace, the default, or MergeArraysUnion). Like block mode,
+// merge always reconciles.
+//
+// Match and Exclude narrow the target repos further: Match selects on
+// attributes resolved from the team configs (visibility, topics, granted
+// teams, template flag) and Exclude drops repos whose name matches any glob.
+// All selectors must agree for a repo to receive the file.
 type FileSpec struct {
-	Path      string   `yaml:"path"`
-	Content   string   `yaml:"content"`
-	Message   string   `yaml:"message,omitempty"`
-	Branch    string   `yaml:"branch,omitempty"`
-	Only      []string `yaml:"only,omitempty"`
-	Reconcile bool     `yaml:"reconcile,omitempty"`
+	Path         string     `yaml:"path"`
+	Content      string     `yaml:"content,omitempty"`
+	ContentFile  string     `yaml:"content_file,omitempty"`
+	Raw          bool       `yaml:"raw,omitempty"`
+	Message      string     `yaml:"message,omitempty"`
+	Branch       string     `yaml:"branch,omitempty"`
+	CreateBranch bool       `yaml:"create_branch,omitempty"`
+	Only         []string   `yaml:"only,omitempty"`
+	Reconcile    bool       `yaml:"reconcile,omitempty"`
+	Mode         string     `yaml:"mode,omitempty"`
+	Merge        string     `yaml:"merge,omitempty"`
+	MergeArrays  string     `yaml:"merge_arrays,omitempty"`
+	Exclude      []string   `yaml:"exclude,omitempty"`
+	Match        *FileMatch `yaml:"match,omitempty"`
 }
 
+// FileMatch selects repositories by their resolved settings. Unset fields do
+// not constrain the match. Visibility, TopicsAny and Teams match when the repo
+// has any of the listed values; TopicsAll requires every listed topic.
+// Template, when set, must equal the repo's template flag.
+type FileMatch struct {
+	Visibility []string `yaml:"visibility,omitempty"`
+	TopicsAny  []string `yaml:"topics_any,omitempty"`
+	TopicsAll  []string `yaml:"topics_all,omitempty"`
+	Teams      []string `yaml:"teams,omitempty"`
+	Template   *bool    `yaml:"template,omitempty"`
+}
+
+// FileModeBlock is the FileSpec.Mode value that manages a marker-delimited
+// section of the file instead of the whole file.
+const FileModeBlock = "block"
+
+// Structured merge formats and array strategies for FileSpec.Merge and
+// FileSpec.MergeArrays.
+const (
+	MergeJSON          = "json"
+	MergeYAML          = "yaml"
+	MergeArraysReplace = "replace"
+	MergeArraysUnion   = "union"
+)
+
 type OrgConfig struct {
 	Owners      []string           `yaml:"owners"`
 	CustomRoles []CustomRoleConfig `yaml:"custom_roles,omitempty"`
@@ -108,6 +381,10 @@ type Root struct {
 	App  AppConfig    `yaml:"app"`
 	Org  OrgConfig    `yaml:"org"`
 	Team []TeamConfig `yaml:"teams"`
+
+	// dir is the config directory Load read from. Relative paths in the
+	// config (e.g. FileSpec.ContentFile) are resolved against it.
+	dir string
 }
 
 // ResolvedSlug returns the team's slug, deriving it from the name if not explicitly set.
@@ -260,6 +260,185 @@ func TestValidate(t *testing.T) {
 			wantErr:   true,
 			errSubstr: "custom role name must not be empty",
 		},
+		{
+			name: "invalid file mode",
+			root: Root{
+				App: AppConfig{Org: "myorg", Files: []FileSpec{
+					{Path: ".gitignore", Content: "x", Mode: "append"},
+				}},
+			},
+			wantErr:   true,
+			errSubstr: "invalid mode",
+		},
+		{
+			name: "invalid merge format",
+			root: Root{
+				App: AppConfig{Org: "myorg", Files: []FileSpec{
+					{Path: "renovate.json", Content: "{}", Merge: "toml"},
+				}},
+			},
+			wantErr:   true,
+			errSubstr: "invalid merge",
+		},
+		{
+			name: "merge_arrays without merge",
+			root: Root{
+				App: AppConfig{Org: "myorg", Files: []FileSpec{
+					{Path: "renovate.json", Content: "{}", MergeArrays: "union"},
+				}},
+			},
+			wantErr:   true,
+			errSubstr: "merge_arrays requires merge",
+		},
+		{
+			name: "invalid match visibility",
+			root: Root{
+				App: AppConfig{Org: "myorg", Files: []FileSpec{
+					{Path: "LICENSE", Content: "MIT", Match: &FileMatch{Visibility: []string{"secret"}}},
+				}},
+			},
+			wantErr:   true,
+			errSubstr: "invalid match.visibility",
+		},
+		{
+			name: "malformed exclude glob",
+			root: Root{
+				App: AppConfig{Org: "myorg", Files: []FileSpec{
+					{Path: "LICENSE", Content: "MIT", Exclude: []string{"legacy-["}},
+				}},
+			},
+			wantErr:   true,
+			errSubstr: "invalid exclude glob",
+		},
+		{
+			name: "merge with block mode",
+			root: Root{
+				App: AppConfig{Org: "myorg", Files: []FileSpec{
+					{Path: "renovate.json", Content: "{}", Merge: "json", Mode: "block"},
+				}},
+			},
+			wantErr:   true,
+			errSubstr: "mutually exclusive",
+		},
+		{
+			name: "audit http url not absolute",
+			root: Root{
+				App: AppConfig{Org: "myorg", Audit: AuditConfig{HTTP: &AuditHTTP{URL: "/audit"}}},
+			},
+			wantErr:   true,
+			errSubstr: "audit.http.url",
+		},
+		{
+			name: "audit syslog bad network",
+			root: Root{
+				App: AppConfig{Org: "myorg", Audit: AuditConfig{Syslog: &AuditSyslog{Network: "http", Address: "x:514"}}},
+			},
+			wantErr:   true,
+			errSubstr: "audit.syslog.network",
+		},
+		{
+			name: "notification bad type",
+			root: Root{
+				App: AppConfig{Org: "myorg", Notifications: []NotificationConfig{{Type: "email", URL: "https://example.com"}}},
+			},
+			wantErr:   true,
+			errSubstr: "app.notifications[0]: invalid type",
+		},
+		{
+			name: "notification relative url",
+			root: Root{
+				App: AppConfig{Org: "myorg", Notifications: []NotificationConfig{{Type: NotifySlack, URL: "hooks/x"}}},
+			},
+			wantErr:   true,
+			errSubstr: "absolute http(s) URL",
+		},
+		{
+			name: "notification url from env",
+			root: Root{
+				App: AppConfig{Org: "myorg", Notifications: []NotificationConfig{{Type: NotifyWebhook, URL: "${HOOK_URL}"}}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "private key and command",
+			root: Root{
+				App: AppConfig{Org: "myorg", PrivateKey: "./key.pem", PrivateKeyCommand: "vault read -field=key secret/gomgr"},
+			},
+			wantErr:   true,
+			errSubstr: "mutually exclusive",
+		},
+		{
+			name: "relative base_url",
+			root: Root{
+				App: AppConfig{Org: "myorg", BaseURL: "ghe.example.com/api/v3"},
+			},
+			wantErr:   true,
+			errSubstr: "base_url",
+		},
+		{
+			name: "protected user with invalid characters",
+			root: Root{
+				App: AppConfig{Org: "myorg", Protected: ProtectedConfig{Users: []string{"bad user"}}},
+			},
+			wantErr:   true,
+			errSubstr: "protected.users",
+		},
+		{
+			name: "destructive percent out of range",
+			root: Root{
+				App: AppConfig{Org: "myorg", Guardrails: GuardrailsConfig{MaxDestructivePercent: 150}},
+			},
+			wantErr:   true,
+			errSubstr: "max_destructive_percent",
+		},
+		{
+			name: "ignore bad glob",
+			root: Root{
+				App: AppConfig{Org: "myorg", Ignore: IgnoreConfig{Users: []string{"bot-["}}},
+			},
+			wantErr:   true,
+			errSubstr: "ignore.users",
+		},
+		{
+			name: "unmanaged repo action invalid",
+			root: Root{
+				App: AppConfig{Org: "myorg", UnmanagedRepoAction: "hide"},
+			},
+			wantErr:   true,
+			errSubstr: "unmanaged_repo_action",
+		},
+		{
+			name: "unmanaged repo action contradicts delete flag",
+			root: Root{
+				App: AppConfig{Org: "myorg", UnmanagedRepoAction: UnmanagedRepoArchive, DeleteUnmanagedRepos: true},
+			},
+			wantErr:   true,
+			errSubstr: "conflicts with delete_unmanaged_repos",
+		},
+		{
+			name: "unmanaged repo topic invalid",
+			root: Root{
+				App: AppConfig{Org: "myorg", UnmanagedRepoAction: UnmanagedRepoArchive, UnmanagedRepoTopic: "Gomgr Unmanaged"},
+			},
+			wantErr:   true,
+			errSubstr: "unmanaged_repo_topic",
+		},
+		{
+			name: "server bad mode",
+			root: Root{
+				App: AppConfig{Org: "myorg", Server: ServerConfig{Mode: "revert"}},
+			},
+			wantErr:   true,
+			errSubstr: "server.mode",
+		},
+		{
+			name: "server relative path",
+			root: Root{
+				App: AppConfig{Org: "myorg", Server: ServerConfig{Path: "webhook"}},
+			},
+			wantErr:   true,
+			errSubstr: "server.path",
+		},
 	}
 
 	for _, tt := range tests {
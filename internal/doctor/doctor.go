@@ -0,0 +1,315 @@
+// Package doctor implements `gomgr doctor`: a preflight check that the
+// credentials gomgr resolved can do everything the loaded config asks for,
+// so a missing permission fails before the first change lands instead of in
+// the middle of an apply.
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/DragonSecurity/gomgr/internal/config"
+	"github.com/DragonSecurity/gomgr/internal/gh"
+)
+
+// Check outcomes.
+const (
+	Pass = "PASS"
+	Warn = "WARN"
+	Fail = "FAIL"
+	// Skip marks a credential source the chain passed over; informational.
+	Skip = "SKIP"
+)
+
+// Check is one row of the doctor report. Hint says how to fix a WARN or
+// FAIL.
+type Check struct {
+	Name   string
+	Status string
+	Detail string
+	Hint   string
+}
+
+// Grant is a GitHub App (or fine-grained token) permission at a minimum
+// level: read, write or admin.
+type Grant struct {
+	Permission string // API key, e.g. "members", "organization_custom_roles"
+	Level      string
+}
+
+func (g Grant) String() string { return g.Permission + ":" + g.Level }
+
+// Requirement is what one enabled feature needs from the credentials. Any
+// one of App grants it, or any one of Scopes for a classic token.
+type Requirement struct {
+	Feature string
+	App     []Grant
+	Scopes  []string
+}
+
+// Requirements lists what cfg needs. Reading org state is always required;
+// the rest follows from the features the config turns on.
+func Requirements(cfg *config.Root) []Requirement {
+	reqs := []Requirement{
+		{Feature: "read teams and members", App: []Grant{{"members", "read"}}, Scopes: []string{"read:org"}},
+		{Feature: "read repositories", App: []Grant{{"metadata", "read"}}, Scopes: []string{"repo"}},
+	}
+	a := cfg.App
+	repoGrants, codeowners := false, false
+	for _, t := range cfg.Team {
+		for _, v := range t.Repositories {
+			repoGrants = true
+			if m, ok := v.(map[string]any); ok && m["codeowners"] != nil {
+				codeowners = true
+			}
+		}
+	}
+	if len(cfg.Team) > 0 || a.DeleteUnconfiguredTeams || a.RemoveExtraTeamMembers {
+		reqs = append(reqs, Requirement{Feature: "manage teams and team members", App: []Grant{{"members", "write"}}, Scopes: []string{"admin:org"}})
+	}
+	if repoGrants {
+		reqs = append(reqs, Requirement{Feature: "grant team access, topics and template flags", App: []Grant{{"administration", "write"}}, Scopes: []string{"repo"}})
+	}
+	if a.CreateRepo {
+		reqs = append(reqs, Requirement{Feature: "create repositories (create_repo)", App: []Grant{{"administration", "write"}}, Scopes: []string{"repo"}})
+	}
+	switch a.RepoCleanupAction() {
+	case config.UnmanagedRepoDelete:
+		setting := "unmanaged_repo_action: delete"
+		if a.UnmanagedRepoAction == "" {
+			setting = "delete_unmanaged_repos"
+		}
+		reqs = append(reqs, Requirement{Feature: "delete repositories (" + setting + ")", App: []Grant{{"administration", "write"}}, Scopes: []string{"delete_repo"}})
+	case config.UnmanagedRepoArchive:
+		reqs = append(reqs, Requirement{Feature: "archive repositories (unmanaged_repo_action: archive)", App: []Grant{{"administration", "write"}}, Scopes: []string{"repo"}})
+	}
+	if a.UnarchiveManagedRepos {
+		reqs = append(reqs, Requirement{Feature: "unarchive repositories (unarchive_managed_repos)", App: []Grant{{"administration", "write"}}, Scopes: []string{"repo"}})
+	}
+	if a.RemoveMembersWithoutTeam {
+		reqs = append(reqs, Requirement{Feature: "remove org members (remove_members_without_team)", App: []Grant{{"members", "write"}}, Scopes: []string{"admin:org"}})
+	}
+	if len(a.Files) > 0 || a.AddRenovateConfig || a.AddDefaultReadme || codeowners {
+		reqs = append(reqs, Requirement{Feature: "write repository files (files, CODEOWNERS)", App: []Grant{{"contents", "write"}}, Scopes: []string{"repo"}})
+	}
+	if UsesCustomRoles(cfg) {
+		level := "write"
+		if len(cfg.Org.CustomRoles) == 0 && !a.DeleteUnmanagedCustomRoles {
+			level = "read" // only warn_unmanaged_custom_roles
+		}
+		reqs = append(reqs, Requirement{
+			Feature: "manage custom repository roles",
+			App:     []Grant{{"organization_custom_roles", level}, {"organization_administration", level}},
+			Scopes:  []string{"admin:org"},
+		})
+	}
+	return reqs
+}
+
+// UsesCustomRoles reports whether cfg reads or writes custom repository
+// roles.
+func UsesCustomRoles(cfg *config.Root) bool {
+	return len(cfg.Org.CustomRoles) > 0 || cfg.App.DeleteUnmanagedCustomRoles || cfg.App.DryWarnings.WarnUnmanagedCustomRoles
+}
+
+// Credentials is what the resolved auth was granted.
+type Credentials struct {
+	App bool
+	// Permissions are the App installation's permissions.
+	Permissions map[string]string
+	// Scopes are a classic token's scopes; ScopesKnown is false for
+	// fine-grained tokens, which do not report them.
+	Scopes      []string
+	ScopesKnown bool
+}
+
+var levels = map[string]int{"read": 1, "write": 2, "admin": 3}
+
+// scopeImplies lists the classic scopes each scope includes.
+var scopeImplies = map[string][]string{
+	"admin:org": {"write:org", "read:org"},
+	"write:org": {"read:org"},
+}
+
+func (c Credentials) hasScope(want string) bool {
+	for _, s := range c.Scopes {
+		if s == want {
+			return true
+		}
+		for _, implied := range scopeImplies[s] {
+			if implied == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c Credentials) hasGrant(g Grant) bool {
+	return levels[c.Permissions[g.Permission]] >= levels[g.Level]
+}
+
+// CheckPermissions compares the credentials against each requirement.
+func CheckPermissions(reqs []Requirement, creds Credentials) []Check {
+	out := make([]Check, 0, len(reqs))
+	for _, r := range reqs {
+		out = append(out, checkRequirement(r, creds))
+	}
+	return out
+}
+
+func checkRequirement(r Requirement, creds Credentials) Check {
+	check := Check{Name: r.Feature}
+	grants := make([]string, len(r.App))
+	for i, g := range r.App {
+		grants[i] = g.String()
+	}
+	switch {
+	case creds.App:
+		for _, g := range r.App {
+			if creds.hasGrant(g) {
+				check.Status, check.Detail = Pass, "app permission "+g.String()
+				return check
+			}
+		}
+		check.Status = Fail
+		check.Detail = "app permission " + strings.Join(grants, " or ") + " missing"
+		check.Hint = fmt.Sprintf("grant the App %s in its settings (Permissions & events), then approve the new permissions on the org installation", strings.Join(grants, " or "))
+	case creds.ScopesKnown:
+		for _, s := range r.Scopes {
+			if creds.hasScope(s) {
+				check.Status, check.Detail = Pass, "token scope "+s
+				return check
+			}
+		}
+		check.Status = Fail
+		check.Detail = "token scope " + strings.Join(r.Scopes, " or ") + " missing"
+		check.Hint = "regenerate the token with the " + strings.Join(r.Scopes, " or ") + " scope"
+	default:
+		check.Status = Warn
+		check.Detail = "token does not report its permissions (fine-grained token?)"
+		check.Hint = "make sure the token grants " + strings.Join(grants, " or ")
+	}
+	return check
+}
+
+// Run performs every check: auth, org access, the permissions cfg needs,
+// custom role availability and the remaining rate limit. authSource is the
+// label NewClientFromEnv returned.
+func Run(ctx context.Context, c *gh.Client, cfg *config.Root, authSource string) []Check {
+	checks := []Check{{
+		Name:   "authentication",
+		Status: Pass,
+		Detail: fmt.Sprintf("%s as %s on %s", authSource, c.Identity(ctx), c.Endpoints.Server()),
+	}}
+	for _, s := range c.AuthSkipped() {
+		checks = append(checks, Check{Name: "credential source", Status: Skip, Detail: s})
+	}
+
+	if _, _, err := c.REST.Organizations.Get(ctx, cfg.App.Org); err != nil {
+		checks = append(checks, Check{
+			Name: "org access", Status: Fail, Detail: err.Error(),
+			Hint: fmt.Sprintf("check app.org %q and that the token's user or the App installation belongs to it", cfg.App.Org),
+		})
+	} else {
+		checks = append(checks, Check{Name: "org access", Status: Pass, Detail: cfg.App.Org})
+	}
+
+	creds := Credentials{App: c.IsApp(), Permissions: c.InstallationPermissions()}
+	if !creds.App {
+		scopes, known, err := c.TokenScopes(ctx)
+		if err != nil {
+			checks = append(checks, Check{Name: "token scopes", Status: Warn, Detail: err.Error()})
+		}
+		creds.Scopes, creds.ScopesKnown = scopes, known
+	}
+	checks = append(checks, CheckPermissions(Requirements(cfg), creds)...)
+
+	if UsesCustomRoles(cfg) {
+		checks = append(checks, checkCustomRoles(ctx, c, cfg.App.Org))
+	}
+	checks = append(checks, checkRateLimit(ctx, c))
+	return checks
+}
+
+// checkCustomRoles probes the custom roles API, which only exists on
+// Enterprise plans and recent GitHub Enterprise Server releases.
+func checkCustomRoles(ctx context.Context, c *gh.Client, org string) Check {
+	check := Check{Name: "custom roles available"}
+	roles, _, err := c.REST.Organizations.ListCustomRepoRoles(ctx, org)
+	if err != nil {
+		check.Status, check.Detail = Fail, err.Error()
+		check.Hint = "custom repository roles need GitHub Enterprise Cloud (or a GHES release that has them); remove org.custom_roles otherwise"
+		return check
+	}
+	check.Status = Pass
+	check.Detail = fmt.Sprintf("%d role(s) defined", roles.GetTotalCount())
+	return check
+}
+
+// rateLimitFloor is the remaining core quota below which doctor warns: a
+// sync would start by sleeping until the reset.
+const rateLimitFloor = 100
+
+func checkRateLimit(ctx context.Context, c *gh.Client) Check {
+	check := Check{Name: "rate limit"}
+	limits, _, err := c.REST.RateLimit.Get(ctx)
+	if err != nil {
+		check.Status, check.Detail = Warn, err.Error()
+		return check
+	}
+	core := limits.GetCore()
+	if core == nil {
+		check.Status, check.Detail = Pass, "not enforced by this server"
+		return check
+	}
+	check.Detail = fmt.Sprintf("%d/%d remaining, resets %s", core.Remaining, core.Limit, core.Reset.Format("15:04 MST"))
+	check.Status = Pass
+	if core.Remaining < rateLimitFloor {
+		check.Status = Warn
+		check.Hint = "wait for the reset before running sync"
+	}
+	return check
+}
+
+// Failed counts the FAIL checks.
+func Failed(checks []Check) int {
+	n := 0
+	for _, c := range checks {
+		if c.Status == Fail {
+			n++
+		}
+	}
+	return n
+}
+
+// Print writes checks as an aligned table, each WARN or FAIL followed by
+// its hint.
+func Print(w io.Writer, checks []Check) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHECK\tSTATUS\tDETAIL")
+	for _, c := range checks {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", c.Name, c.Status, c.Detail)
+		if c.Hint != "" && c.Status != Pass {
+			fmt.Fprintf(tw, "\t\t→ %s\n", c.Hint)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	counts := map[string]int{}
+	for _, c := range checks {
+		counts[c.Status]++
+	}
+	var parts []string
+	for _, s := range []string{Pass, Skip, Warn, Fail} {
+		if counts[s] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[s], strings.ToLower(s)))
+		}
+	}
+	_, err := fmt.Fprintf(w, "\n%s\n", strings.Join(parts, ", "))
+	return err
+}
@@ -0,0 +1,168 @@
+package doctor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v88/github"
+
+	"github.com/DragonSecurity/gomgr/internal/config"
+	"github.com/DragonSecurity/gomgr/internal/gh"
+)
+
+func features(reqs []Requirement) map[string]Requirement {
+	out := map[string]Requirement{}
+	for _, r := range reqs {
+		out[r.Feature] = r
+	}
+	return out
+}
+
+func TestRequirements(t *testing.T) {
+	base := features(Requirements(&config.Root{}))
+	if len(base) != 2 {
+		t.Errorf("an empty config should only need read access, got %v", base)
+	}
+
+	cfg := &config.Root{
+		App: config.AppConfig{
+			CreateRepo:               true,
+			DeleteUnmanagedRepos:     true,
+			RemoveMembersWithoutTeam: true,
+		},
+		Org: config.OrgConfig{CustomRoles: []config.CustomRoleConfig{{Name: "deployer", BaseRole: "read"}}},
+		Team: []config.TeamConfig{{
+			Name: "Web",
+			Repositories: map[string]any{
+				"site": map[string]any{"permission": "push", "codeowners": []any{"*"}},
+			},
+		}},
+	}
+	got := features(Requirements(cfg))
+	for _, want := range []string{
+		"manage teams and team members",
+		"grant team access, topics and template flags",
+		"create repositories (create_repo)",
+		"delete repositories (delete_unmanaged_repos)",
+		"remove org members (remove_members_without_team)",
+		"write repository files (files, CODEOWNERS)",
+		"manage custom repository roles",
+	} {
+		if _, ok := got[want]; !ok {
+			t.Errorf("missing requirement %q", want)
+		}
+	}
+	if s := got["delete repositories (delete_unmanaged_repos)"].Scopes; len(s) != 1 || s[0] != "delete_repo" {
+		t.Errorf("deleting repos should need delete_repo, got %v", s)
+	}
+
+	warnOnly := &config.Root{}
+	warnOnly.App.DryWarnings.WarnUnmanagedCustomRoles = true
+	if g := features(Requirements(warnOnly))["manage custom repository roles"].App[0]; g.Level != "read" {
+		t.Errorf("warn-only custom roles should need read, got %v", g)
+	}
+
+	archive := &config.Root{App: config.AppConfig{UnmanagedRepoAction: config.UnmanagedRepoArchive}}
+	if r, ok := features(Requirements(archive))["archive repositories (unmanaged_repo_action: archive)"]; !ok || r.Scopes[0] != "repo" {
+		t.Errorf("archiving repos should need administration write and repo, got %v", r)
+	}
+}
+
+func TestCheckPermissions(t *testing.T) {
+	req := Requirement{
+		Feature: "manage custom repository roles",
+		App:     []Grant{{"organization_custom_roles", "write"}, {"organization_administration", "write"}},
+		Scopes:  []string{"write:org"},
+	}
+	tests := []struct {
+		name  string
+		creds Credentials
+		want  string
+	}{
+		{"app grant", Credentials{App: true, Permissions: map[string]string{"organization_custom_roles": "write"}}, Pass},
+		{"app alternative grant", Credentials{App: true, Permissions: map[string]string{"organization_administration": "admin"}}, Pass},
+		{"app read only", Credentials{App: true, Permissions: map[string]string{"organization_custom_roles": "read"}}, Fail},
+		{"app missing", Credentials{App: true}, Fail},
+		{"implied scope", Credentials{Scopes: []string{"repo", "admin:org"}, ScopesKnown: true}, Pass},
+		{"missing scope", Credentials{Scopes: []string{"read:org"}, ScopesKnown: true}, Fail},
+		{"fine-grained token", Credentials{}, Warn},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CheckPermissions([]Requirement{req}, tt.creds)[0]
+			if got.Status != tt.want {
+				t.Errorf("status = %s, want %s (%s)", got.Status, tt.want, got.Detail)
+			}
+			if got.Status != Pass && got.Hint == "" {
+				t.Error("non-passing checks need a remediation hint")
+			}
+		})
+	}
+}
+
+func TestRun_ClassicToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/user":
+			w.Header().Set("X-OAuth-Scopes", "repo, read:org")
+			_ = json.NewEncoder(w).Encode(map[string]any{"login": "octocat"})
+		case "/orgs/myorg":
+			_ = json.NewEncoder(w).Encode(map[string]any{"login": "myorg"})
+		case "/rate_limit":
+			_ = json.NewEncoder(w).Encode(map[string]any{"resources": map[string]any{
+				"core": map[string]any{"limit": 5000, "remaining": 42, "reset": 1700000000},
+			}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	url := server.URL + "/"
+	rest, err := github.NewClient(github.WithURLs(&url, &url))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Root{
+		App:  config.AppConfig{Org: "myorg"},
+		Team: []config.TeamConfig{{Name: "Web"}},
+	}
+	checks := Run(context.Background(), &gh.Client{REST: rest}, cfg, "PAT")
+
+	status := map[string]string{}
+	for _, c := range checks {
+		status[c.Name] = c.Status
+	}
+	want := map[string]string{
+		"authentication":                Pass,
+		"org access":                    Pass,
+		"read teams and members":        Pass,
+		"read repositories":             Pass,
+		"manage teams and team members": Fail, // needs admin:org
+		"rate limit":                    Warn,
+	}
+	for name, s := range want {
+		if status[name] != s {
+			t.Errorf("%s = %q, want %q", name, status[name], s)
+		}
+	}
+	if Failed(checks) != 1 {
+		t.Errorf("Failed = %d, want 1", Failed(checks))
+	}
+
+	var buf bytes.Buffer
+	if err := Print(&buf, checks); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{"CHECK", "manage teams and team members", "→ regenerate the token with the admin:org scope", "1 fail"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
@@ -5,12 +5,10 @@ import (
 	"context"
 	"encoding/json"
 	"encoding/pem"
-	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
-	"strconv"
 	"strings"
 	"time"
 
@@ -19,6 +17,7 @@ import (
 	"golang.org/x/oauth2"
 
 	"github.com/DragonSecurity/gomgr/internal/config"
+	"github.com/DragonSecurity/gomgr/internal/util"
 )
 
 type Client struct {
@@ -27,75 +26,205 @@ type Client struct {
 	// GraphQLURL is the endpoint used by DoGraphQL. Empty means GitHub's public
 	// GraphQL API. Tests may override it to point at a local server.
 	GraphQLURL string
+	// Endpoints are the API URLs the client was built for (zero for
+	// github.com).
+	Endpoints Endpoints
+
+	// appID and installationID are set when authenticated as a GitHub App.
+	appID          int64
+	installationID int64
+	// installationPerms are the permissions granted to the installation,
+	// keyed like the API's permissions object ("members": "write").
+	installationPerms map[string]string
+	// authSkipped lists the credential sources skipped before the one used.
+	authSkipped []string
+
+	stats *APIStats
 }
 
 const defaultMaxRetries = 3
 const defaultGraphQLURL = "https://api.github.com/graphql"
 
+// NewClientFromEnv resolves credentials through DefaultChain and builds a
+// client for app's GitHub endpoints. The returned label names the source
+// that won; the sources skipped before it are logged at debug level and kept
+// on the client (see AuthSkipped).
 func NewClientFromEnv(ctx context.Context, app config.AppConfig) (*Client, string, error) {
-	// PAT
-	if tok := os.Getenv("GITHUB_TOKEN"); tok != "" {
-		ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: tok})
+	endpoints, err := ResolveEndpoints(app)
+	if err != nil {
+		return nil, "", err
+	}
+	cred, skipped, err := ResolveCredential(ctx, DefaultChain, app, endpoints)
+	for _, s := range skipped {
+		util.Debugf("auth: skipped %s", s)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	c, err := newClient(ctx, cred, app.Org, endpoints)
+	if err != nil {
+		return nil, "", err
+	}
+	c.authSkipped = skipped
+	return c, cred.Source, nil
+}
+
+// newClient builds a client authenticated with cred.
+func newClient(ctx context.Context, cred *Credential, org string, endpoints Endpoints) (*Client, error) {
+	stats := newAPIStats()
+	if cred.Token != "" {
+		ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: cred.Token})
 		tc := oauth2.NewClient(ctx, ts)
-		tc.Transport = newRetryTransport(tc.Transport, defaultMaxRetries)
-		rest, err := github.NewClient(github.WithHTTPClient(tc))
+		tc.Transport = newRetryTransport(&statsTransport{base: tc.Transport, stats: stats}, defaultMaxRetries)
+		rest, err := newREST(tc, endpoints)
 		if err != nil {
-			return nil, "", fmt.Errorf("new github client: %w", err)
+			return nil, err
 		}
-		return &Client{REST: rest, httpClient: tc}, "PAT", nil
+		return &Client{REST: rest, httpClient: tc, stats: stats, Endpoints: endpoints, GraphQLURL: endpoints.GraphQLURL}, nil
 	}
-	// App
-	appID := app.AppID
-	if v := os.Getenv("GITHUB_APP_ID"); v != "" && appID == 0 {
-		if id, err := strconv.ParseInt(v, 10, 64); err == nil {
-			appID = id
-		}
+
+	atr, err := ghinstallation.NewAppsTransport(http.DefaultTransport, cred.AppID, cred.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("app transport: %w", err)
 	}
-	key := firstNonEmpty(app.PrivateKey, os.Getenv("GITHUB_APP_PRIVATE_KEY"))
-	if appID == 0 || key == "" {
-		return nil, "", errors.New("no auth found: set GITHUB_TOKEN or app_id+private_key")
+	if endpoints.BaseURL != "" {
+		// Installation tokens are minted against the same API; the
+		// installation transport below inherits this base URL.
+		atr.BaseURL = endpoints.appsBaseURL()
 	}
-	pemBytes, err := maybeReadPEM(key)
+	tmp, err := newREST(&http.Client{Transport: atr}, endpoints)
 	if err != nil {
-		return nil, "", err
+		return nil, err
+	}
+	var inst *github.Installation
+	if cred.InstallationID != 0 {
+		inst, _, err = tmp.Apps.GetInstallation(ctx, cred.InstallationID)
+		if err != nil {
+			return nil, fmt.Errorf("get installation %d: %w", cred.InstallationID, err)
+		}
+	} else {
+		inst, _, err = tmp.Apps.GetOrganizationInstallation(ctx, org)
+		if err != nil {
+			return nil, fmt.Errorf("find installation for org %q: %w", org, err)
+		}
 	}
-	atr, err := ghinstallation.NewAppsTransport(http.DefaultTransport, appID, pemBytes)
+	itr := ghinstallation.NewFromAppsTransport(atr, inst.GetID())
+	httpClient := &http.Client{Transport: newRetryTransport(&statsTransport{base: itr, stats: stats}, defaultMaxRetries), Timeout: 30 * time.Second}
+	rest, err := newREST(httpClient, endpoints)
 	if err != nil {
-		return nil, "", fmt.Errorf("app transport: %w", err)
+		return nil, err
+	}
+	return &Client{
+		REST:              rest,
+		httpClient:        httpClient,
+		appID:             cred.AppID,
+		installationID:    inst.GetID(),
+		installationPerms: permissionMap(inst.GetPermissions()),
+		stats:             stats,
+		Endpoints:         endpoints,
+		GraphQLURL:        endpoints.GraphQLURL,
+	}, nil
+}
+
+// permissionMap flattens the installation permissions to name → level.
+func permissionMap(p *github.InstallationPermissions) map[string]string {
+	out := map[string]string{}
+	if p == nil {
+		return out
 	}
-	tmp, err := github.NewClient(github.WithHTTPClient(&http.Client{Transport: atr}))
+	b, err := json.Marshal(p)
 	if err != nil {
-		return nil, "", fmt.Errorf("new github client: %w", err)
+		return out
 	}
-	inst, _, err := tmp.Apps.GetOrganizationInstallation(ctx, app.Org)
+	_ = json.Unmarshal(b, &out)
+	return out
+}
+
+// AuthSkipped returns a "source: reason" line for every credential source
+// skipped before the one the client uses.
+func (c *Client) AuthSkipped() []string { return c.authSkipped }
+
+// IsApp reports whether c authenticates as a GitHub App installation.
+func (c *Client) IsApp() bool { return c.appID != 0 }
+
+// InstallationPermissions returns the permissions granted to the App
+// installation ("members": "write", …), or nil for token clients.
+func (c *Client) InstallationPermissions() map[string]string {
+	return c.installationPerms
+}
+
+// TokenScopes returns the OAuth scopes of a classic personal access token,
+// read from the X-OAuth-Scopes header of one API call. known is false when
+// GitHub does not report scopes, as for fine-grained tokens and App
+// installations.
+func (c *Client) TokenScopes(ctx context.Context) (scopes []string, known bool, err error) {
+	_, resp, err := c.REST.Users.Get(ctx, "")
 	if err != nil {
-		return nil, "", fmt.Errorf("find installation for org %q: %w", app.Org, err)
+		return nil, false, fmt.Errorf("get authenticated user: %w", err)
 	}
-	itr := ghinstallation.NewFromAppsTransport(atr, inst.GetID())
-	httpClient := &http.Client{Transport: newRetryTransport(itr, defaultMaxRetries), Timeout: 30 * time.Second}
-	rest, err := github.NewClient(github.WithHTTPClient(httpClient))
+	raw, ok := resp.Header["X-Oauth-Scopes"]
+	if !ok {
+		return nil, false, nil
+	}
+	for _, s := range strings.Split(strings.Join(raw, ","), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes, true, nil
+}
+
+// newREST builds a REST client over httpClient, pointed at e's URLs when
+// they are set.
+func newREST(httpClient *http.Client, e Endpoints) (*github.Client, error) {
+	opts := []github.ClientOptionsFunc{github.WithHTTPClient(httpClient)}
+	if e.BaseURL != "" {
+		opts = append(opts, github.WithEnterpriseURLs(e.BaseURL, e.UploadURL))
+	}
+	rest, err := github.NewClient(opts...)
 	if err != nil {
-		return nil, "", fmt.Errorf("new github client: %w", err)
+		return nil, fmt.Errorf("new github client: %w", err)
+	}
+	return rest, nil
+}
+
+// Stats returns the client's API request counters. It is nil for clients not
+// built by NewClientFromEnv; APIStats methods accept a nil receiver.
+func (c *Client) Stats() *APIStats {
+	if c == nil {
+		return nil
 	}
-	return &Client{REST: rest, httpClient: httpClient}, "Github App", nil
+	return c.stats
+}
+
+// Identity describes who the client acts as, for audit records: "app:<id>
+// installation:<id>" for a GitHub App, "user:<login>" for a token (one API
+// call), or "token" when the login cannot be resolved.
+func (c *Client) Identity(ctx context.Context) string {
+	if c.appID != 0 {
+		return fmt.Sprintf("app:%d installation:%d", c.appID, c.installationID)
+	}
+	u, _, err := c.REST.Users.Get(ctx, "")
+	if err != nil || u.GetLogin() == "" {
+		return "token"
+	}
+	return "user:" + u.GetLogin()
 }
 
 func maybeReadPEM(s string) ([]byte, error) {
-	var (
-		data   []byte
-		source string
-	)
 	if strings.Contains(s, "BEGIN") {
-		data = []byte(s)
-		source = "inline key"
-	} else {
-		b, err := os.ReadFile(s)
-		if err != nil {
-			return nil, err
-		}
-		data = b
-		source = s
+		return checkPEM([]byte(s), "inline key")
 	}
+	b, err := os.ReadFile(s)
+	if err != nil {
+		return nil, err
+	}
+	return checkPEM(b, s)
+}
+
+// checkPEM verifies that data holds a PEM private key; source names it in
+// errors.
+func checkPEM(data []byte, source string) ([]byte, error) {
 	block, _ := pem.Decode(data)
 	if block == nil {
 		return nil, fmt.Errorf("invalid PEM at %s", source)
@@ -10,6 +10,8 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/google/go-github/v88/github"
 )
 
 func TestMaybeReadPEM_InlineKey(t *testing.T) {
@@ -245,3 +247,36 @@ func TestFirstNonEmpty(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenScopes(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		header    string
+		set       bool
+		want      []string
+		wantKnown bool
+	}{
+		{"classic token", "repo, admin:org", true, []string{"repo", "admin:org"}, true},
+		{"classic token without scopes", "", true, nil, true},
+		{"fine-grained token", "", false, nil, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				if tt.set {
+					w.Header().Set("X-OAuth-Scopes", tt.header)
+				}
+				_, _ = w.Write([]byte(`{"login":"octocat"}`))
+			}))
+			defer srv.Close()
+			url := srv.URL + "/"
+			rest, _ := github.NewClient(github.WithURLs(&url, &url))
+			scopes, known, err := (&Client{REST: rest}).TokenScopes(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if known != tt.wantKnown || strings.Join(scopes, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("TokenScopes = %v, %v; want %v, %v", scopes, known, tt.want, tt.wantKnown)
+			}
+		})
+	}
+}
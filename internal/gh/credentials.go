@@ -0,0 +1,252 @@
+package gh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/DragonSecurity/gomgr/internal/config"
+)
+
+// Credential is what a CredentialSource resolved: either a token or GitHub
+// App credentials.
+type Credential struct {
+	Token string
+
+	AppID      int64
+	PrivateKey []byte
+	// InstallationID skips the org installation lookup when set.
+	InstallationID int64
+
+	// Source describes where the credential came from, for logs.
+	Source string
+}
+
+// CredentialSource is one link of the credential chain. Resolve returns a
+// SkipError when the source is not configured; any other error stops the
+// chain, because a source that is configured but broken should not silently
+// fall through to a different identity.
+type CredentialSource interface {
+	Name() string
+	Resolve(ctx context.Context, app config.AppConfig, e Endpoints) (*Credential, error)
+}
+
+// SkipError is returned by a CredentialSource that does not apply.
+type SkipError struct{ Reason string }
+
+func (e *SkipError) Error() string { return e.Reason }
+
+func skip(format string, args ...any) error {
+	return &SkipError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// DefaultChain is the order NewClientFromEnv tries credential sources in:
+// explicit tokens first, then the App configured in app.yaml, and the gh
+// CLI's stored login last as a convenience for local runs.
+var DefaultChain = []CredentialSource{
+	envToken{},
+	tokenFile{},
+	appCredentials{},
+	ghCLI{},
+}
+
+// ResolveCredential walks chain and returns the first credential found,
+// plus a "name: reason" line for every source skipped before it.
+func ResolveCredential(ctx context.Context, chain []CredentialSource, app config.AppConfig, e Endpoints) (*Credential, []string, error) {
+	var skipped []string
+	for _, src := range chain {
+		cred, err := src.Resolve(ctx, app, e)
+		var skipErr *SkipError
+		switch {
+		case errors.As(err, &skipErr):
+			skipped = append(skipped, src.Name()+": "+skipErr.Reason)
+		case err != nil:
+			return nil, skipped, fmt.Errorf("auth %s: %w", src.Name(), err)
+		default:
+			return cred, skipped, nil
+		}
+	}
+	return nil, skipped, fmt.Errorf("no auth found; set GITHUB_TOKEN or app_id+private_key:\n  %s", strings.Join(skipped, "\n  "))
+}
+
+// envToken reads GITHUB_TOKEN.
+type envToken struct{}
+
+func (envToken) Name() string { return "GITHUB_TOKEN" }
+
+func (envToken) Resolve(context.Context, config.AppConfig, Endpoints) (*Credential, error) {
+	tok := os.Getenv("GITHUB_TOKEN")
+	if tok == "" {
+		return nil, skip("not set")
+	}
+	return &Credential{Token: tok, Source: "PAT from GITHUB_TOKEN"}, nil
+}
+
+// tokenFile reads the token from the file GITHUB_TOKEN_FILE names, as
+// mounted by Docker and Kubernetes secrets.
+type tokenFile struct{}
+
+func (tokenFile) Name() string { return "GITHUB_TOKEN_FILE" }
+
+func (tokenFile) Resolve(context.Context, config.AppConfig, Endpoints) (*Credential, error) {
+	path := os.Getenv("GITHUB_TOKEN_FILE")
+	if path == "" {
+		return nil, skip("not set")
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tok := strings.TrimSpace(string(b))
+	if tok == "" {
+		return nil, fmt.Errorf("%s is empty", path)
+	}
+	return &Credential{Token: tok, Source: "PAT from GITHUB_TOKEN_FILE " + path}, nil
+}
+
+// appCredentials builds GitHub App credentials from app.yaml and the
+// GITHUB_APP_* environment variables.
+type appCredentials struct{}
+
+func (appCredentials) Name() string { return "GitHub App" }
+
+func (appCredentials) Resolve(ctx context.Context, app config.AppConfig, _ Endpoints) (*Credential, error) {
+	appID := app.AppID
+	if v := os.Getenv("GITHUB_APP_ID"); v != "" && appID == 0 {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("GITHUB_APP_ID %q: %w", v, err)
+		}
+		appID = id
+	}
+	key := firstNonEmpty(app.PrivateKey, os.Getenv("GITHUB_APP_PRIVATE_KEY"))
+	if appID == 0 && key == "" && app.PrivateKeyCommand == "" {
+		return nil, skip("app_id and private_key not set")
+	}
+	if appID == 0 {
+		return nil, errors.New("a private key is configured but app_id (GITHUB_APP_ID) is not")
+	}
+
+	var (
+		pemBytes []byte
+		keyFrom  string
+		err      error
+	)
+	switch {
+	case key != "":
+		pemBytes, err = maybeReadPEM(key)
+		keyFrom = "private_key"
+	case app.PrivateKeyCommand != "":
+		pemBytes, err = runKeyCommand(ctx, app.PrivateKeyCommand)
+		keyFrom = "private_key_command"
+	default:
+		return nil, errors.New("app_id is set but no private key (private_key, private_key_command or GITHUB_APP_PRIVATE_KEY)")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	instID := app.InstallationID
+	if v := os.Getenv("GITHUB_APP_INSTALLATION_ID"); v != "" && instID == 0 {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("GITHUB_APP_INSTALLATION_ID %q: %w", v, err)
+		}
+		instID = id
+	}
+	source := fmt.Sprintf("GitHub App %d (key from %s", appID, keyFrom)
+	if instID != 0 {
+		source += fmt.Sprintf(", installation %d", instID)
+	}
+	return &Credential{AppID: appID, PrivateKey: pemBytes, InstallationID: instID, Source: source + ")"}, nil
+}
+
+// keyCommandTimeout bounds private_key_command.
+const keyCommandTimeout = 30 * time.Second
+
+// runKeyCommand runs command through the platform shell and returns its
+// standard output, which must be a PEM private key. It lets the key come
+// from a secret manager CLI (vault, op, aws secretsmanager, …) instead of a
+// file on disk.
+func runKeyCommand(ctx context.Context, command string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, keyCommandTimeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command) //nolint:gosec // operator-configured command
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command) //nolint:gosec // operator-configured command
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("private_key_command: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return checkPEM(out, "private_key_command output")
+}
+
+// ghCLI reads the token the gh CLI stored for the API host in hosts.yml.
+// Recent gh versions keep tokens in the system keyring instead, which this
+// source cannot read.
+type ghCLI struct{}
+
+func (ghCLI) Name() string { return "gh CLI" }
+
+func (ghCLI) Resolve(_ context.Context, _ config.AppConfig, e Endpoints) (*Credential, error) {
+	path := filepath.Join(ghConfigDir(), "hosts.yml")
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, skip("no %s", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var hosts map[string]struct {
+		User       string `yaml:"user"`
+		OAuthToken string `yaml:"oauth_token"`
+	}
+	if err := yaml.Unmarshal(b, &hosts); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	host := e.Server()
+	h, ok := hosts[host]
+	if !ok {
+		return nil, skip("not logged in to %s", host)
+	}
+	if h.OAuthToken == "" {
+		return nil, skip("the %s token is in the system keyring; export GITHUB_TOKEN=$(gh auth token) instead", host)
+	}
+	source := "gh CLI token for " + host
+	if h.User != "" {
+		source += " (" + h.User + ")"
+	}
+	return &Credential{Token: h.OAuthToken, Source: source}, nil
+}
+
+// ghConfigDir mirrors gh's own lookup: GH_CONFIG_DIR, then
+// $XDG_CONFIG_HOME/gh, then %AppData%\GitHub CLI on Windows, then
+// ~/.config/gh.
+func ghConfigDir() string {
+	if d := os.Getenv("GH_CONFIG_DIR"); d != "" {
+		return d
+	}
+	if d := os.Getenv("XDG_CONFIG_HOME"); d != "" {
+		return filepath.Join(d, "gh")
+	}
+	if d := os.Getenv("AppData"); runtime.GOOS == "windows" && d != "" {
+		return filepath.Join(d, "GitHub CLI")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".config", "gh")
+}
@@ -0,0 +1,166 @@
+package gh
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/DragonSecurity/gomgr/internal/config"
+)
+
+// clearAuthEnv unsets every variable the default chain reads.
+func clearAuthEnv(t *testing.T) {
+	t.Helper()
+	for _, k := range []string{
+		"GITHUB_TOKEN", "GITHUB_TOKEN_FILE", "GITHUB_APP_ID", "GITHUB_APP_PRIVATE_KEY",
+		"GITHUB_APP_INSTALLATION_ID", "XDG_CONFIG_HOME",
+	} {
+		t.Setenv(k, "")
+	}
+	t.Setenv("GH_CONFIG_DIR", t.TempDir())
+}
+
+type fakeSource struct {
+	name string
+	cred *Credential
+	err  error
+}
+
+func (f fakeSource) Name() string { return f.name }
+func (f fakeSource) Resolve(context.Context, config.AppConfig, Endpoints) (*Credential, error) {
+	return f.cred, f.err
+}
+
+func TestResolveCredential(t *testing.T) {
+	chain := []CredentialSource{
+		fakeSource{name: "first", err: skip("not set")},
+		fakeSource{name: "second", cred: &Credential{Token: "t", Source: "second"}},
+		fakeSource{name: "third", cred: &Credential{Token: "never"}},
+	}
+	cred, skipped, err := ResolveCredential(context.Background(), chain, config.AppConfig{}, Endpoints{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cred.Source != "second" || len(skipped) != 1 || skipped[0] != "first: not set" {
+		t.Errorf("got %+v, skipped %v", cred, skipped)
+	}
+
+	broken := []CredentialSource{fakeSource{name: "file", err: errors.New("permission denied")}, chain[1]}
+	if _, _, err := ResolveCredential(context.Background(), broken, config.AppConfig{}, Endpoints{}); err == nil ||
+		!strings.Contains(err.Error(), "auth file: permission denied") {
+		t.Errorf("a broken source should stop the chain, got %v", err)
+	}
+
+	_, _, err = ResolveCredential(context.Background(), chain[:1], config.AppConfig{}, Endpoints{})
+	if err == nil || !strings.Contains(err.Error(), "first: not set") {
+		t.Errorf("exhausted chain error should list skip reasons, got %v", err)
+	}
+}
+
+func TestTokenFile(t *testing.T) {
+	clearAuthEnv(t)
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("ghp_file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GITHUB_TOKEN_FILE", path)
+	cred, _, err := ResolveCredential(context.Background(), DefaultChain, config.AppConfig{}, Endpoints{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cred.Token != "ghp_file" || !strings.Contains(cred.Source, path) {
+		t.Errorf("got %+v", cred)
+	}
+
+	t.Setenv("GITHUB_TOKEN_FILE", filepath.Join(t.TempDir(), "missing"))
+	if _, _, err := ResolveCredential(context.Background(), DefaultChain, config.AppConfig{}, Endpoints{}); err == nil {
+		t.Error("an unreadable GITHUB_TOKEN_FILE should be an error, not a skip")
+	}
+}
+
+func TestGHCLI(t *testing.T) {
+	clearAuthEnv(t)
+	dir := os.Getenv("GH_CONFIG_DIR")
+	hosts := `github.com:
+    user: octocat
+    oauth_token: gho_cli
+ghe.example.com:
+    user: octocat
+`
+	if err := os.WriteFile(filepath.Join(dir, "hosts.yml"), []byte(hosts), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cred, skipped, err := ResolveCredential(context.Background(), DefaultChain, config.AppConfig{}, Endpoints{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cred.Token != "gho_cli" || cred.Source != "gh CLI token for github.com (octocat)" {
+		t.Errorf("got %+v", cred)
+	}
+	if len(skipped) != 3 {
+		t.Errorf("expected the three earlier sources to be skipped, got %v", skipped)
+	}
+
+	ghes := Endpoints{BaseURL: "https://ghe.example.com/api/v3/"}
+	_, skipped, err = ResolveCredential(context.Background(), DefaultChain, config.AppConfig{}, ghes)
+	if err == nil || !strings.Contains(skipped[len(skipped)-1], "system keyring") {
+		t.Errorf("a keyring-only login should be skipped with a hint, got %v / %v", skipped, err)
+	}
+}
+
+func testKeyPEM(t *testing.T) []byte {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+func TestAppCredentials(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	clearAuthEnv(t)
+	keyFile := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(keyFile, testKeyPEM(t), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GITHUB_APP_INSTALLATION_ID", "99")
+
+	cred, _, err := ResolveCredential(context.Background(), DefaultChain,
+		config.AppConfig{AppID: 12, PrivateKeyCommand: "cat " + keyFile}, Endpoints{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cred.AppID != 12 || cred.InstallationID != 99 || len(cred.PrivateKey) == 0 {
+		t.Errorf("got %+v", cred)
+	}
+	if want := "GitHub App 12 (key from private_key_command, installation 99)"; cred.Source != want {
+		t.Errorf("Source = %q, want %q", cred.Source, want)
+	}
+
+	_, _, err = ResolveCredential(context.Background(), DefaultChain,
+		config.AppConfig{AppID: 12, PrivateKeyCommand: "echo not-a-key"}, Endpoints{})
+	if err == nil || !strings.Contains(err.Error(), "invalid PEM at private_key_command output") {
+		t.Errorf("expected a PEM error, got %v", err)
+	}
+	_, _, err = ResolveCredential(context.Background(), DefaultChain,
+		config.AppConfig{AppID: 12, PrivateKeyCommand: "exit 3"}, Endpoints{})
+	if err == nil || !strings.Contains(err.Error(), "private_key_command") {
+		t.Errorf("expected a command error, got %v", err)
+	}
+	_, _, err = ResolveCredential(context.Background(), DefaultChain, config.AppConfig{AppID: 12}, Endpoints{})
+	if err == nil || !strings.Contains(err.Error(), "no private key") {
+		t.Errorf("app_id without a key should be an error, got %v", err)
+	}
+}
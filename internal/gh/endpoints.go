@@ -0,0 +1,139 @@
+package gh
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/DragonSecurity/gomgr/internal/config"
+)
+
+// Endpoints are the API URLs a client talks to. The zero value means
+// github.com.
+type Endpoints struct {
+	BaseURL    string // REST API root, e.g. https://ghe.example.com/api/v3/
+	UploadURL  string // upload API root, e.g. https://ghe.example.com/api/uploads/
+	GraphQLURL string // e.g. https://ghe.example.com/api/graphql
+}
+
+// ResolveEndpoints picks the API URLs from GOMGR_BASE_URL, GOMGR_UPLOAD_URL
+// and GOMGR_GRAPHQL_URL, falling back to app.base_url, app.upload_url and
+// app.graphql_url. With only a base URL, the other two are derived the way
+// GitHub Enterprise Server lays them out: a base of https://HOST (or
+// https://HOST/api/v3) gives https://HOST/api/uploads/ and
+// https://HOST/api/graphql. Hosts starting with "api." (GHE.com) keep their
+// base path and get /graphql.
+func ResolveEndpoints(app config.AppConfig) (Endpoints, error) {
+	e := Endpoints{
+		BaseURL:    firstNonEmpty(os.Getenv("GOMGR_BASE_URL"), app.BaseURL),
+		UploadURL:  firstNonEmpty(os.Getenv("GOMGR_UPLOAD_URL"), app.UploadURL),
+		GraphQLURL: firstNonEmpty(os.Getenv("GOMGR_GRAPHQL_URL"), app.GraphQLURL),
+	}
+	if e.BaseURL == "" {
+		if e.UploadURL != "" || e.GraphQLURL != "" {
+			return Endpoints{}, fmt.Errorf("upload_url and graphql_url need base_url to be set as well")
+		}
+		return e, nil
+	}
+
+	base, err := parseAPIURL("base_url", e.BaseURL)
+	if err != nil {
+		return Endpoints{}, err
+	}
+	apiHost := strings.HasPrefix(base.Host, "api.")
+	if !apiHost && !strings.HasSuffix(base.Path, "/api/v3/") {
+		base.Path += "api/v3/"
+	}
+	e.BaseURL = base.String()
+
+	if e.UploadURL == "" {
+		up := *base
+		if !apiHost {
+			up.Path = strings.TrimSuffix(up.Path, "v3/") + "uploads/"
+		}
+		e.UploadURL = up.String()
+	} else if _, err := parseAPIURL("upload_url", e.UploadURL); err != nil {
+		return Endpoints{}, err
+	}
+
+	if e.GraphQLURL == "" {
+		gql := *base
+		if apiHost {
+			gql.Path += "graphql"
+		} else {
+			gql.Path = strings.TrimSuffix(gql.Path, "v3/") + "graphql"
+		}
+		e.GraphQLURL = gql.String()
+	} else if _, err := parseAPIURL("graphql_url", e.GraphQLURL); err != nil {
+		return Endpoints{}, err
+	}
+	return e, nil
+}
+
+// parseAPIURL parses an absolute http(s) URL and gives it a trailing slash.
+func parseAPIURL(field, raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("%s %q must be an absolute http(s) URL", field, raw)
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	return u, nil
+}
+
+// IsGHES reports whether the endpoints point at a GitHub Enterprise Server
+// instance rather than github.com or GHE.com.
+func (e Endpoints) IsGHES() bool {
+	return strings.HasSuffix(e.BaseURL, "/api/v3/")
+}
+
+// Server names the GitHub deployment for messages: "github.com" or the host.
+func (e Endpoints) Server() string {
+	if e.BaseURL == "" {
+		return "github.com"
+	}
+	if u, err := url.Parse(e.BaseURL); err == nil {
+		return u.Host
+	}
+	return e.BaseURL
+}
+
+// appsBaseURL is the BaseURL ghinstallation expects: the REST root without
+// a trailing slash.
+func (e Endpoints) appsBaseURL() string {
+	return strings.TrimSuffix(e.BaseURL, "/")
+}
+
+// CapabilityError reports that the GitHub deployment lacks a feature the
+// config relies on, such as custom repository roles on GitHub Enterprise
+// Server or internal visibility outside an enterprise-owned org.
+type CapabilityError struct {
+	Feature string // e.g. "custom repository roles"
+	Server  string // see Endpoints.Server
+	Hint    string // what to change, optional
+	Err     error  // the API error that revealed the gap, optional
+}
+
+func (e *CapabilityError) Error() string {
+	msg := fmt.Sprintf("%s: not available on %s", e.Feature, e.Server)
+	if e.Hint != "" {
+		msg += " (" + e.Hint + ")"
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *CapabilityError) Unwrap() error { return e.Err }
+
+// Unsupported returns a CapabilityError for feature on c's server, wrapping
+// the API error that revealed it.
+func (c *Client) Unsupported(feature, hint string, err error) error {
+	return &CapabilityError{Feature: feature, Server: c.Endpoints.Server(), Hint: hint, Err: err}
+}
+
+// IsGHES reports whether c talks to GitHub Enterprise Server.
+func (c *Client) IsGHES() bool { return c != nil && c.Endpoints.IsGHES() }
@@ -0,0 +1,249 @@
+package gh
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/DragonSecurity/gomgr/internal/config"
+)
+
+func TestResolveEndpoints(t *testing.T) {
+	tests := []struct {
+		name    string
+		app     config.AppConfig
+		env     map[string]string
+		want    Endpoints
+		ghes    bool
+		wantErr string
+	}{
+		{name: "github.com", want: Endpoints{}},
+		{
+			name: "GHES host only",
+			app:  config.AppConfig{BaseURL: "https://ghe.example.com"},
+			want: Endpoints{
+				BaseURL:    "https://ghe.example.com/api/v3/",
+				UploadURL:  "https://ghe.example.com/api/uploads/",
+				GraphQLURL: "https://ghe.example.com/api/graphql",
+			},
+			ghes: true,
+		},
+		{
+			name: "GHES API root",
+			app:  config.AppConfig{BaseURL: "https://ghe.example.com/api/v3"},
+			want: Endpoints{
+				BaseURL:    "https://ghe.example.com/api/v3/",
+				UploadURL:  "https://ghe.example.com/api/uploads/",
+				GraphQLURL: "https://ghe.example.com/api/graphql",
+			},
+			ghes: true,
+		},
+		{
+			name: "GHE.com",
+			app:  config.AppConfig{BaseURL: "https://api.acme.ghe.com"},
+			want: Endpoints{
+				BaseURL:    "https://api.acme.ghe.com/",
+				UploadURL:  "https://api.acme.ghe.com/",
+				GraphQLURL: "https://api.acme.ghe.com/graphql",
+			},
+		},
+		{
+			name: "explicit URLs",
+			app: config.AppConfig{
+				BaseURL:    "https://ghe.example.com/api/v3/",
+				UploadURL:  "https://uploads.ghe.example.com/",
+				GraphQLURL: "https://gql.ghe.example.com/graphql",
+			},
+			want: Endpoints{
+				BaseURL:    "https://ghe.example.com/api/v3/",
+				UploadURL:  "https://uploads.ghe.example.com/",
+				GraphQLURL: "https://gql.ghe.example.com/graphql",
+			},
+			ghes: true,
+		},
+		{
+			name: "env overrides config",
+			app:  config.AppConfig{BaseURL: "https://old.example.com"},
+			env:  map[string]string{"GOMGR_BASE_URL": "https://new.example.com"},
+			want: Endpoints{
+				BaseURL:    "https://new.example.com/api/v3/",
+				UploadURL:  "https://new.example.com/api/uploads/",
+				GraphQLURL: "https://new.example.com/api/graphql",
+			},
+			ghes: true,
+		},
+		{
+			name:    "graphql without base",
+			app:     config.AppConfig{GraphQLURL: "https://ghe.example.com/api/graphql"},
+			wantErr: "need base_url",
+		},
+		{
+			name:    "relative base",
+			app:     config.AppConfig{BaseURL: "ghe.example.com"},
+			wantErr: "absolute http(s) URL",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, k := range []string{"GOMGR_BASE_URL", "GOMGR_UPLOAD_URL", "GOMGR_GRAPHQL_URL"} {
+				t.Setenv(k, tt.env[k])
+			}
+			got, err := ResolveEndpoints(tt.app)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("ResolveEndpoints = %+v, want %+v", got, tt.want)
+			}
+			if got.IsGHES() != tt.ghes {
+				t.Errorf("IsGHES = %v, want %v", got.IsGHES(), tt.ghes)
+			}
+		})
+	}
+}
+
+// ghesServer records request paths and answers the few endpoints the
+// client tests call.
+type ghesServer struct {
+	mu    sync.Mutex
+	paths []string
+}
+
+func (g *ghesServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	g.paths = append(g.paths, r.Method+" "+r.URL.Path)
+	g.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/api/v3/orgs/acme/installation", "/api/v3/app/installations/7":
+		_ = json.NewEncoder(w).Encode(map[string]any{"id": 7})
+	case "/api/v3/app/installations/7/access_tokens":
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{"token": "inst-token", "expires_at": "2099-01-01T00:00:00Z"})
+	case "/api/v3/user":
+		_ = json.NewEncoder(w).Encode(map[string]any{"login": "octocat"})
+	case "/api/graphql":
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{}})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (g *ghesServer) saw(path string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, p := range g.paths {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+func TestNewClientFromEnv_EnterprisePAT(t *testing.T) {
+	g := &ghesServer{}
+	srv := httptest.NewServer(g)
+	defer srv.Close()
+	t.Setenv("GITHUB_TOKEN", "pat")
+	t.Setenv("GOMGR_BASE_URL", "")
+
+	c, _, err := NewClientFromEnv(context.Background(), config.AppConfig{Org: "acme", BaseURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.REST.Users.Get(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DoGraphQL(context.Background(), "{ viewer { login } }", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"GET /api/v3/user", "POST /api/graphql"} {
+		if !g.saw(p) {
+			t.Errorf("server never saw %s (got %v)", p, g.paths)
+		}
+	}
+}
+
+func TestNewClientFromEnv_EnterpriseApp(t *testing.T) {
+	g := &ghesServer{}
+	srv := httptest.NewServer(g)
+	defer srv.Close()
+	t.Setenv("GITHUB_TOKEN", "")
+	t.Setenv("GOMGR_BASE_URL", "")
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	c, _, err := NewClientFromEnv(context.Background(), config.AppConfig{
+		Org: "acme", AppID: 1, PrivateKey: string(keyPEM), BaseURL: srv.URL + "/api/v3",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.REST.Users.Get(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{
+		"GET /api/v3/orgs/acme/installation",
+		"POST /api/v3/app/installations/7/access_tokens",
+		"GET /api/v3/user",
+	} {
+		if !g.saw(p) {
+			t.Errorf("server never saw %s (got %v)", p, g.paths)
+		}
+	}
+}
+
+func TestNewClientFromEnv_InstallationID(t *testing.T) {
+	g := &ghesServer{}
+	srv := httptest.NewServer(g)
+	defer srv.Close()
+	clearAuthEnv(t)
+	t.Setenv("GOMGR_BASE_URL", "")
+
+	c, source, err := NewClientFromEnv(context.Background(), config.AppConfig{
+		Org: "acme", AppID: 1, PrivateKey: string(testKeyPEM(t)), InstallationID: 7, BaseURL: srv.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(source, "installation 7") || len(c.AuthSkipped()) != 2 {
+		t.Errorf("source = %q, skipped = %v", source, c.AuthSkipped())
+	}
+	if !g.saw("GET /api/v3/app/installations/7") || g.saw("GET /api/v3/orgs/acme/installation") {
+		t.Errorf("installation_id should skip the org lookup, got %v", g.paths)
+	}
+}
+
+func TestCapabilityError(t *testing.T) {
+	cause := errors.New("404 Not Found")
+	c := &Client{Endpoints: Endpoints{BaseURL: "https://ghe.example.com/api/v3/"}}
+	err := c.Unsupported("custom repository roles", "upgrade", cause)
+
+	var capErr *CapabilityError
+	if !errors.As(err, &capErr) || !errors.Is(err, cause) {
+		t.Fatalf("Unsupported should return a CapabilityError wrapping the cause, got %T", err)
+	}
+	want := "custom repository roles: not available on ghe.example.com (upgrade): 404 Not Found"
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
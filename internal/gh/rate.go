@@ -1,31 +1,229 @@
 package gh
 
 import (
+	"bytes"
 	"context"
-	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/google/go-github/v88/github"
+	"go.opentelemetry.io/otel/attribute"
 
+	"github.com/DragonSecurity/gomgr/internal/tracing"
 	"github.com/DragonSecurity/gomgr/internal/util"
 )
 
-func RespectRate(ctx context.Context, c *github.Client) error {
-	r, _, err := c.RateLimit.Get(ctx)
-	if err != nil {
-		return fmt.Errorf("rate limit check: %w", err)
+const (
+	// paceBelow is the fraction of a bucket's limit under which requests are
+	// spaced out so the rest of the budget lasts until the window resets.
+	// Above it requests go out unthrottled.
+	paceBelow = 0.2
+	// secondaryDefaultWait is how long to back off after a secondary rate
+	// limit that came without a usable Retry-After header; GitHub asks for
+	// at least a minute.
+	secondaryDefaultWait = time.Minute
+	// maxBodyPeek bounds how much of a 403 body is read to tell a
+	// secondary rate limit from a permission error.
+	maxBodyPeek = 64 << 10
+)
+
+// rateGovernor paces requests from the X-RateLimit-* headers GitHub sends on
+// every response. Each bucket (core, graphql, search, …) is tracked on its
+// own: once a bucket runs low, requests are spread over what is left of its
+// reset window, and an exhausted bucket waits for the reset. A secondary
+// rate limit pauses every request, reads and writes alike, for the
+// Retry-After period.
+type rateGovernor struct {
+	mu           sync.Mutex
+	buckets      map[string]*rateBucket
+	blockedUntil time.Time
+	now          func() time.Time
+}
+
+type rateBucket struct {
+	limit     int
+	remaining int
+	reset     time.Time
+	// next is the earliest time the next paced request may go out; it
+	// hands out slots to concurrent callers.
+	next time.Time
+}
+
+func newRateGovernor() *rateGovernor {
+	return &rateGovernor{buckets: map[string]*rateBucket{}, now: time.Now}
+}
+
+// bucketFor guesses the rate-limit bucket a request will be charged to,
+// before GitHub confirms it with X-RateLimit-Resource.
+func bucketFor(req *http.Request) string {
+	p := strings.TrimSuffix(req.URL.Path, "/")
+	switch {
+	case strings.HasSuffix(p, "/graphql"):
+		return "graphql"
+	case strings.Contains(p, "/search/"):
+		return "search"
+	default:
+		return "core"
+	}
+}
+
+// reserve claims a slot for a request in bucket and returns how long the
+// caller must wait before sending it.
+func (g *rateGovernor) reserve(bucket string) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	start := now
+	if g.blockedUntil.After(start) {
+		start = g.blockedUntil
+	}
+	b := g.buckets[bucket]
+	if b == nil || !b.reset.After(now) {
+		return start.Sub(now)
+	}
+	switch {
+	case b.remaining <= 0:
+		// Out of budget: nothing goes out until the window resets. The
+		// extra second covers clock skew against GitHub.
+		if reset := b.reset.Add(time.Second); reset.After(start) {
+			start = reset
+		}
+	case float64(b.remaining) < float64(b.limit)*paceBelow:
+		if b.next.After(start) {
+			start = b.next
+		}
+		b.next = start.Add(b.reset.Sub(now) / time.Duration(b.remaining))
+	}
+	// Count the request against the budget now, so concurrent callers see
+	// it shrink before the response arrives.
+	b.remaining--
+	return start.Sub(now)
+}
+
+// wait blocks until req may be sent, or ctx is done.
+func (g *rateGovernor) wait(ctx context.Context, req *http.Request) error {
+	bucket := bucketFor(req)
+	d := g.reserve(bucket)
+	if d <= 0 {
+		return nil
 	}
-	if r == nil {
+	if d >= time.Second {
+		util.Infof("rate-limit: waiting %s before %s %s (%s bucket)", d.Round(time.Second), req.Method, req.URL.Path, bucket)
+	}
+	_, span := tracing.Start(ctx, "github rate limit wait",
+		attribute.String("github.rate_limit.resource", bucket),
+		attribute.String("gomgr.sleep", d.String()),
+	)
+	defer span.End()
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
 		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// observe updates the governor from a response. It reports whether the
+// response was a rate limit — primary or secondary — in which case GitHub
+// did not act on the request and it is safe to resend, whatever its method.
+func (g *rateGovernor) observe(req *http.Request, resp *http.Response) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	bucket := resp.Header.Get("X-RateLimit-Resource")
+	if bucket == "" {
+		bucket = bucketFor(req)
 	}
-	if core := r.GetCore(); core.Remaining < 50 {
-		sleep := time.Until(core.Reset.Time) + time.Second
-		util.Infof("rate-limit: sleeping %s until %s", sleep, core.Reset.Time)
-		select {
-		case <-time.After(sleep):
-		case <-ctx.Done():
-			return ctx.Err()
+	remaining, okRemaining := headerInt(resp, "X-RateLimit-Remaining")
+	if okRemaining {
+		b := g.buckets[bucket]
+		if b == nil {
+			b = &rateBucket{}
+			g.buckets[bucket] = b
+		}
+		if limit, ok := headerInt(resp, "X-RateLimit-Limit"); ok {
+			b.limit = limit
 		}
+		if reset, ok := headerInt(resp, "X-RateLimit-Reset"); ok {
+			r := time.Unix(int64(reset), 0)
+			if !r.Equal(b.reset) {
+				b.next = time.Time{}
+			}
+			b.reset = r
+		}
+		b.remaining = remaining
+	}
+
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return false
+	}
+	if okRemaining && remaining == 0 {
+		// Primary limit: reserve already holds requests until the reset.
+		return true
+	}
+	if !isSecondaryRateLimit(resp) {
+		return false
+	}
+	wait := secondaryDefaultWait
+	if d, ok := parseRetryAfter(resp.Header.Get("Retry-After"), now); ok {
+		wait = d
+	}
+	if until := now.Add(wait); until.After(g.blockedUntil) {
+		g.blockedUntil = until
+	}
+	util.Warnf("rate-limit: secondary limit hit on %s %s, pausing requests for %s", req.Method, req.URL.Path, wait)
+	return true
+}
+
+// isSecondaryRateLimit tells a secondary rate limit from other 403/429
+// responses: GitHub marks it with Retry-After or says so in the body. The
+// body is restored so callers can still read it.
+func isSecondaryRateLimit(resp *http.Response) bool {
+	if resp.Header.Get("Retry-After") != "" {
+		return true
+	}
+	if resp.Body == nil {
+		return false
+	}
+	peek, _ := io.ReadAll(io.LimitReader(resp.Body, maxBodyPeek))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(peek), resp.Body), resp.Body}
+	return bytes.Contains(bytes.ToLower(peek), []byte("secondary rate limit"))
+}
+
+// parseRetryAfter reads a Retry-After value in either form RFC 9110 allows:
+// delta-seconds or an HTTP-date, measured from now. A date in the past is a
+// zero wait. ok is false when v is empty or neither form parses.
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+func headerInt(resp *http.Response, name string) (int, bool) {
+	v := resp.Header.Get(name)
+	if v == "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, false
 	}
-	return nil
+	return n, true
 }
@@ -2,62 +2,212 @@ package gh
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
-
-	"github.com/google/go-github/v88/github"
 )
 
-func TestRespectRate_Healthy(t *testing.T) {
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
-		resp := map[string]any{
-			"resources": map[string]any{
-				"core": map[string]any{
-					"limit":     5000,
-					"remaining": 4999,
-					"reset":     time.Now().Add(time.Hour).Unix(),
-				},
-			},
+// rateResponse builds a response carrying X-RateLimit-* headers for bucket.
+func rateResponse(status int, bucket string, limit, remaining int, reset time.Time) *http.Response {
+	h := http.Header{}
+	h.Set("X-RateLimit-Resource", bucket)
+	h.Set("X-RateLimit-Limit", strconv.Itoa(limit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	h.Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+	return &http.Response{StatusCode: status, Header: h, Body: io.NopCloser(strings.NewReader(""))}
+}
+
+func fixedGovernor(now time.Time) *rateGovernor {
+	g := newRateGovernor()
+	g.now = func() time.Time { return now }
+	return g
+}
+
+func TestRateGovernor_HealthyBucketIsNotPaced(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	g := fixedGovernor(now)
+	req := httptest.NewRequest(http.MethodGet, "/orgs/acme/teams", nil)
+	g.observe(req, rateResponse(http.StatusOK, "core", 5000, 4000, now.Add(time.Hour)))
+
+	for range 10 {
+		if d := g.reserve("core"); d != 0 {
+			t.Fatalf("reserve() = %s, want 0 with plenty of budget", d)
 		}
-		w.WriteHeader(http.StatusOK)
-		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func TestRateGovernor_PacesLowBucket(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	g := fixedGovernor(now)
+	req := httptest.NewRequest(http.MethodGet, "/orgs/acme/teams", nil)
+	// 100 requests left for 100 seconds: one per second.
+	g.observe(req, rateResponse(http.StatusOK, "core", 5000, 100, now.Add(100*time.Second)))
+
+	if d := g.reserve("core"); d != 0 {
+		t.Errorf("first reserve() = %s, want 0", d)
+	}
+	if d := g.reserve("core"); d != time.Second {
+		t.Errorf("second reserve() = %s, want 1s", d)
+	}
+	if d := g.reserve("core"); d <= time.Second {
+		t.Errorf("third reserve() = %s, want more than 1s", d)
+	}
+}
+
+func TestRateGovernor_ExhaustedBucketWaitsForReset(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	g := fixedGovernor(now)
+	req := httptest.NewRequest(http.MethodPost, "/graphql", nil)
+	limited := g.observe(req, rateResponse(http.StatusForbidden, "graphql", 5000, 0, now.Add(30*time.Second)))
+	if !limited {
+		t.Error("observe() = false, want an exhausted bucket to count as rate limited")
+	}
+
+	if d := g.reserve("graphql"); d != 31*time.Second {
+		t.Errorf("graphql reserve() = %s, want 31s", d)
+	}
+	// Buckets are independent: core still has its full budget.
+	if d := g.reserve("core"); d != 0 {
+		t.Errorf("core reserve() = %s, want 0", d)
+	}
+}
+
+func TestRateGovernor_SecondaryLimitBlocksEverything(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	g := fixedGovernor(now)
+	req := httptest.NewRequest(http.MethodPatch, "/orgs/acme/teams/backend", nil)
+	resp := &http.Response{
+		StatusCode: http.StatusForbidden,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader(`{"message":"You have exceeded a secondary rate limit."}`)),
+	}
+	if !g.observe(req, resp) {
+		t.Fatal("observe() = false, want a secondary rate limit")
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "secondary rate limit") {
+		t.Errorf("body not restored after peeking, got %q", body)
+	}
+	for _, bucket := range []string{"core", "search"} {
+		if d := g.reserve(bucket); d != secondaryDefaultWait {
+			t.Errorf("%s reserve() = %s, want %s", bucket, d, secondaryDefaultWait)
+		}
+	}
+}
+
+func TestRateGovernor_SecondaryLimitRetryAfterDate(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	req := httptest.NewRequest(http.MethodPost, "/orgs/acme/teams", nil)
+	tests := []struct {
+		name       string
+		retryAfter string
+		want       time.Duration
+	}{
+		{"seconds", "30", 30 * time.Second},
+		{"http date", now.Add(90 * time.Second).UTC().Format(http.TimeFormat), 90 * time.Second},
+		{"past date", now.Add(-time.Minute).UTC().Format(http.TimeFormat), 0},
+		{"unparseable", "soon", secondaryDefaultWait},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := fixedGovernor(now)
+			resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+			resp.Header.Set("Retry-After", tt.retryAfter)
+			if !g.observe(req, resp) {
+				t.Fatal("observe() = false, want a secondary rate limit")
+			}
+			if d := g.reserve("core"); d != tt.want {
+				t.Errorf("reserve() = %s, want %s", d, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateGovernor_PermissionDeniedIsNotRateLimit(t *testing.T) {
+	g := newRateGovernor()
+	req := httptest.NewRequest(http.MethodDelete, "/repos/acme/api", nil)
+	resp := rateResponse(http.StatusForbidden, "core", 5000, 4000, time.Now().Add(time.Hour))
+	resp.Body = io.NopCloser(strings.NewReader(`{"message":"Must have admin rights to Repository."}`))
+	if g.observe(req, resp) {
+		t.Error("observe() = true, want a plain 403 not to count as a rate limit")
+	}
+}
+
+func TestBucketFor(t *testing.T) {
+	tests := map[string]string{
+		"/orgs/acme/teams":         "core",
+		"/graphql":                 "graphql",
+		"/api/graphql":             "graphql",
+		"/search/issues":           "search",
+		"/api/v3/search/code":      "search",
+		"/repos/acme/search-tools": "core",
+	}
+	for path, want := range tests {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if got := bucketFor(req); got != want {
+			t.Errorf("bucketFor(%s) = %s, want %s", path, got, want)
+		}
+	}
+}
+
+func TestRetryTransport_ResendsMutationAfterSecondaryLimit(t *testing.T) {
+	var calls int32
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
 	}))
 	defer server.Close()
 
-	url := server.URL + "/"
-	client, err := github.NewClient(github.WithURLs(&url, &url))
+	client := &http.Client{Transport: newRetryTransport(http.DefaultTransport, 3)}
+	resp, err := client.Post(server.URL+"/orgs/acme/teams", "application/json", strings.NewReader(`{"name":"backend"}`))
 	if err != nil {
-		t.Fatalf("new github client: %v", err)
+		t.Fatalf("unexpected error: %v", err)
 	}
+	_ = resp.Body.Close()
 
-	err = RespectRate(context.Background(), client)
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("expected 201 after resend, got %d", resp.StatusCode)
+	}
+	if len(bodies) != 2 || bodies[1] != `{"name":"backend"}` {
+		t.Errorf("expected the body to be replayed, got %q", bodies)
 	}
 }
 
-func TestRespectRate_APIError(t *testing.T) {
+func TestRetryTransport_RateLimitWaitHonoursContext(t *testing.T) {
+	var calls int32
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
-		w.WriteHeader(http.StatusInternalServerError)
-		_ = json.NewEncoder(w).Encode(map[string]any{"message": "server error"})
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
 	}))
 	defer server.Close()
 
-	url := server.URL + "/"
-	client, err := github.NewClient(github.WithURLs(&url, &url))
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
 	if err != nil {
-		t.Fatalf("new github client: %v", err)
+		t.Fatal(err)
 	}
-
-	err = RespectRate(context.Background(), client)
-	if err == nil {
-		t.Fatal("expected error for 500 response")
+	client := &http.Client{Transport: newRetryTransport(http.DefaultTransport, 3)}
+	start := time.Now()
+	_, err = client.Do(req)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a deadline error, got %v", err)
 	}
-	if !strings.Contains(err.Error(), "rate limit check") {
-		t.Errorf("expected 'rate limit check' in error, got: %v", err)
+	if time.Since(start) > 5*time.Second || atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("expected the wait to stop with the context after one call, took %s and %d calls", time.Since(start), calls)
 	}
 }
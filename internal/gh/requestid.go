@@ -0,0 +1,61 @@
+package gh
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// requestIDHeader carries the ID GitHub assigns to every API request; quoting
+// it is the fastest way to get GitHub support to find a failing call.
+const requestIDHeader = "X-GitHub-Request-Id"
+
+type requestIDKey struct{}
+
+// RequestIDs collects the GitHub request IDs of every response received
+// under a context returned by WithRequestIDs, retries included.
+type RequestIDs struct {
+	mu  sync.Mutex
+	ids []string
+}
+
+// WithRequestIDs returns a context whose API calls record their request IDs
+// into the returned collector.
+func WithRequestIDs(ctx context.Context) (context.Context, *RequestIDs) {
+	ids := &RequestIDs{}
+	return context.WithValue(ctx, requestIDKey{}, ids), ids
+}
+
+// Last returns the most recent request ID, or "" when none was recorded.
+func (r *RequestIDs) Last() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.ids) == 0 {
+		return ""
+	}
+	return r.ids[len(r.ids)-1]
+}
+
+// All returns every recorded request ID in arrival order.
+func (r *RequestIDs) All() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.ids...)
+}
+
+// recordRequestID stores resp's request ID in the collector attached to req's
+// context, if any.
+func recordRequestID(req *http.Request, resp *http.Response) {
+	if resp == nil {
+		return
+	}
+	ids, ok := req.Context().Value(requestIDKey{}).(*RequestIDs)
+	if !ok {
+		return
+	}
+	if id := resp.Header.Get(requestIDHeader); id != "" {
+		ids.mu.Lock()
+		ids.ids = append(ids.ids, id)
+		ids.mu.Unlock()
+	}
+}
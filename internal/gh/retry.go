@@ -1,26 +1,35 @@
 package gh
 
 import (
+	"context"
 	"math"
 	"math/rand"
 	"net/http"
-	"strconv"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"github.com/DragonSecurity/gomgr/internal/tracing"
 )
 
 // retryTransport wraps an http.RoundTripper and retries on transient failures
-// (5xx responses and 429 rate limits) with exponential backoff and jitter.
+// (5xx responses and rate limits) with exponential backoff and jitter. Every
+// attempt first clears the rate governor, which also decides how long a
+// rate-limited request sits out before it is resent.
 type retryTransport struct {
 	base       http.RoundTripper
 	maxRetries int
+	gov        *rateGovernor
 }
 
-// newRetryTransport wraps the given transport with retry logic.
+// newRetryTransport wraps the given transport with retry logic and a fresh
+// rate governor.
 func newRetryTransport(base http.RoundTripper, maxRetries int) http.RoundTripper {
 	if base == nil {
 		base = http.DefaultTransport
 	}
-	return &retryTransport{base: base, maxRetries: maxRetries}
+	return &retryTransport{base: base, maxRetries: maxRetries, gov: newRateGovernor()}
 }
 
 func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
@@ -28,18 +37,38 @@ func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	var err error
 
 	for attempt := 0; attempt <= t.maxRetries; attempt++ {
-		resp, err = t.base.RoundTrip(req)
+		if attempt > 0 {
+			next, ok := rewindBody(req)
+			if !ok {
+				return resp, err
+			}
+			if resp != nil {
+				// Drain and close response body before retry
+				_ = resp.Body.Close()
+			}
+			req = next
+		}
+		if werr := t.gov.wait(req.Context(), req); werr != nil {
+			return nil, werr
+		}
+
+		resp, err = t.attempt(req, attempt)
+		recordRequestID(req, resp)
 		if err != nil {
 			// Network-level error: only retry if the request is idempotent or retryable
 			if !isRetryableMethod(req.Method) || attempt == t.maxRetries {
 				return resp, err
 			}
-			backoff := calcBackoff(attempt)
-			time.Sleep(backoff)
+			if serr := sleepTraced(req.Context(), calcBackoff(attempt), attempt); serr != nil {
+				return resp, err
+			}
 			continue
 		}
 
-		if !isRetryableStatus(resp.StatusCode) {
+		// A rate-limited request was never acted on, so it is resent
+		// whatever its method; the governor holds the next attempt back.
+		limited := t.gov.observe(req, resp)
+		if !limited && !isRetryableStatus(resp.StatusCode) {
 			return resp, nil
 		}
 
@@ -47,21 +76,79 @@ func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 		if attempt == t.maxRetries {
 			return resp, nil
 		}
+		if limited {
+			continue
+		}
 
 		// Use Retry-After header if present (GitHub sends it on 429)
 		backoff := retryAfterDuration(resp)
 		if backoff == 0 {
 			backoff = calcBackoff(attempt)
 		}
+		if serr := sleepTraced(req.Context(), backoff, attempt); serr != nil {
+			return resp, nil
+		}
+	}
+
+	return resp, err
+}
 
-		// Drain and close response body before retry
-		_ = resp.Body.Close()
-		time.Sleep(backoff)
+// rewindBody returns a copy of req with a fresh body for resending. It
+// reports false when the body cannot be replayed.
+func rewindBody(req *http.Request) (*http.Request, bool) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, true
 	}
+	if req.GetBody == nil {
+		return nil, false
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, false
+	}
+	next := req.Clone(req.Context())
+	next.Body = body
+	return next, true
+}
 
+// attempt sends one try of req inside its own span. Retries of the same
+// request are sibling spans told apart by http.request.resend_count.
+func (t *retryTransport) attempt(req *http.Request, attempt int) (*http.Response, error) {
+	ctx, span := tracing.Start(req.Context(), req.Method+" "+endpointPattern(req.URL.Path),
+		attribute.String("http.request.method", req.Method),
+		attribute.String("url.path", req.URL.Path),
+		attribute.Int("http.request.resend_count", attempt),
+	)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if resp != nil {
+		span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+		if resp.StatusCode >= 400 {
+			span.SetStatus(codes.Error, resp.Status)
+		}
+	}
+	tracing.End(span, err)
 	return resp, err
 }
 
+// sleepTraced waits out a retry backoff, recorded as a span so slow runs
+// show how much time went to retries. It returns early with ctx's error
+// when ctx is done.
+func sleepTraced(ctx context.Context, d time.Duration, attempt int) error {
+	_, span := tracing.Start(ctx, "github retry backoff",
+		attribute.Int("http.request.resend_count", attempt),
+		attribute.String("gomgr.backoff", d.String()),
+	)
+	defer span.End()
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func isRetryableStatus(status int) bool {
 	return status == http.StatusTooManyRequests || // 429
 		status == http.StatusInternalServerError || // 500
@@ -87,12 +174,6 @@ func calcBackoff(attempt int) time.Duration {
 
 // retryAfterDuration parses the Retry-After header if present.
 func retryAfterDuration(resp *http.Response) time.Duration {
-	ra := resp.Header.Get("Retry-After")
-	if ra == "" {
-		return 0
-	}
-	if secs, err := strconv.Atoi(ra); err == nil {
-		return time.Duration(secs) * time.Second
-	}
-	return 0
+	d, _ := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	return d
 }
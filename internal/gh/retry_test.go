@@ -1,10 +1,16 @@
 package gh
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"sync/atomic"
 	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestRetryTransport_SuccessOnFirstAttempt(t *testing.T) {
@@ -143,3 +149,74 @@ func TestRetryTransport_RespectsRetryAfter(t *testing.T) {
 		t.Errorf("expected 2 calls, got %d", c)
 	}
 }
+
+func TestRetryTransport_RecordsRequestIDs(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		w.Header().Set("X-GitHub-Request-Id", fmt.Sprintf("REQ-%d", n))
+		if n < 2 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: newRetryTransport(http.DefaultTransport, 3)}
+	ctx, ids := WithRequestIDs(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if got := ids.Last(); got != "REQ-2" {
+		t.Errorf("Last() = %q, want REQ-2", got)
+	}
+	if got := ids.All(); len(got) != 2 || got[0] != "REQ-1" {
+		t.Errorf("All() = %v, want [REQ-1 REQ-2]", got)
+	}
+}
+
+func TestRetryTransport_TracesAttempts(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(prev)
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: newRetryTransport(http.DefaultTransport, 2)}
+	resp, err := client.Get(server.URL + "/orgs/acme/teams")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	var attempts, backoffs int
+	for _, s := range recorder.Ended() {
+		switch s.Name() {
+		case "GET /orgs/*/teams":
+			attempts++
+		case "github retry backoff":
+			backoffs++
+		}
+	}
+	if attempts != 2 || backoffs != 1 {
+		t.Errorf("expected 2 attempt spans and 1 backoff span, got %d and %d", attempts, backoffs)
+	}
+}
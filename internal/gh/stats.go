@@ -0,0 +1,129 @@
+package gh
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// APIStats counts the API requests a Client sends and remembers the latest
+// rate-limit headroom GitHub reported, for --metrics-file.
+type APIStats struct {
+	mu        sync.Mutex
+	requests  map[RequestKey]int
+	remaining map[string]int
+}
+
+// RequestKey identifies one request counter. Endpoint is the route with
+// org, repo, team and user names replaced by "*" so the set of keys stays
+// small; Status is 0 when the request failed without a response.
+type RequestKey struct {
+	Method   string
+	Endpoint string
+	Status   int
+}
+
+func newAPIStats() *APIStats {
+	return &APIStats{requests: map[RequestKey]int{}, remaining: map[string]int{}}
+}
+
+// Requests returns a copy of the request counters. Every attempt counts, so
+// retried requests appear once per try.
+func (s *APIStats) Requests() map[RequestKey]int {
+	out := map[RequestKey]int{}
+	if s == nil {
+		return out
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, v := range s.requests {
+		out[k] = v
+	}
+	return out
+}
+
+// RateRemaining returns the last X-RateLimit-Remaining value seen per
+// X-RateLimit-Resource (core, graphql, search, …).
+func (s *APIStats) RateRemaining() map[string]int {
+	out := map[string]int{}
+	if s == nil {
+		return out
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, v := range s.remaining {
+		out[k] = v
+	}
+	return out
+}
+
+func (s *APIStats) record(req *http.Request, resp *http.Response) {
+	key := RequestKey{Method: req.Method, Endpoint: endpointPattern(req.URL.Path)}
+	if resp != nil {
+		key.Status = resp.StatusCode
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[key]++
+	if resp == nil {
+		return
+	}
+	if v, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining")); err == nil {
+		resource := resp.Header.Get("X-RateLimit-Resource")
+		if resource == "" {
+			resource = "core"
+		}
+		s.remaining[resource] = v
+	}
+}
+
+// statsTransport records every round trip into an APIStats. It sits below
+// retryTransport so each retry attempt is counted.
+type statsTransport struct {
+	base  http.RoundTripper
+	stats *APIStats
+}
+
+func (t *statsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	t.stats.record(req, resp)
+	return resp, err
+}
+
+// endpointPattern turns a REST path into its route, e.g.
+// /orgs/acme/teams/backend/repos/acme/api → /orgs/*/teams/*/repos/*/*.
+// GitHub routes alternate between a collection and an identifier; "repos"
+// is followed by owner and name, and file and ref paths swallow the rest.
+func endpointPattern(path string) string {
+	segs := strings.Split(strings.Trim(path, "/"), "/")
+	// GHES serves the REST API under /api/v3.
+	if len(segs) >= 2 && segs[0] == "api" && segs[1] == "v3" {
+		segs = segs[2:]
+	}
+	out := make([]string, 0, len(segs))
+	for i := 0; i < len(segs); i++ {
+		s := segs[i]
+		out = append(out, s)
+		switch s {
+		case "contents", "ref", "refs":
+			if i+1 < len(segs) {
+				out = append(out, "*")
+			}
+			i = len(segs)
+		case "repos":
+			for n := 0; n < 2 && i+1 < len(segs); n++ {
+				out = append(out, "*")
+				i++
+			}
+		case "rate_limit", "user", "app", "installation", "graphql", "git", "topics":
+			// singletons: the next segment, if any, is a sub-collection
+		default:
+			if i+1 < len(segs) {
+				out = append(out, "*")
+				i++
+			}
+		}
+	}
+	return "/" + strings.Join(out, "/")
+}
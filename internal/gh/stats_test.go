@@ -0,0 +1,73 @@
+package gh
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEndpointPattern(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/orgs/acme/teams", "/orgs/*/teams"},
+		{"/orgs/acme/teams/backend/memberships/octocat", "/orgs/*/teams/*/memberships/*"},
+		{"/orgs/acme/teams/backend/repos/acme/api", "/orgs/*/teams/*/repos/*/*"},
+		{"/repos/acme/api/topics", "/repos/*/*/topics"},
+		{"/repos/acme/api/contents/.github/CODEOWNERS", "/repos/*/*/contents/*"},
+		{"/repos/acme/api/git/refs/heads/main", "/repos/*/*/git/refs/*"},
+		{"/repos/acme/api/git/commits/abc123", "/repos/*/*/git/commits/*"},
+		{"/api/v3/orgs/acme/members", "/orgs/*/members"},
+		{"/rate_limit", "/rate_limit"},
+		{"/user", "/user"},
+		{"/graphql", "/graphql"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := endpointPattern(tt.path); got != tt.want {
+				t.Errorf("endpointPattern(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatsTransport_CountsAttempts(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls++
+		w.Header().Set("X-RateLimit-Remaining", "4999")
+		if calls == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	stats := newAPIStats()
+	client := &http.Client{Transport: newRetryTransport(&statsTransport{base: http.DefaultTransport, stats: stats}, 2)}
+	resp, err := client.Get(server.URL + "/orgs/acme/members")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	reqs := stats.Requests()
+	if n := reqs[RequestKey{Method: "GET", Endpoint: "/orgs/*/members", Status: http.StatusBadGateway}]; n != 1 {
+		t.Errorf("502 attempts = %d, want 1 (all: %v)", n, reqs)
+	}
+	if n := reqs[RequestKey{Method: "GET", Endpoint: "/orgs/*/members", Status: http.StatusOK}]; n != 1 {
+		t.Errorf("200 attempts = %d, want 1 (all: %v)", n, reqs)
+	}
+	if got := stats.RateRemaining()["core"]; got != 4999 {
+		t.Errorf("rate remaining = %d, want 4999", got)
+	}
+}
+
+func TestAPIStats_NilSafe(t *testing.T) {
+	var s *APIStats
+	if len(s.Requests()) != 0 || len(s.RateRemaining()) != 0 {
+		t.Fatal("nil stats should report nothing")
+	}
+}
@@ -0,0 +1,331 @@
+// Package journal checkpoints an apply so an interrupted sync can be resumed.
+//
+// A journal is a JSON-lines file. The first line holds the plan being
+// applied and its hash; each following line records a change starting or
+// finishing. Every line is synced to disk before the apply moves on, so the
+// file survives the process being killed mid-change. Resuming reads the plan
+// back from the journal, skips changes it records as completed, and lets the
+// caller re-check the ones that were in flight.
+package journal
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/DragonSecurity/gomgr/internal/util"
+)
+
+// Entry kinds.
+const (
+	KindPlan   = "plan"
+	KindStart  = "start"
+	KindDone   = "done"
+	KindFinish = "finish"
+)
+
+// Entry statuses.
+const (
+	StatusOK    = "ok"
+	StatusError = "error"
+)
+
+// Header identifies the apply a journal belongs to.
+type Header struct {
+	PlanHash  string    `json:"plan_hash"`
+	Org       string    `json:"org"`
+	ConfigSHA string    `json:"config_sha,omitempty"`
+	Created   time.Time `json:"created"`
+}
+
+// entry is one line of the journal. Header and Changes are only set on the
+// plan line.
+type entry struct {
+	Kind    string          `json:"kind"`
+	Header  *Header         `json:"header,omitempty"`
+	Changes json.RawMessage `json:"changes,omitempty"`
+	ID      string          `json:"id,omitempty"`
+	Change  string          `json:"change,omitempty"`
+	Status  string          `json:"status,omitempty"`
+	Error   string          `json:"error,omitempty"`
+	Time    time.Time       `json:"ts"`
+}
+
+// Journal records the progress of one apply. A nil *Journal is valid and
+// records nothing, so callers never need to nil-check.
+type Journal struct {
+	path    string
+	header  Header
+	resumed bool
+
+	mu    sync.Mutex
+	f     *os.File
+	state map[string]string
+	errs  []error
+}
+
+// ChangeID identifies a change across runs: the hash of its JSON encoding.
+func ChangeID(ch util.Change) string {
+	b, err := json.Marshal(ch)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:12])
+}
+
+func hashChanges(raw []byte) string {
+	sum := sha256.Sum256(raw)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Create starts a new journal for plan at path, replacing any journal
+// already there. h.PlanHash is filled in from the plan.
+func Create(path string, h Header, plan util.Plan) (*Journal, error) {
+	raw, err := json.Marshal(plan.Changes)
+	if err != nil {
+		return nil, fmt.Errorf("journal: encode plan: %w", err)
+	}
+	h.PlanHash = hashChanges(raw)
+	if h.Created.IsZero() {
+		h.Created = time.Now().UTC()
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("journal: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600) //nolint:gosec // path comes from --journal
+	if err != nil {
+		return nil, fmt.Errorf("journal: %w", err)
+	}
+	j := &Journal{path: path, header: h, f: f, state: map[string]string{}}
+	if err := j.append(entry{Kind: KindPlan, Header: &h, Changes: raw}); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+// Open reads the journal at path for resuming and returns it with the plan
+// it was created for. Details come back as decoded JSON (maps, []any,
+// float64); callers that need typed details restore them. It fails when
+// the plan no longer matches its hash, and when the journal records an
+// apply that already finished without errors.
+func Open(path string) (*Journal, util.Plan, error) {
+	f, err := os.Open(path) //nolint:gosec // path comes from --journal
+	if err != nil {
+		return nil, util.Plan{}, fmt.Errorf("journal: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	j := &Journal{path: path, resumed: true, state: map[string]string{}}
+	var plan util.Plan
+	var finishedOK bool
+	// good is the size of the journal up to its last complete line; a line
+	// torn by the crash is cut off before appending.
+	var good int64
+	rd := bufio.NewReader(f)
+	for n := 1; ; n++ {
+		line, err := rd.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				util.Warnf("journal: %s:%d: dropping incomplete last entry", path, n)
+			}
+			break
+		}
+		if err != nil {
+			return nil, plan, fmt.Errorf("journal: read %s: %w", path, err)
+		}
+		good += int64(len(line))
+		var e entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, plan, fmt.Errorf("journal: %s:%d: %w", path, n, err)
+		}
+		switch e.Kind {
+		case KindPlan:
+			if n != 1 || e.Header == nil {
+				return nil, plan, fmt.Errorf("journal: %s:%d: unexpected plan entry", path, n)
+			}
+			if hashChanges(e.Changes) != e.Header.PlanHash {
+				return nil, plan, fmt.Errorf("journal: %s: plan does not match its hash %s", path, e.Header.PlanHash)
+			}
+			if err := json.Unmarshal(e.Changes, &plan.Changes); err != nil {
+				return nil, plan, fmt.Errorf("journal: %s: decode plan: %w", path, err)
+			}
+			j.header = *e.Header
+		case KindStart, KindDone:
+			j.track(e)
+		case KindFinish:
+			finishedOK = e.Status == StatusOK
+		}
+	}
+	if j.header.PlanHash == "" {
+		return nil, plan, fmt.Errorf("journal: %s has no plan", path)
+	}
+	if finishedOK {
+		return nil, plan, fmt.Errorf("journal: %s records a completed apply; nothing to resume", path)
+	}
+
+	_ = f.Close()
+	if err := os.Truncate(path, good); err != nil {
+		return nil, plan, fmt.Errorf("journal: %w", err)
+	}
+	af, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600) //nolint:gosec // path comes from --journal
+	if err != nil {
+		return nil, plan, fmt.Errorf("journal: %w", err)
+	}
+	j.f = af
+	return j, plan, nil
+}
+
+// Path returns the journal file path.
+func (j *Journal) Path() string {
+	if j == nil {
+		return ""
+	}
+	return j.path
+}
+
+// Header returns the journal's header.
+func (j *Journal) Header() Header {
+	if j == nil {
+		return Header{}
+	}
+	return j.header
+}
+
+// Resumed reports whether the journal was opened to continue an earlier
+// apply.
+func (j *Journal) Resumed() bool { return j != nil && j.resumed }
+
+// Completed reports whether an earlier run applied ch successfully.
+func (j *Journal) Completed(ch util.Change) bool {
+	return j.status(ch) == StatusOK
+}
+
+// InFlight reports whether an earlier run started ch but never recorded
+// its outcome.
+func (j *Journal) InFlight(ch util.Change) bool {
+	return j.status(ch) == KindStart
+}
+
+func (j *Journal) status(ch util.Change) string {
+	if j == nil {
+		return ""
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.state[ChangeID(ch)]
+}
+
+// Start records that ch is about to be applied.
+func (j *Journal) Start(ch util.Change) {
+	j.record(ch, KindStart, nil)
+}
+
+// Done records the outcome of ch; err is nil on success.
+func (j *Journal) Done(ch util.Change, err error) {
+	j.record(ch, KindDone, err)
+}
+
+func (j *Journal) record(ch util.Change, kind string, err error) {
+	if j == nil {
+		return
+	}
+	e := entry{Kind: kind, ID: ChangeID(ch), Change: ch.Scope + ":" + ch.Action + " " + ch.Target}
+	if kind == KindDone {
+		e.Status = StatusOK
+		if err != nil {
+			e.Status = StatusError
+			e.Error = err.Error()
+		}
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.track(e)
+	if werr := j.appendLocked(e); werr != nil {
+		j.fail(werr)
+	}
+}
+
+// track updates the per-change state from a start or done entry. A change
+// that succeeded once stays completed, even if an identical change later
+// fails.
+func (j *Journal) track(e entry) {
+	if j.state[e.ID] == StatusOK {
+		return
+	}
+	if e.Kind == KindStart {
+		j.state[e.ID] = KindStart
+		return
+	}
+	j.state[e.ID] = e.Status
+}
+
+// Close records the apply's overall result and closes the file. It returns
+// any error seen while writing, since a journal with gaps cannot be trusted
+// for a resume.
+func (j *Journal) Close(applyErr error) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.f == nil {
+		return errors.Join(j.errs...)
+	}
+	e := entry{Kind: KindFinish, Status: StatusOK}
+	if applyErr != nil {
+		e.Status = StatusError
+		e.Error = applyErr.Error()
+	}
+	if err := j.appendLocked(e); err != nil {
+		j.fail(err)
+	}
+	if err := j.f.Close(); err != nil {
+		j.fail(fmt.Errorf("journal: close: %w", err))
+	}
+	j.f = nil
+	return errors.Join(j.errs...)
+}
+
+func (j *Journal) append(e entry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.appendLocked(e)
+}
+
+// appendLocked writes e as one line and syncs it to disk.
+func (j *Journal) appendLocked(e entry) error {
+	if j.f == nil {
+		return errors.New("journal: closed")
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("journal: encode entry: %w", err)
+	}
+	if _, err := j.f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("journal: write: %w", err)
+	}
+	if err := j.f.Sync(); err != nil {
+		return fmt.Errorf("journal: sync: %w", err)
+	}
+	return nil
+}
+
+// fail remembers a write error for Close and warns immediately; a broken
+// journal must not abort the apply it describes.
+func (j *Journal) fail(err error) {
+	util.Warnf("%v", err)
+	j.errs = append(j.errs, err)
+}
@@ -0,0 +1,102 @@
+package journal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DragonSecurity/gomgr/internal/util"
+)
+
+var (
+	teamCreate = util.Change{Scope: "team", Action: "create", Target: "backend", Details: map[string]any{"org": "acme"}}
+	repoEnsure = util.Change{Scope: "repo", Action: "ensure", Target: "api", Details: map[string]any{"org": "acme", "topics": []string{"go"}}}
+	memberAdd  = util.Change{Scope: "team-member", Action: "ensure", Target: "backend"}
+)
+
+func testPlan() util.Plan {
+	return util.Plan{Changes: []util.Change{teamCreate, repoEnsure, memberAdd}}
+}
+
+func TestJournal_ResumeState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "acme.journal.jsonl")
+	j, err := Create(path, Header{Org: "acme", ConfigSHA: "abc"}, testPlan())
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Start(teamCreate)
+	j.Done(teamCreate, nil)
+	j.Start(repoEnsure)
+	j.Start(memberAdd)
+	j.Done(memberAdd, errors.New("boom"))
+	// Simulate the process dying: no Close, and a torn last line.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"kind":"done","id":"`)
+	_ = f.Close()
+
+	r, plan, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if !r.Resumed() || r.Header().Org != "acme" || r.Header().PlanHash != j.Header().PlanHash {
+		t.Errorf("unexpected header %+v", r.Header())
+	}
+	if len(plan.Changes) != 3 {
+		t.Fatalf("expected the plan back, got %d changes", len(plan.Changes))
+	}
+	// Details come back as plain JSON but identify the same change.
+	if !r.Completed(plan.Changes[0]) || r.InFlight(plan.Changes[0]) {
+		t.Error("team:create should be completed")
+	}
+	if !r.InFlight(plan.Changes[1]) {
+		t.Error("repo:ensure should be in flight")
+	}
+	if r.Completed(memberAdd) || r.InFlight(memberAdd) {
+		t.Error("a failed change should be neither completed nor in flight")
+	}
+
+	if err := r.Close(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Open(path); err == nil || !strings.Contains(err.Error(), "nothing to resume") {
+		t.Errorf("expected a finished journal to be refused, got %v", err)
+	}
+}
+
+func TestJournal_RejectsTamperedPlan(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "j.jsonl")
+	j, err := Create(path, Header{Org: "acme"}, testPlan())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Close(errors.New("interrupted")); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(strings.Replace(string(b), "backend", "frontend", 1)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Open(path); err == nil || !strings.Contains(err.Error(), "does not match its hash") {
+		t.Errorf("expected a hash mismatch, got %v", err)
+	}
+}
+
+func TestJournal_NilIsNoop(t *testing.T) {
+	var j *Journal
+	j.Start(teamCreate)
+	j.Done(teamCreate, nil)
+	if j.Resumed() || j.Completed(teamCreate) || j.InFlight(teamCreate) {
+		t.Error("nil journal should report nothing")
+	}
+	if err := j.Close(nil); err != nil {
+		t.Errorf("Close on nil journal: %v", err)
+	}
+}
@@ -0,0 +1,265 @@
+// Package metrics exports the outcome of a gomgr run in the Prometheus text
+// exposition format, either as a node_exporter textfile or pushed to a
+// Pushgateway.
+//
+// A run is a one-shot batch job, so every value describes the last run only;
+// scrape the file (or the gateway) rather than relying on counter resets.
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DragonSecurity/gomgr/internal/gh"
+	"github.com/DragonSecurity/gomgr/internal/util"
+)
+
+// contentType is the Prometheus text exposition format version this package
+// writes.
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Run collects the metrics of one gomgr invocation. A nil *Run is valid and
+// records nothing, so callers never need to nil-check.
+type Run struct {
+	start time.Time
+	now   func() time.Time
+
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+type family struct {
+	help    string
+	typ     string
+	samples map[string]float64 // rendered label set -> value
+}
+
+// NewRun starts the run clock.
+func NewRun() *Run {
+	return &Run{start: time.Now(), now: time.Now, families: map[string]*family{}}
+}
+
+// ObservePlan records the planned changes per scope and action, the
+// current/desired state pairs and the number of warnings.
+func (r *Run) ObservePlan(p util.Plan) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.declare("gomgr_plan_changes", "gauge", "Changes in the plan by scope and action.")
+	for _, ch := range p.Changes {
+		r.add("gomgr_plan_changes", 1, "scope", ch.Scope, "action", ch.Action)
+	}
+	r.set("gomgr_plan_warnings", "gauge", "Warnings raised while planning.", float64(len(p.Warnings)))
+	if p.Stats == nil {
+		return
+	}
+	pairs := []struct {
+		resource string
+		pair     util.StatePair
+	}{
+		{"teams", p.Stats.Teams},
+		{"team_members", p.Stats.TeamMembers},
+		{"repositories", p.Stats.Repositories},
+		{"repo_permissions", p.Stats.RepoPermissions},
+		{"custom_roles", p.Stats.CustomRoles},
+	}
+	for _, sp := range pairs {
+		r.set("gomgr_state_current", "gauge", "Current count of a managed resource on GitHub.", float64(sp.pair.Current), "resource", sp.resource)
+		r.set("gomgr_state_desired", "gauge", "Desired count of a managed resource per the config.", float64(sp.pair.Desired), "resource", sp.resource)
+	}
+}
+
+// RecordApply counts the outcome of one applied change under its handler
+// (the change scope). It matches sync.ApplyOptions.OnChange.
+func (r *Run) RecordApply(ch util.Change, err error) {
+	if r == nil {
+		return
+	}
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.declare("gomgr_apply_changes_total", "counter", "Applied changes by handler and result.")
+	r.add("gomgr_apply_changes_total", 1, "handler", ch.Scope, "result", result)
+}
+
+// ObserveAPI records the client's request counts per endpoint and the
+// rate-limit headroom per resource.
+func (r *Run) ObserveAPI(s *gh.APIStats) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for k, n := range s.Requests() {
+		code := "error"
+		if k.Status != 0 {
+			code = strconv.Itoa(k.Status)
+		}
+		r.declare("gomgr_api_requests_total", "counter", "GitHub API requests by method, endpoint and status code; retries count once per attempt.")
+		r.add("gomgr_api_requests_total", float64(n), "method", k.Method, "endpoint", k.Endpoint, "code", code)
+	}
+	for resource, remaining := range s.RateRemaining() {
+		r.set("gomgr_api_rate_limit_remaining", "gauge", "Requests left in the current rate-limit window, as last reported by GitHub.", float64(remaining), "resource", resource)
+	}
+}
+
+// Finish records the run duration, its end time and whether it succeeded.
+func (r *Run) Finish(err error) {
+	if r == nil {
+		return
+	}
+	end := r.now()
+	success := 1.0
+	if err != nil {
+		success = 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.set("gomgr_run_duration_seconds", "gauge", "Wall-clock duration of the run.", end.Sub(r.start).Seconds())
+	r.set("gomgr_run_timestamp_seconds", "gauge", "Unix time the run finished.", float64(end.UnixNano())/1e9)
+	r.set("gomgr_run_success", "gauge", "1 if the run finished without error, 0 otherwise.", success)
+}
+
+// declare registers a metric family; the first declaration wins.
+func (r *Run) declare(name, typ, help string) *family {
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{help: help, typ: typ, samples: map[string]float64{}}
+		r.families[name] = f
+	}
+	return f
+}
+
+func (r *Run) set(name, typ, help string, v float64, labels ...string) {
+	r.declare(name, typ, help).samples[renderLabels(labels)] = v
+}
+
+func (r *Run) add(name string, v float64, labels ...string) {
+	r.families[name].samples[renderLabels(labels)] += v
+}
+
+// renderLabels formats key/value pairs as {k="v",…} in the given order.
+func renderLabels(kv []string) string {
+	if len(kv) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(kv); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, kv[i], labelEscaper.Replace(kv[i+1]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// labelEscaper applies the only three escapes the text format defines for
+// label values.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WriteText writes every metric in the Prometheus text format, families and
+// samples sorted for stable output.
+func (r *Run) WriteText(w io.Writer) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b bytes.Buffer
+	for _, name := range names {
+		f := r.families[name]
+		if len(f.samples) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, f.help, name, f.typ)
+		keys := make([]string, 0, len(f.samples))
+		for k := range f.samples {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(&b, "%s%s %s\n", name, k, strconv.FormatFloat(f.samples[k], 'g', -1, 64))
+		}
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// WriteFile writes the metrics to path for node_exporter's textfile
+// collector. The file is written next to path and renamed into place so the
+// collector never reads a partial file.
+func (r *Run) WriteFile(path string) error {
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("write metrics: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("write metrics: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write metrics: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil { //nolint:gosec // metrics are meant to be world-readable
+		return fmt.Errorf("write metrics: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("write metrics: %w", err)
+	}
+	return nil
+}
+
+// Push replaces the metrics of job on the Pushgateway at gatewayURL (PUT
+// /metrics/job/<job>), so metrics a previous run exported but this one did
+// not are dropped.
+func (r *Run) Push(ctx context.Context, gatewayURL, job string) error {
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		return err
+	}
+	target := strings.TrimRight(gatewayURL, "/") + "/metrics/job/" + url.PathEscape(job)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, target, &buf)
+	if err != nil {
+		return fmt.Errorf("push metrics: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := (&http.Client{Timeout: 10 * time.Second}).Do(req)
+	if err != nil {
+		return fmt.Errorf("push metrics: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("push metrics: status %d from %s", resp.StatusCode, target)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DragonSecurity/gomgr/internal/util"
+)
+
+func testRun() *Run {
+	r := NewRun()
+	start := time.Unix(1700000000, 0)
+	r.start = start
+	r.now = func() time.Time { return start.Add(1500 * time.Millisecond) }
+	r.ObservePlan(util.Plan{
+		Changes: []util.Change{
+			{Scope: "team", Action: "create"},
+			{Scope: "team", Action: "create"},
+			{Scope: "repo-file", Action: "update"},
+		},
+		Warnings: []string{"w"},
+		Stats:    &util.StateStats{Teams: util.StatePair{Current: 2, Desired: 4}},
+	})
+	r.RecordApply(util.Change{Scope: "team"}, nil)
+	r.RecordApply(util.Change{Scope: "team"}, nil)
+	r.RecordApply(util.Change{Scope: "repo-file"}, errors.New("boom"))
+	r.Finish(nil)
+	return r
+}
+
+func TestWriteText(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testRun().WriteText(&buf); err != nil {
+		t.Fatalf("WriteText: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"# TYPE gomgr_plan_changes gauge\n",
+		`gomgr_plan_changes{scope="team",action="create"} 2`,
+		`gomgr_plan_changes{scope="repo-file",action="update"} 1`,
+		"gomgr_plan_warnings 1\n",
+		`gomgr_state_current{resource="teams"} 2`,
+		`gomgr_state_desired{resource="teams"} 4`,
+		"# TYPE gomgr_apply_changes_total counter\n",
+		`gomgr_apply_changes_total{handler="team",result="success"} 2`,
+		`gomgr_apply_changes_total{handler="repo-file",result="failure"} 1`,
+		"gomgr_run_duration_seconds 1.5\n",
+		"gomgr_run_timestamp_seconds 1.7000000015e+09\n",
+		"gomgr_run_success 1\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestRenderLabels_Escapes(t *testing.T) {
+	got := renderLabels([]string{"endpoint", "a\"b\\c\nd"})
+	want := `{endpoint="a\"b\\c\nd"}`
+	if got != want {
+		t.Errorf("renderLabels = %s, want %s", got, want)
+	}
+}
+
+func TestNilRun(t *testing.T) {
+	var r *Run
+	r.ObservePlan(util.Plan{})
+	r.RecordApply(util.Change{}, nil)
+	r.ObserveAPI(nil)
+	r.Finish(nil)
+	if err := r.WriteText(io.Discard); err != nil {
+		t.Fatalf("nil run should be a no-op, got %v", err)
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gomgr.prom")
+	if err := testRun().WriteFile(path); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !strings.Contains(string(b), "gomgr_run_success 1") {
+		t.Errorf("unexpected file content:\n%s", b)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("expected only the metrics file to remain, got %d entries", len(entries))
+	}
+}
+
+func TestPush(t *testing.T) {
+	var method, path, ctype, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path, ctype = r.Method, r.URL.Path, r.Header.Get("Content-Type")
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	if err := testRun().Push(context.Background(), server.URL+"/", "gomgr sync"); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	if method != http.MethodPut || path != "/metrics/job/gomgr sync" {
+		t.Errorf("got %s %s, want PUT /metrics/job/gomgr sync", method, path)
+	}
+	if !strings.HasPrefix(ctype, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ctype)
+	}
+	if !strings.Contains(body, "gomgr_plan_warnings 1") {
+		t.Errorf("unexpected body:\n%s", body)
+	}
+}
+
+func TestPush_StatusError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	err := testRun().Push(context.Background(), server.URL, "gomgr")
+	if err == nil || !strings.Contains(err.Error(), "status 400") {
+		t.Fatalf("expected status error, got %v", err)
+	}
+}
@@ -0,0 +1,278 @@
+// Package notify posts a summary of a sync run to Slack-compatible incoming
+// webhooks and generic JSON webhooks.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/DragonSecurity/gomgr/internal/audit"
+	"github.com/DragonSecurity/gomgr/internal/config"
+	"github.com/DragonSecurity/gomgr/internal/util"
+)
+
+// maxListed caps how many changes, failures or warnings the default Slack
+// message lists; the rest are summarized as "…and N more".
+const maxListed = 20
+
+// Failure is a change whose handler returned an error.
+type Failure struct {
+	Change util.Change `json:"change"`
+	Error  string      `json:"error"`
+}
+
+// Summary describes a finished sync run. It is the data custom templates are
+// rendered with and the default body of generic webhooks.
+type Summary struct {
+	Org      string        `json:"org"`
+	RunID    string        `json:"run_id,omitempty"`
+	Duration time.Duration `json:"duration_ns"`
+	// Scope names the part of the org a scoped run (gomgr serve) covered.
+	Scope   string        `json:"scope,omitempty"`
+	Applied []util.Change `json:"applied"`
+	Failed  []Failure     `json:"failed"`
+	// Planned lists drift that was found but deliberately not applied
+	// (gomgr serve in report mode).
+	Planned []util.Change `json:"planned,omitempty"`
+	// Declined lists deletes and removals the operator turned down when
+	// asked to approve them.
+	Declined []util.Change `json:"declined,omitempty"`
+	Warnings []string      `json:"warnings"`
+	// Error is the run's overall error (plan failure, aborted apply), if any.
+	Error string `json:"error,omitempty"`
+
+	mu sync.Mutex
+}
+
+// Record adds the outcome of one applied change; it matches
+// sync.ApplyOptions.OnChange. Details are redacted the same way as in the
+// audit trail, since webhook payloads leave the building.
+func (s *Summary) Record(ch util.Change, err error) {
+	ch.Details = audit.Redact(ch.Details)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.Failed = append(s.Failed, Failure{Change: ch, Error: err.Error()})
+		return
+	}
+	s.Applied = append(s.Applied, ch)
+}
+
+// RecordPlanned adds changes that were found but not applied, redacted like
+// Record's.
+func (s *Summary) RecordPlanned(changes []util.Change) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ch := range changes {
+		ch.Details = audit.Redact(ch.Details)
+		s.Planned = append(s.Planned, ch)
+	}
+}
+
+// RecordDeclined adds a change that was skipped because it was not approved,
+// redacted like Record's.
+func (s *Summary) RecordDeclined(ch util.Change) {
+	ch.Details = audit.Redact(ch.Details)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Declined = append(s.Declined, ch)
+}
+
+// Changed reports whether the run applied, attempted or reported any change.
+func (s *Summary) Changed() bool {
+	return len(s.Applied) > 0 || len(s.Failed) > 0 || len(s.Planned) > 0 || len(s.Declined) > 0
+}
+
+// HasFailure reports whether any change failed or the run errored.
+func (s *Summary) HasFailure() bool { return len(s.Failed) > 0 || s.Error != "" }
+
+// Notifier sends summaries to one configured target.
+type Notifier struct {
+	cfg    config.NotificationConfig
+	tmpl   *template.Template
+	client *http.Client
+}
+
+// funcs are available to notification templates.
+var funcs = template.FuncMap{
+	"join": strings.Join,
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// New builds a Notifier per configured target, parsing templates up front so
+// a broken template fails the command before anything is applied.
+func New(cfgs []config.NotificationConfig) ([]*Notifier, error) {
+	out := make([]*Notifier, 0, len(cfgs))
+	for i, c := range cfgs {
+		n := &Notifier{cfg: c, client: &http.Client{Timeout: 10 * time.Second}}
+		if c.Template != "" {
+			t, err := template.New(fmt.Sprintf("notification-%d", i)).Funcs(funcs).Parse(c.Template)
+			if err != nil {
+				return nil, fmt.Errorf("app.notifications[%d]: parse template: %w", i, err)
+			}
+			n.tmpl = t
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+// wants applies the only_on_change / only_on_failure filters.
+func (n *Notifier) wants(s *Summary) bool {
+	if n.cfg.OnlyOnChange && !s.Changed() && !s.HasFailure() {
+		return false
+	}
+	if n.cfg.OnlyOnFailure && !s.HasFailure() {
+		return false
+	}
+	return true
+}
+
+// Send delivers s unless the target's filters exclude it.
+func (n *Notifier) Send(ctx context.Context, s *Summary) error {
+	if !n.wants(s) {
+		return nil
+	}
+	body, err := n.body(s)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, os.ExpandEnv(n.cfg.URL), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("notify %s: %w", n.cfg.Type, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range n.cfg.Headers {
+		req.Header.Set(k, os.ExpandEnv(v))
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("notify %s: %w", n.cfg.Type, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("notify %s: status %d", n.cfg.Type, resp.StatusCode)
+	}
+	return nil
+}
+
+// body renders the request payload: the template (or default text) wrapped
+// as {"text": …} for Slack, and the template output or JSON summary as-is
+// for generic webhooks.
+func (n *Notifier) body(s *Summary) ([]byte, error) {
+	var text string
+	if n.tmpl != nil {
+		var buf bytes.Buffer
+		if err := n.tmpl.Execute(&buf, s); err != nil {
+			return nil, fmt.Errorf("notify %s: render template: %w", n.cfg.Type, err)
+		}
+		text = buf.String()
+	}
+	if n.cfg.Type == config.NotifySlack {
+		if n.tmpl == nil {
+			text = slackText(s)
+		}
+		return json.Marshal(map[string]string{"text": text})
+	}
+	if n.tmpl != nil {
+		return []byte(text), nil
+	}
+	return json.Marshal(s)
+}
+
+// slackText is the default Slack message: a one-line headline followed by
+// bulleted failures, changes and warnings in Slack mrkdwn.
+func slackText(s *Summary) string {
+	var b strings.Builder
+	icon := ":white_check_mark:"
+	if s.HasFailure() {
+		icon = ":x:"
+	}
+	target := s.Org
+	if s.Scope != "" {
+		target += " (" + s.Scope + ")"
+	}
+	fmt.Fprintf(&b, "%s gomgr sync for *%s*: %d applied, %d failed, %d warning(s) in %s\n",
+		icon, target, len(s.Applied), len(s.Failed), len(s.Warnings), s.Duration.Round(time.Second))
+	if s.Error != "" {
+		fmt.Fprintf(&b, "*Error:* %s\n", s.Error)
+	}
+	if len(s.Failed) > 0 {
+		b.WriteString("*Failed*\n")
+		for i, f := range s.Failed {
+			if i == maxListed {
+				fmt.Fprintf(&b, "…and %d more\n", len(s.Failed)-maxListed)
+				break
+			}
+			fmt.Fprintf(&b, "• `%s:%s` %s — %s\n", f.Change.Scope, f.Change.Action, f.Change.Target, f.Error)
+		}
+	}
+	if len(s.Applied) > 0 {
+		b.WriteString("*Applied*\n")
+		for i, ch := range s.Applied {
+			if i == maxListed {
+				fmt.Fprintf(&b, "…and %d more\n", len(s.Applied)-maxListed)
+				break
+			}
+			fmt.Fprintf(&b, "• `%s:%s` %s\n", ch.Scope, ch.Action, ch.Target)
+		}
+	}
+	if len(s.Planned) > 0 {
+		b.WriteString("*Drift (not applied)*\n")
+		for i, ch := range s.Planned {
+			if i == maxListed {
+				fmt.Fprintf(&b, "…and %d more\n", len(s.Planned)-maxListed)
+				break
+			}
+			fmt.Fprintf(&b, "• `%s:%s` %s\n", ch.Scope, ch.Action, ch.Target)
+		}
+	}
+	if len(s.Declined) > 0 {
+		b.WriteString("*Declined (not applied)*\n")
+		for i, ch := range s.Declined {
+			if i == maxListed {
+				fmt.Fprintf(&b, "…and %d more\n", len(s.Declined)-maxListed)
+				break
+			}
+			fmt.Fprintf(&b, "• `%s:%s` %s\n", ch.Scope, ch.Action, ch.Target)
+		}
+	}
+	if len(s.Warnings) > 0 {
+		b.WriteString("*Warnings*\n")
+		for i, w := range s.Warnings {
+			if i == maxListed {
+				fmt.Fprintf(&b, "…and %d more\n", len(s.Warnings)-maxListed)
+				break
+			}
+			fmt.Fprintf(&b, "• %s\n", w)
+		}
+	}
+	if s.RunID != "" {
+		fmt.Fprintf(&b, "_run %s_\n", s.RunID)
+	}
+	return b.String()
+}
+
+// SendAll delivers s to every notifier. Delivery problems are warned about
+// rather than returned: a flaky chat webhook must not fail a sync that
+// already changed the org.
+func SendAll(ctx context.Context, notifiers []*Notifier, s *Summary) {
+	for _, n := range notifiers {
+		if err := n.Send(ctx, s); err != nil {
+			util.Warnf("%v", err)
+		}
+	}
+}
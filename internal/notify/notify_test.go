@@ -0,0 +1,167 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DragonSecurity/gomgr/internal/config"
+	"github.com/DragonSecurity/gomgr/internal/util"
+)
+
+// capture returns a server recording the last request body and headers.
+func capture(t *testing.T, status int) (*httptest.Server, *[]byte, *http.Header) {
+	t.Helper()
+	var body []byte
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		header = r.Header.Clone()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, &body, &header
+}
+
+func testSummary() *Summary {
+	s := &Summary{Org: "acme", RunID: "run-1", Warnings: []string{"team x has no members"}}
+	s.Record(util.Change{Scope: "team", Target: "backend", Action: "create"}, nil)
+	s.Record(util.Change{Scope: "repo-file", Target: "api:README.md", Action: "update",
+		Details: map[string]any{"token": "s3cr3t"}}, nil)
+	s.Record(util.Change{Scope: "team-repo", Target: "backend:api", Action: "set"}, errors.New("boom"))
+	s.RecordDeclined(util.Change{Scope: "repo", Target: "legacy", Action: "delete"})
+	return s
+}
+
+func newNotifier(t *testing.T, cfg config.NotificationConfig) *Notifier {
+	t.Helper()
+	ns, err := New([]config.NotificationConfig{cfg})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return ns[0]
+}
+
+func TestSend_SlackDefaultText(t *testing.T) {
+	server, body, _ := capture(t, http.StatusOK)
+	n := newNotifier(t, config.NotificationConfig{Type: config.NotifySlack, URL: server.URL})
+	if err := n.Send(context.Background(), testSummary()); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	var msg map[string]string
+	if err := json.Unmarshal(*body, &msg); err != nil {
+		t.Fatalf("slack body is not JSON: %v", err)
+	}
+	for _, want := range []string{
+		":x: gomgr sync for *acme*: 2 applied, 1 failed, 1 warning(s)",
+		"`team-repo:set` backend:api — boom",
+		"`team:create` backend",
+		"*Declined (not applied)*\n• `repo:delete` legacy",
+		"team x has no members",
+		"_run run-1_",
+	} {
+		if !strings.Contains(msg["text"], want) {
+			t.Errorf("text missing %q:\n%s", want, msg["text"])
+		}
+	}
+}
+
+func TestSend_WebhookJSONSummary(t *testing.T) {
+	t.Setenv("NOTIFY_TOKEN", "abc")
+	server, body, header := capture(t, http.StatusNoContent)
+	n := newNotifier(t, config.NotificationConfig{
+		Type:    config.NotifyWebhook,
+		URL:     server.URL,
+		Headers: map[string]string{"Authorization": "Bearer ${NOTIFY_TOKEN}"},
+	})
+	if err := n.Send(context.Background(), testSummary()); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if got := header.Get("Authorization"); got != "Bearer abc" {
+		t.Errorf("Authorization = %q, want expanded token", got)
+	}
+	if strings.Contains(string(*body), "s3cr3t") {
+		t.Errorf("secret leaked into webhook payload: %s", *body)
+	}
+	var got struct {
+		Org     string        `json:"org"`
+		Applied []util.Change `json:"applied"`
+		Failed  []Failure     `json:"failed"`
+	}
+	if err := json.Unmarshal(*body, &got); err != nil {
+		t.Fatalf("webhook body is not JSON: %v", err)
+	}
+	if got.Org != "acme" || len(got.Applied) != 2 || len(got.Failed) != 1 || got.Failed[0].Error != "boom" {
+		t.Errorf("unexpected payload: %+v", got)
+	}
+}
+
+func TestSend_Template(t *testing.T) {
+	server, body, _ := capture(t, http.StatusOK)
+	n := newNotifier(t, config.NotificationConfig{
+		Type:     config.NotifySlack,
+		URL:      server.URL,
+		Template: `{{.Org}}: {{len .Applied}} ok{{if .HasFailure}}, failures: {{range .Failed}}{{.Change.Target}} {{end}}{{end}}`,
+	})
+	if err := n.Send(context.Background(), testSummary()); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	want := `{"text":"acme: 2 ok, failures: backend:api "}`
+	if string(*body) != want {
+		t.Errorf("body = %s, want %s", *body, want)
+	}
+}
+
+func TestSend_Filters(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.NotificationConfig
+		summary *Summary
+		want    bool
+	}{
+		{"only on change, no changes", config.NotificationConfig{OnlyOnChange: true}, &Summary{}, false},
+		{"only on change, changes", config.NotificationConfig{OnlyOnChange: true}, testSummary(), true},
+		{"only on change, run error", config.NotificationConfig{OnlyOnChange: true}, &Summary{Error: "plan failed"}, true},
+		{"only on failure, success", config.NotificationConfig{OnlyOnFailure: true},
+			&Summary{Applied: []util.Change{{Scope: "team"}}}, false},
+		{"only on failure, failure", config.NotificationConfig{OnlyOnFailure: true}, testSummary(), true},
+		{"no filters, nothing happened", config.NotificationConfig{}, &Summary{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { called = true }))
+			defer server.Close()
+			tt.cfg.Type, tt.cfg.URL = config.NotifyWebhook, server.URL
+			if err := newNotifier(t, tt.cfg).Send(context.Background(), tt.summary); err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+			if called != tt.want {
+				t.Errorf("sent = %v, want %v", called, tt.want)
+			}
+		})
+	}
+}
+
+func TestSend_StatusError(t *testing.T) {
+	server, _, _ := capture(t, http.StatusInternalServerError)
+	n := newNotifier(t, config.NotificationConfig{Type: config.NotifyWebhook, URL: server.URL})
+	err := n.Send(context.Background(), testSummary())
+	if err == nil || !strings.Contains(err.Error(), "status 500") {
+		t.Fatalf("expected status error, got %v", err)
+	}
+}
+
+func TestNew_InvalidTemplate(t *testing.T) {
+	_, err := New([]config.NotificationConfig{{Type: config.NotifySlack, URL: "https://x", Template: "{{.Org"}})
+	if err == nil || !strings.Contains(err.Error(), "app.notifications[0]") {
+		t.Fatalf("expected template parse error, got %v", err)
+	}
+}
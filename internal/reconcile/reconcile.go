@@ -0,0 +1,264 @@
+// Package reconcile implements `gomgr reconcile`: a long-running loop that
+// plans and applies the config directory on a jittered interval, reloads
+// the config when its files change, and reports the last run over HTTP.
+//
+// Runs never overlap: a single goroutine owns the loop, and a run that is
+// in flight when the loop is stopped is allowed to finish.
+package reconcile
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/DragonSecurity/gomgr/internal/config"
+	"github.com/DragonSecurity/gomgr/internal/util"
+)
+
+// Options configures a Reconciler.
+type Options struct {
+	// Interval is the time between the end of one run and the start of the
+	// next, before jitter.
+	Interval time.Duration
+	// Jitter spreads runs by up to ±Jitter×Interval (0 ≤ Jitter < 1) so
+	// several instances do not hit the API in lockstep.
+	Jitter float64
+	// PollInterval is how often the config is checked for changes; it
+	// defaults to 5s.
+	PollInterval time.Duration
+
+	// Fingerprint identifies the current config contents; a new value
+	// triggers Load. See config.Fingerprint.
+	Fingerprint func() (string, error)
+	// Load reads and validates the config.
+	Load func() (*config.Root, error)
+	// Reconcile runs one plan/apply pass. Its context is not cancelled when
+	// the loop stops, so an apply in progress completes; bound it with a
+	// timeout instead.
+	Reconcile func(ctx context.Context, cfg *config.Root) (Result, error)
+}
+
+// Result is what one pass reports back.
+type Result struct {
+	Plan    util.Plan
+	Applied int
+	Failed  int
+}
+
+// Run describes one reconcile pass.
+type Run struct {
+	Started  time.Time     `json:"started"`
+	Finished time.Time     `json:"finished"`
+	Duration time.Duration `json:"duration_ns"`
+	Changes  int           `json:"changes"`
+	Applied  int           `json:"applied"`
+	Failed   int           `json:"failed"`
+	Warnings int           `json:"warnings"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Status is served at /status.
+type Status struct {
+	Org       string    `json:"org"`
+	Running   bool      `json:"running"`
+	Runs      int       `json:"runs"`
+	NextRun   time.Time `json:"next_run,omitzero"`
+	LastRun   *Run      `json:"last_run,omitempty"`
+	ConfigSHA string    `json:"config_sha"`
+	// ConfigLoaded is when the config in use was loaded. ConfigError is set
+	// while the files on disk fail to load; the previous config stays in use.
+	ConfigLoaded time.Time `json:"config_loaded"`
+	ConfigError  string    `json:"config_error,omitempty"`
+}
+
+// Reconciler runs the loop.
+type Reconciler struct {
+	opts Options
+
+	mu       sync.Mutex
+	cfg      *config.Root
+	seen     string // last fingerprint looked at, loadable or not
+	status   Status
+	lastPlan *util.Plan
+}
+
+// New loads the initial config; an invalid config is an error here, while
+// later reload failures keep the last good config.
+func New(opts Options) (*Reconciler, error) {
+	if opts.Interval <= 0 {
+		return nil, errors.New("reconcile: interval must be positive")
+	}
+	if opts.Jitter < 0 || opts.Jitter >= 1 {
+		return nil, fmt.Errorf("reconcile: jitter %v must be in [0, 1)", opts.Jitter)
+	}
+	if opts.PollInterval == 0 {
+		opts.PollInterval = 5 * time.Second
+	}
+	r := &Reconciler{opts: opts}
+	fp, err := opts.Fingerprint()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := opts.Load()
+	if err != nil {
+		return nil, err
+	}
+	r.cfg, r.seen = cfg, fp
+	r.status.Org = cfg.App.Org
+	r.status.ConfigSHA = fp
+	r.status.ConfigLoaded = time.Now()
+	return r, nil
+}
+
+// Run reconciles immediately and then every interval until ctx is
+// cancelled, running early when the config changes.
+func (r *Reconciler) Run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	poll := time.NewTicker(r.opts.PollInterval)
+	defer poll.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-poll.C:
+			if r.reload() {
+				timer.Reset(0)
+			}
+			continue
+		case <-timer.C:
+		}
+		r.reload()
+		r.runOnce(ctx)
+		next := r.nextDelay()
+		r.mu.Lock()
+		r.status.NextRun = time.Now().Add(next)
+		r.mu.Unlock()
+		timer.Reset(next)
+	}
+}
+
+// reload loads the config when its fingerprint changed and reports whether
+// a new config is now in use.
+func (r *Reconciler) reload() bool {
+	fp, err := r.opts.Fingerprint()
+	if err != nil {
+		util.Warnf("reconcile: %v", err)
+		return false
+	}
+	r.mu.Lock()
+	unchanged := fp == r.seen
+	r.seen = fp
+	r.mu.Unlock()
+	if unchanged {
+		return false
+	}
+
+	cfg, err := r.opts.Load()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		util.Warnf("reconcile: config changed but does not load, keeping the previous one: %v", err)
+		r.status.ConfigError = err.Error()
+		return false
+	}
+	slog.Info("reconcile: config reloaded", "config_sha", fp)
+	r.cfg = cfg
+	r.status.Org = cfg.App.Org
+	r.status.ConfigSHA = fp
+	r.status.ConfigLoaded = time.Now()
+	r.status.ConfigError = ""
+	return true
+}
+
+func (r *Reconciler) runOnce(ctx context.Context) {
+	r.mu.Lock()
+	cfg := r.cfg
+	r.status.Running = true
+	r.mu.Unlock()
+
+	run := &Run{Started: time.Now()}
+	res, err := r.opts.Reconcile(context.WithoutCancel(ctx), cfg)
+	run.Finished = time.Now()
+	run.Duration = run.Finished.Sub(run.Started)
+	run.Changes = len(res.Plan.Changes)
+	run.Warnings = len(res.Plan.Warnings)
+	run.Applied, run.Failed = res.Applied, res.Failed
+	if err != nil {
+		run.Error = err.Error()
+		util.Warnf("reconcile: run failed: %v", err)
+	} else {
+		slog.Info("reconcile: run finished", "changes", run.Changes, "applied", run.Applied,
+			"failed", run.Failed, "duration", run.Duration.Round(time.Millisecond))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status.Running = false
+	r.status.Runs++
+	r.status.LastRun = run
+	if res.Plan.Changes != nil || res.Plan.Stats != nil {
+		plan := res.Plan
+		r.lastPlan = &plan
+	}
+}
+
+// nextDelay is Interval spread by ±Jitter.
+func (r *Reconciler) nextDelay() time.Duration {
+	if r.opts.Jitter == 0 {
+		return r.opts.Interval
+	}
+	spread := (rand.Float64()*2 - 1) * r.opts.Jitter //nolint:gosec // scheduling jitter, not security sensitive
+	return r.opts.Interval + time.Duration(spread*float64(r.opts.Interval))
+}
+
+// Status returns a snapshot of the loop's state.
+func (r *Reconciler) Status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.status
+	if s.LastRun != nil {
+		last := *s.LastRun
+		s.LastRun = &last
+	}
+	return s
+}
+
+// Handler serves /status (the Status as JSON), /plan (the last plan built,
+// 404 before the first) and /healthz. None of them is authenticated, and
+// /plan carries member logins and rendered file contents, so callers should
+// only listen on a trusted interface.
+func (r *Reconciler) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, r.Status())
+	})
+	mux.HandleFunc("GET /plan", func(w http.ResponseWriter, _ *http.Request) {
+		r.mu.Lock()
+		plan := r.lastPlan
+		r.mu.Unlock()
+		if plan == nil {
+			http.Error(w, "no plan yet", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, plan)
+	})
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("ok\n"))
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
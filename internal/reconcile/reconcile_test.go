@@ -0,0 +1,226 @@
+package reconcile
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DragonSecurity/gomgr/internal/config"
+	"github.com/DragonSecurity/gomgr/internal/util"
+)
+
+// fakeConfig is a config directory whose fingerprint and contents tests
+// can change.
+type fakeConfig struct {
+	mu      sync.Mutex
+	fp      string
+	org     string
+	loadErr error
+}
+
+func (f *fakeConfig) set(fp, org string, loadErr error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fp, f.org, f.loadErr = fp, org, loadErr
+}
+
+func (f *fakeConfig) options() Options {
+	return Options{
+		Interval:     time.Hour,
+		PollInterval: 5 * time.Millisecond,
+		Fingerprint: func() (string, error) {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			return f.fp, nil
+		},
+		Load: func() (*config.Root, error) {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			if f.loadErr != nil {
+				return nil, f.loadErr
+			}
+			return &config.Root{App: config.AppConfig{Org: f.org}}, nil
+		},
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestNew_Validates(t *testing.T) {
+	f := &fakeConfig{fp: "a", org: "acme"}
+	tests := []struct {
+		name   string
+		modify func(*Options)
+	}{
+		{"zero interval", func(o *Options) { o.Interval = 0 }},
+		{"jitter too large", func(o *Options) { o.Jitter = 1 }},
+		{"negative jitter", func(o *Options) { o.Jitter = -0.1 }},
+		{"config does not load", func(o *Options) {
+			o.Load = func() (*config.Root, error) { return nil, errors.New("bad yaml") }
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := f.options()
+			tt.modify(&opts)
+			if _, err := New(opts); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestRun_ReloadsConfigAndServesStatus(t *testing.T) {
+	f := &fakeConfig{fp: "a", org: "acme"}
+	var mu sync.Mutex
+	var orgs []string
+	opts := f.options()
+	opts.Reconcile = func(_ context.Context, cfg *config.Root) (Result, error) {
+		mu.Lock()
+		orgs = append(orgs, cfg.App.Org)
+		mu.Unlock()
+		return Result{Plan: util.Plan{Changes: []util.Change{{Scope: "team", Target: "web", Action: "create"}}}, Applied: 1}, nil
+	}
+	r, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() { r.Run(ctx); close(done) }()
+	defer func() { cancel(); <-done }()
+
+	waitFor(t, "the first run", func() bool { return r.Status().Runs == 1 })
+
+	// A config that fails to load is reported but does not trigger a run.
+	f.set("b", "broken", errors.New("bad yaml"))
+	waitFor(t, "the config error", func() bool { return r.Status().ConfigError != "" })
+	if r.Status().Runs != 1 {
+		t.Errorf("a broken config should not trigger a run")
+	}
+
+	// A loadable change triggers a run with the new config right away,
+	// long before the hour-long interval.
+	f.set("c", "acme-renamed", nil)
+	waitFor(t, "the reload run", func() bool { return r.Status().Runs == 2 })
+
+	mu.Lock()
+	if len(orgs) != 2 || orgs[1] != "acme-renamed" {
+		t.Errorf("runs saw orgs %v", orgs)
+	}
+	mu.Unlock()
+
+	st := r.Status()
+	if st.ConfigError != "" || st.ConfigSHA != "c" || st.Org != "acme-renamed" {
+		t.Errorf("status after reload = %+v", st)
+	}
+	if st.LastRun == nil || st.LastRun.Changes != 1 || st.LastRun.Applied != 1 {
+		t.Errorf("last run = %+v", st.LastRun)
+	}
+	if d := time.Until(st.NextRun); d < 59*time.Minute || d > time.Hour {
+		t.Errorf("next run in %v, want about an hour", d)
+	}
+
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Status
+	err = json.NewDecoder(resp.Body).Decode(&got)
+	_ = resp.Body.Close()
+	if err != nil || got.Runs != 2 {
+		t.Errorf("/status = %+v, %v", got, err)
+	}
+	resp, err = http.Get(srv.URL + "/plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var plan util.Plan
+	err = json.NewDecoder(resp.Body).Decode(&plan)
+	_ = resp.Body.Close()
+	if err != nil || len(plan.Changes) != 1 {
+		t.Errorf("/plan = %+v, %v", plan, err)
+	}
+}
+
+func TestRun_WaitsForInFlightRun(t *testing.T) {
+	f := &fakeConfig{fp: "a", org: "acme"}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var runCtxErr error
+	opts := f.options()
+	opts.Reconcile = func(ctx context.Context, _ *config.Root) (Result, error) {
+		close(started)
+		<-release
+		runCtxErr = ctx.Err()
+		return Result{}, nil
+	}
+	r, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() { r.Run(ctx); close(done) }()
+
+	<-started
+	cancel()
+	select {
+	case <-done:
+		t.Fatal("Run returned while a reconcile was in flight")
+	case <-time.After(20 * time.Millisecond):
+	}
+	if !r.Status().Running {
+		t.Error("status should report the run in flight")
+	}
+	close(release)
+	<-done
+	if runCtxErr != nil {
+		t.Errorf("the in-flight run's context was cancelled: %v", runCtxErr)
+	}
+}
+
+func TestNextDelay(t *testing.T) {
+	r := &Reconciler{opts: Options{Interval: 10 * time.Minute, Jitter: 0.2}}
+	for range 100 {
+		d := r.nextDelay()
+		if d < 8*time.Minute || d > 12*time.Minute {
+			t.Fatalf("nextDelay = %v, want within 10m ± 20%%", d)
+		}
+	}
+	r.opts.Jitter = 0
+	if d := r.nextDelay(); d != 10*time.Minute {
+		t.Errorf("nextDelay without jitter = %v", d)
+	}
+}
+
+func TestPlanNotFoundBeforeFirstRun(t *testing.T) {
+	f := &fakeConfig{fp: "a", org: "acme"}
+	r, err := New(f.options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/plan", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("/plan before the first run = %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,322 @@
+// Package server implements `gomgr serve`: an HTTP endpoint for GitHub
+// organization webhooks that re-plans the team or repository an event
+// touched and reports or reverts the drift.
+//
+// Webhook deliveries are acknowledged immediately and queued; a single
+// worker plans them one at a time. Events that arrive while a plan runs are
+// merged into one pending scope, so a burst of deliveries (a bulk team
+// change in the UI) costs one extra plan, not one per event.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/go-github/v88/github"
+
+	"github.com/DragonSecurity/gomgr/internal/config"
+	"github.com/DragonSecurity/gomgr/internal/notify"
+	insync "github.com/DragonSecurity/gomgr/internal/sync"
+	"github.com/DragonSecurity/gomgr/internal/util"
+)
+
+// maxPayloadBytes is GitHub's own cap on webhook payloads.
+const maxPayloadBytes = 25 << 20
+
+// Options configures a Server.
+type Options struct {
+	Org    string
+	Secret []byte
+	// Mode is config.ServerModeReport (default) or config.ServerModeApply.
+	Mode string
+	// Path is where webhooks are received; defaults to "/webhook".
+	Path string
+	// Timeout bounds each plan (and apply).
+	Timeout time.Duration
+
+	// Plan builds the plan for a scope.
+	Plan func(ctx context.Context, scope insync.Scope) (util.Plan, error)
+	// Apply applies a plan in apply mode, reporting each change to onChange.
+	Apply func(ctx context.Context, plan util.Plan, onChange func(util.Change, error)) error
+
+	Notifiers []*notify.Notifier
+}
+
+// Server receives webhooks and runs scoped plans for them.
+type Server struct {
+	opts Options
+
+	mu      sync.Mutex
+	pending *pendingScope
+	wake    chan struct{}
+	ready   atomic.Bool
+}
+
+// New returns a Server; call Run to start processing and serve Handler.
+func New(opts Options) *Server {
+	if opts.Path == "" {
+		opts.Path = "/webhook"
+	}
+	if opts.Mode == "" {
+		opts.Mode = config.ServerModeReport
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 10 * time.Minute
+	}
+	return &Server{opts: opts, wake: make(chan struct{}, 1)}
+}
+
+// Handler serves the webhook endpoint plus /healthz (the process is up) and
+// /readyz (the worker is accepting events).
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+s.opts.Path, s.handleWebhook)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, _ *http.Request) {
+		if !s.ready.Load() {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok\n"))
+	})
+	return mux
+}
+
+func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxPayloadBytes)
+	payload, err := github.ValidatePayload(r, s.opts.Secret)
+	if err != nil {
+		util.Warnf("webhook: rejected delivery %s: %v", r.Header.Get("X-GitHub-Delivery"), err)
+		http.Error(w, "invalid signature or payload", http.StatusUnauthorized)
+		return
+	}
+	event := github.WebHookType(r)
+	delivery := r.Header.Get("X-GitHub-Delivery")
+	if event == "ping" {
+		_, _ = w.Write([]byte("pong\n"))
+		return
+	}
+
+	scope, ok, err := scopeForEvent(event, payload, s.opts.Org)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !ok {
+		util.Debugf("webhook: ignoring %s event (delivery %s)", event, delivery)
+		_, _ = w.Write([]byte("ignored\n"))
+		return
+	}
+	slog.Info("webhook: queued scoped plan", "event", event, "delivery", delivery, "scope", scope.String())
+	s.enqueue(scope)
+	w.WriteHeader(http.StatusAccepted)
+	_, _ = w.Write([]byte("queued\n"))
+}
+
+// eventPayload holds the fields of an org webhook payload that pick the
+// scope to re-plan.
+type eventPayload struct {
+	Action       string `json:"action"`
+	Organization *struct {
+		Login string `json:"login"`
+	} `json:"organization"`
+	Team *struct {
+		Slug string `json:"slug"`
+	} `json:"team"`
+	Repository *struct {
+		Name string `json:"name"`
+	} `json:"repository"`
+}
+
+// scopeForEvent maps a webhook to the scope it can have changed. ok is false
+// for events gomgr does not manage or that belong to another org.
+func scopeForEvent(event string, payload []byte, org string) (insync.Scope, bool, error) {
+	var p eventPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return insync.Scope{}, false, fmt.Errorf("decode %s payload: %w", event, err)
+	}
+	if p.Organization == nil || !strings.EqualFold(p.Organization.Login, org) {
+		return insync.Scope{}, false, nil
+	}
+	scope := insync.Scope{Cleanups: true}
+	if p.Team != nil && p.Team.Slug != "" {
+		scope.Teams = []string{p.Team.Slug}
+	}
+	if p.Repository != nil && p.Repository.Name != "" {
+		scope.Repos = []string{p.Repository.Name}
+	}
+
+	switch event {
+	case "team", "membership", "team_add", "member", "repository":
+		if len(scope.Teams) == 0 && len(scope.Repos) == 0 {
+			return insync.Scope{}, false, nil
+		}
+		return scope, true, nil
+	case "custom_repository_role":
+		return insync.Scope{CustomRoles: true, Cleanups: true}, true, nil
+	case "organization":
+		// Someone joined or left the org outside gomgr: re-plan team
+		// memberships and member cleanups, nothing else. Invitations change
+		// nothing until they are accepted (member_added).
+		if p.Action != "member_added" && p.Action != "member_removed" {
+			return insync.Scope{}, false, nil
+		}
+		return insync.Scope{Phases: []string{insync.PhaseMembers}, Cleanups: true}, true, nil
+	}
+	return insync.Scope{}, false, nil
+}
+
+// pendingScope accumulates queued scopes until the worker takes them.
+// Members-phase plans cover every team's membership and cannot be folded
+// into a plan for named teams and repos, so they are tracked separately.
+type pendingScope struct {
+	teams       map[string]bool
+	repos       map[string]bool
+	customRoles bool
+	members     bool
+}
+
+func (s *Server) enqueue(scope insync.Scope) {
+	s.mu.Lock()
+	if s.pending == nil {
+		s.pending = &pendingScope{teams: map[string]bool{}, repos: map[string]bool{}}
+	}
+	p := s.pending
+	if slices.Contains(scope.Phases, insync.PhaseMembers) {
+		p.members = true
+	}
+	for _, t := range scope.Teams {
+		p.teams[strings.ToLower(t)] = true
+	}
+	for _, r := range scope.Repos {
+		p.repos[strings.ToLower(r)] = true
+	}
+	p.customRoles = p.customRoles || scope.CustomRoles
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default: // a wake-up is already queued
+	}
+}
+
+// take returns and clears the pending scopes: one for the named teams, repos
+// and custom roles, and one for the members phase.
+func (s *Server) take() []insync.Scope {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.pending
+	s.pending = nil
+	if p == nil {
+		return nil
+	}
+	var out []insync.Scope
+	if len(p.teams) > 0 || len(p.repos) > 0 || p.customRoles {
+		out = append(out, insync.Scope{
+			Teams:       sortedKeys(p.teams),
+			Repos:       sortedKeys(p.repos),
+			CustomRoles: p.customRoles,
+			Cleanups:    true,
+		})
+	}
+	if p.members {
+		out = append(out, insync.Scope{Phases: []string{insync.PhaseMembers}, Cleanups: true})
+	}
+	return out
+}
+
+func sortedKeys(m map[string]bool) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Run processes queued scopes until ctx is cancelled. A plan in progress is
+// finished first (bounded by Options.Timeout), so shutdown never leaves an
+// apply half done.
+func (s *Server) Run(ctx context.Context) {
+	s.ready.Store(true)
+	defer s.ready.Store(false)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		}
+		for _, scope := range s.take() {
+			s.process(context.WithoutCancel(ctx), scope)
+		}
+	}
+}
+
+// process plans scope and, depending on the mode, applies or reports the
+// result.
+func (s *Server) process(ctx context.Context, scope insync.Scope) {
+	ctx, cancel := context.WithTimeout(ctx, s.opts.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	summary := &notify.Summary{Org: s.opts.Org, Scope: scope.String()}
+	defer func() {
+		summary.Duration = time.Since(start)
+		notify.SendAll(ctx, s.opts.Notifiers, summary)
+	}()
+
+	plan, err := s.opts.Plan(ctx, scope)
+	if err != nil {
+		slog.Error(fmt.Sprintf("serve: plan %s: %v", scope, err), "scope", scope.String())
+		summary.Error = err.Error()
+		return
+	}
+	summary.Warnings = plan.Warnings
+	if len(plan.Changes) == 0 {
+		slog.Info("serve: no drift", "scope", scope.String())
+		return
+	}
+
+	if s.opts.Mode != config.ServerModeApply {
+		for _, ch := range plan.Changes {
+			slog.Warn(fmt.Sprintf("drift: %s:%s %s", ch.Scope, ch.Action, ch.Target),
+				"scope", ch.Scope, "target", ch.Target, "action", ch.Action)
+		}
+		summary.RecordPlanned(plan.Changes)
+		return
+	}
+
+	if err := s.opts.Apply(ctx, plan, summary.Record); err != nil {
+		slog.Error(fmt.Sprintf("serve: apply %s: %v", scope, err), "scope", scope.String())
+		if len(summary.Failed) == 0 {
+			summary.Error = err.Error()
+		}
+	}
+}
+
+// Secret resolves the webhook secret from server.webhook_secret (with ${VAR}
+// expanded) or GOMGR_WEBHOOK_SECRET. Serving unsigned webhooks would let
+// anyone trigger applies, so an empty secret is an error.
+func Secret(cfg config.ServerConfig) ([]byte, error) {
+	secret := os.ExpandEnv(cfg.WebhookSecret)
+	if secret == "" {
+		secret = os.Getenv("GOMGR_WEBHOOK_SECRET")
+	}
+	if secret == "" {
+		return nil, errors.New("serve: a webhook secret is required (server.webhook_secret or GOMGR_WEBHOOK_SECRET)")
+	}
+	return []byte(secret), nil
+}
@@ -0,0 +1,224 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DragonSecurity/gomgr/internal/config"
+	insync "github.com/DragonSecurity/gomgr/internal/sync"
+	"github.com/DragonSecurity/gomgr/internal/util"
+)
+
+var testSecret = []byte("s3cret")
+
+func sign(body string) string {
+	mac := hmac.New(sha256.New, testSecret)
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func deliver(t *testing.T, h http.Handler, event, body, signature string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-GitHub-Event", event)
+	req.Header.Set("X-GitHub-Delivery", "d-1")
+	if signature != "" {
+		req.Header.Set("X-Hub-Signature-256", signature)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandleWebhook(t *testing.T) {
+	teamBody := `{"action":"added","organization":{"login":"acme"},"team":{"slug":"platform"}}`
+	tests := []struct {
+		name      string
+		event     string
+		body      string
+		signature string
+		wantCode  int
+		wantQueue bool
+	}{
+		{"valid team event", "membership", teamBody, sign(teamBody), http.StatusAccepted, true},
+		{"bad signature", "membership", teamBody, "sha256=00", http.StatusUnauthorized, false},
+		{"missing signature", "membership", teamBody, "", http.StatusUnauthorized, false},
+		{"ping", "ping", `{"zen":"hi"}`, sign(`{"zen":"hi"}`), http.StatusOK, false},
+		{"other org", "membership", `{"organization":{"login":"other"},"team":{"slug":"x"}}`,
+			sign(`{"organization":{"login":"other"},"team":{"slug":"x"}}`), http.StatusOK, false},
+		{"unhandled event", "push", `{"organization":{"login":"acme"},"repository":{"name":"api"}}`,
+			sign(`{"organization":{"login":"acme"},"repository":{"name":"api"}}`), http.StatusOK, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(Options{Org: "acme", Secret: testSecret})
+			rec := deliver(t, s.Handler(), tt.event, tt.body, tt.signature)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tt.wantCode, rec.Body.String())
+			}
+			if queued := len(s.take()) > 0; queued != tt.wantQueue {
+				t.Errorf("queued = %v, want %v", queued, tt.wantQueue)
+			}
+		})
+	}
+}
+
+func TestScopeForEvent(t *testing.T) {
+	tests := []struct {
+		event   string
+		payload string
+		want    insync.Scope
+		wantOK  bool
+	}{
+		{"team", `{"organization":{"login":"ACME"},"team":{"slug":"platform"}}`,
+			insync.Scope{Teams: []string{"platform"}, Cleanups: true}, true},
+		{"team_add", `{"organization":{"login":"acme"},"team":{"slug":"platform"},"repository":{"name":"api"}}`,
+			insync.Scope{Teams: []string{"platform"}, Repos: []string{"api"}, Cleanups: true}, true},
+		{"member", `{"organization":{"login":"acme"},"repository":{"name":"api"}}`,
+			insync.Scope{Repos: []string{"api"}, Cleanups: true}, true},
+		{"repository", `{"organization":{"login":"acme"}}`, insync.Scope{}, false},
+		{"custom_repository_role", `{"action":"updated","organization":{"login":"acme"},"custom_repository_role":{"name":"release-manager"}}`,
+			insync.Scope{CustomRoles: true, Cleanups: true}, true},
+		{"custom_repository_role", `{"action":"created","organization":{"login":"other"}}`, insync.Scope{}, false},
+		{"organization", `{"action":"member_added","organization":{"login":"acme"}}`,
+			insync.Scope{Phases: []string{insync.PhaseMembers}, Cleanups: true}, true},
+		{"organization", `{"action":"member_invited","organization":{"login":"acme"}}`, insync.Scope{}, false},
+		{"organization", `{"action":"renamed","organization":{"login":"acme"}}`, insync.Scope{}, false},
+		{"issues", `{"organization":{"login":"acme"},"repository":{"name":"api"}}`, insync.Scope{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.event, func(t *testing.T) {
+			got, ok, err := scopeForEvent(tt.event, []byte(tt.payload), "acme")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.wantOK || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("scopeForEvent = %+v, %v; want %+v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestEnqueueCoalesces(t *testing.T) {
+	s := New(Options{Org: "acme"})
+	s.enqueue(insync.Scope{Teams: []string{"Platform"}, Cleanups: true})
+	s.enqueue(insync.Scope{Teams: []string{"platform"}, Repos: []string{"api"}, Cleanups: true})
+
+	got := s.take()
+	want := []insync.Scope{{Teams: []string{"platform"}, Repos: []string{"api"}, Cleanups: true}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("take = %+v; want %+v", got, want)
+	}
+	if got := s.take(); got != nil {
+		t.Error("pending scope not cleared by take")
+	}
+
+	// An org membership event plans the members phase on its own; it never
+	// widens a pending plan to the whole org.
+	members := insync.Scope{Phases: []string{insync.PhaseMembers}, Cleanups: true}
+	s.enqueue(insync.Scope{Teams: []string{"platform"}, Cleanups: true})
+	s.enqueue(members)
+	s.enqueue(members)
+	got = s.take()
+	want = []insync.Scope{{Teams: []string{"platform"}, Repos: []string{}, Cleanups: true}, members}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("take = %+v; want %+v", got, want)
+	}
+
+	// Custom role events fold into the named plan.
+	s.enqueue(insync.Scope{CustomRoles: true, Cleanups: true})
+	s.enqueue(insync.Scope{Repos: []string{"api"}, Cleanups: true})
+	got = s.take()
+	want = []insync.Scope{{Teams: []string{}, Repos: []string{"api"}, CustomRoles: true, Cleanups: true}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("take = %+v; want %+v", got, want)
+	}
+}
+
+func TestProcessModes(t *testing.T) {
+	drift := util.Plan{Changes: []util.Change{{Scope: "team-member", Target: "platform", Action: "remove"}}}
+	for _, mode := range []string{config.ServerModeReport, config.ServerModeApply} {
+		t.Run(mode, func(t *testing.T) {
+			var planned insync.Scope
+			applied := false
+			s := New(Options{
+				Org:  "acme",
+				Mode: mode,
+				Plan: func(_ context.Context, scope insync.Scope) (util.Plan, error) {
+					planned = scope
+					return drift, nil
+				},
+				Apply: func(_ context.Context, plan util.Plan, onChange func(util.Change, error)) error {
+					applied = true
+					for _, ch := range plan.Changes {
+						onChange(ch, nil)
+					}
+					return nil
+				},
+			})
+			scope := insync.Scope{Teams: []string{"platform"}, Cleanups: true}
+			s.process(context.Background(), scope)
+			if !reflect.DeepEqual(planned, scope) {
+				t.Errorf("planned scope = %+v, want %+v", planned, scope)
+			}
+			if want := mode == config.ServerModeApply; applied != want {
+				t.Errorf("applied = %v, want %v", applied, want)
+			}
+		})
+	}
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	s := New(Options{Org: "acme", Secret: testSecret})
+	h := s.Handler()
+
+	get := func(path string) int {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+	if code := get("/healthz"); code != http.StatusOK {
+		t.Errorf("/healthz = %d", code)
+	}
+	if code := get("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz before Run = %d, want 503", code)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() { s.Run(ctx); close(done) }()
+	for !s.ready.Load() {
+		time.Sleep(time.Millisecond)
+	}
+	if code := get("/readyz"); code != http.StatusOK {
+		t.Errorf("/readyz while running = %d, want 200", code)
+	}
+	cancel()
+	<-done
+}
+
+func TestSecret(t *testing.T) {
+	t.Setenv("GOMGR_WEBHOOK_SECRET", "")
+	if _, err := Secret(config.ServerConfig{}); err == nil {
+		t.Error("expected an error without a secret")
+	}
+	t.Setenv("HOOK_SECRET", "from-env")
+	got, err := Secret(config.ServerConfig{WebhookSecret: "${HOOK_SECRET}"})
+	if err != nil || string(got) != "from-env" {
+		t.Errorf("Secret = %q, %v", got, err)
+	}
+	t.Setenv("GOMGR_WEBHOOK_SECRET", "fallback")
+	got, _ = Secret(config.ServerConfig{})
+	if string(got) != "fallback" {
+		t.Errorf("Secret fallback = %q", got)
+	}
+}
@@ -0,0 +1,364 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/DragonSecurity/gomgr/internal/gh"
+	"github.com/DragonSecurity/gomgr/internal/tracing"
+	"github.com/DragonSecurity/gomgr/internal/util"
+)
+
+// DefaultConcurrency is how many changes apply runs at once when
+// ApplyOptions.Concurrency is unset.
+const DefaultConcurrency = 4
+
+// errDependencyFailed marks a change that was skipped because a change it
+// depends on failed or was itself skipped.
+var errDependencyFailed = errors.New("skipped: dependency failed")
+
+// ErrDeclined marks a cleanup change that ApplyOptions.Approve turned down.
+var ErrDeclined = errors.New("skipped: declined")
+
+// applyNode is one change in the apply graph.
+type applyNode struct {
+	ch    util.Change
+	index int
+	// needs are hard dependencies: the change only runs once all of them
+	// succeeded, and is skipped when one of them fails.
+	needs []*applyNode
+	// after are ordering-only dependencies: the change waits for them to
+	// finish but runs whatever their outcome.
+	after []*applyNode
+
+	dependents []*applyNode
+	pending    int
+	blockedBy  *applyNode
+	failed     bool
+	done       bool
+	declined   bool
+	// barrier nodes stand for "everything before this point" and have no
+	// change of their own.
+	barrier bool
+}
+
+func (n *applyNode) String() string {
+	return n.ch.Scope + ":" + n.ch.Action + " " + n.ch.Target
+}
+
+// changeResources describes a change in terms of the GitHub resources it
+// touches: the resource it brings into existence (if any) and the resources
+// that must exist before it can run. Keys look like "team/<slug>",
+// "repo/<name>", "template/<name>" and "role/<name>". known is false for change kinds the
+// graph has no model for.
+func changeResources(ch util.Change) (creates string, uses []string, known bool) {
+	repoOf := func(target string) string {
+		if i := strings.IndexByte(target, ':'); i >= 0 {
+			target = target[:i]
+		}
+		return "repo/" + strings.ToLower(target)
+	}
+	switch ch.Scope {
+	case "team":
+		if ch.Action == "create" {
+			return "team/" + ch.Target, nil, true
+		}
+		return "", []string{"team/" + ch.Target}, true
+	case "team-member":
+		return "", []string{"team/" + ch.Target}, true
+	case "team-repo":
+		slug, repo, _ := strings.Cut(ch.Target, "/")
+		return "", []string{"team/" + slug, repoOf(repo)}, true
+	case "repo":
+		switch ch.Action {
+		case "ensure":
+		case "unarchive":
+			// Nothing can change an archived repository, so everything
+			// else on it waits for the unarchive.
+			return repoOf(ch.Target), nil, true
+		default:
+			return "", []string{repoOf(ch.Target)}, true
+		}
+		d, _ := ch.Details.(map[string]any)
+		if from := detailString(d, "from"); from != "" {
+			from = strings.ToLower(from)
+			return repoOf(ch.Target), []string{"repo/" + from, "template/" + from}, true
+		}
+		return repoOf(ch.Target), nil, true
+	case "repo-template":
+		return "template/" + strings.ToLower(ch.Target), []string{repoOf(ch.Target)}, true
+	case "repo-file", "repo-topics", "repo-pin":
+		return "", []string{repoOf(ch.Target)}, true
+	case "org-member":
+		return "", []string{"user/" + ch.Target}, true
+	case "custom-role":
+		return "", []string{"role/" + strings.ToLower(ch.Target)}, true
+	}
+	return "", nil, false
+}
+
+// isCleanup reports whether a change belongs to the destructive phase that
+// runs after every create and update has finished. Archiving an unmanaged
+// repository counts: it is reversible, but takes the repository out of use.
+func isCleanup(ch util.Change) bool {
+	return ch.Action == "delete" || ch.Action == "remove" || ch.Action == "archive"
+}
+
+// buildApplyGraph turns a precedence-sorted change list into a dependency
+// graph:
+//
+//   - a change needs the change that creates each resource it uses, when that
+//     change is part of the plan (a grant needs its team create and repo
+//     ensure, a member add needs its team create, …);
+//   - commits to the same repository run one at a time, in plan order, so
+//     they don't race for the branch head;
+//   - cleanups wait for every create and update to finish, and cleanups of
+//     the same resource keep plan order;
+//   - change kinds the graph has no model for keep plain precedence order.
+//
+// The returned nodes keep the order of changes.
+func buildApplyGraph(changes []util.Change) []*applyNode {
+	nodes := make([]*applyNode, 0, len(changes)+1)
+	creators := map[string]*applyNode{}
+	for i, ch := range changes {
+		n := &applyNode{ch: ch, index: i}
+		nodes = append(nodes, n)
+		if creates, _, _ := changeResources(ch); creates != "" && !isCleanup(ch) {
+			creators[creates] = n
+		}
+	}
+
+	barrier := &applyNode{barrier: true, index: len(changes)}
+	lastFile := map[string]*applyNode{}
+	lastCleanup := map[string]*applyNode{}
+	var lastUnknown *applyNode
+	for _, n := range nodes {
+		_, uses, known := changeResources(n.ch)
+		if !known {
+			if lastUnknown != nil {
+				n.after = append(n.after, lastUnknown)
+			}
+			lastUnknown = n
+			continue
+		}
+		if isCleanup(n.ch) {
+			n.after = append(n.after, barrier)
+			for _, key := range uses {
+				if prev := lastCleanup[key]; prev != nil {
+					n.after = append(n.after, prev)
+				}
+				lastCleanup[key] = n
+			}
+		} else {
+			barrier.after = append(barrier.after, n)
+			for _, key := range uses {
+				if c := creators[key]; c != nil && c != n {
+					n.needs = append(n.needs, c)
+				}
+			}
+		}
+		if n.ch.Scope == "repo-file" {
+			key := uses[0]
+			if prev := lastFile[key]; prev != nil {
+				n.after = append(n.after, prev)
+			}
+			lastFile[key] = n
+		}
+	}
+	nodes = append(nodes, barrier)
+
+	for _, n := range nodes {
+		for _, d := range n.needs {
+			d.dependents = append(d.dependents, n)
+		}
+		for _, d := range n.after {
+			d.dependents = append(d.dependents, n)
+		}
+		n.pending = len(n.needs) + len(n.after)
+	}
+	return nodes
+}
+
+// nodeResult is what a worker reports back for one change.
+type nodeResult struct {
+	node      *applyNode
+	err       error
+	dur       time.Duration
+	requestID string
+	ran       bool
+}
+
+// runApplyGraph applies the graph's changes with up to opts.Concurrency
+// handlers in flight. All bookkeeping (progress log, audit, OnChange)
+// happens on the calling goroutine, so hooks never run concurrently.
+//
+// Without ContinueOnError the first failure stops new changes from
+// starting; changes already running finish and the failure is returned.
+// With it, only changes that need a failed change are skipped.
+func runApplyGraph(ctx context.Context, c *gh.Client, nodes []*applyNode, reg *HandlerRegistry, opts ApplyOptions) error {
+	workers := opts.Concurrency
+	if workers <= 0 {
+		workers = DefaultConcurrency
+	}
+	total := 0
+	for _, n := range nodes {
+		if !n.barrier {
+			total++
+		}
+	}
+
+	var (
+		ready    []*applyNode
+		failed   []error
+		firstErr error
+		running  int
+		finished int
+	)
+	results := make(chan nodeResult)
+	stopped := func() bool { return firstErr != nil || ctx.Err() != nil }
+
+	// settle marks n as finished and releases its dependents. A dependent
+	// that needs a failed node is skipped once all its inputs are in, and
+	// counts as failed for its own dependents in turn.
+	var settle, release func(n *applyNode)
+	release = func(n *applyNode) {
+		switch {
+		case n.barrier:
+			if !stopped() {
+				if err := approveCleanups(ctx, n.dependents, opts); err != nil {
+					firstErr = err
+				}
+			}
+			settle(n)
+		case n.declined:
+			finished++
+			util.Infof("[%d/%d] %s %v", finished, total, n, ErrDeclined)
+			opts.record(ctx, n.ch, ErrDeclined)
+			settle(n)
+		case n.blockedBy != nil:
+			finished++
+			n.failed = true
+			err := fmt.Errorf("%w: %s", errDependencyFailed, n.blockedBy)
+			util.Warnf("[%d/%d] %s %v", finished, total, n, err)
+			opts.record(ctx, n.ch, err)
+			failed = append(failed, fmt.Errorf("%s: %w", n, err))
+			settle(n)
+		default:
+			// Keep ready in plan order so output stays predictable.
+			i := sort.Search(len(ready), func(i int) bool { return ready[i].index > n.index })
+			ready = slices.Insert(ready, i, n)
+		}
+	}
+	settle = func(n *applyNode) {
+		n.done = true
+		for _, d := range n.dependents {
+			if n.failed && d.blockedBy == nil && slices.Contains(d.needs, n) {
+				d.blockedBy = n
+			}
+			if d.pending--; d.pending == 0 {
+				release(d)
+			}
+		}
+	}
+	for _, n := range nodes {
+		if n.pending == 0 {
+			release(n)
+		}
+	}
+
+	for {
+		for !stopped() && running < workers && len(ready) > 0 {
+			n := ready[0]
+			ready = ready[1:]
+			running++
+			opts.Journal.Start(n.ch)
+			go func() { results <- applyOne(ctx, c, n, reg) }()
+		}
+		if running == 0 {
+			break
+		}
+
+		r := <-results
+		running--
+		if r.ran {
+			finished++
+			logAppliedChange(ctx, finished, total, r.node.ch, r.dur, r.requestID, r.err)
+			opts.record(ctx, r.node.ch, r.err)
+		}
+		if r.err != nil {
+			r.node.failed = true
+			if !opts.ContinueOnError {
+				if firstErr == nil {
+					firstErr = r.err
+				}
+			} else {
+				wrapped := fmt.Errorf("%s: %w", r.node, r.err)
+				util.Warnf("continuing after error: %v", wrapped)
+				failed = append(failed, wrapped)
+			}
+		}
+		settle(r.node)
+	}
+
+	if firstErr != nil {
+		return firstErr
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	for _, n := range nodes {
+		if !n.done {
+			return fmt.Errorf("apply graph has a dependency cycle at %s", n)
+		}
+	}
+	if len(failed) > 0 {
+		util.Warnf("%d of %d changes failed", len(failed), total)
+		return fmt.Errorf("apply completed with %d error(s): %w", len(failed), errors.Join(failed...))
+	}
+	return nil
+}
+
+// approveCleanups asks opts.Approve about the cleanup changes waiting on the
+// barrier and marks the ones it declines.
+func approveCleanups(ctx context.Context, waiting []*applyNode, opts ApplyOptions) error {
+	if opts.Approve == nil || len(waiting) == 0 {
+		return nil
+	}
+	changes := make([]util.Change, len(waiting))
+	for i, n := range waiting {
+		changes[i] = n.ch
+	}
+	verdicts, err := opts.Approve(ctx, changes)
+	if err != nil {
+		return fmt.Errorf("approve cleanups: %w", err)
+	}
+	if len(verdicts) != len(waiting) {
+		return fmt.Errorf("approve cleanups: got %d verdicts for %d changes", len(verdicts), len(waiting))
+	}
+	for i, n := range waiting {
+		n.declined = !verdicts[i]
+	}
+	return nil
+}
+
+// applyOne runs one change's handler inside its span.
+func applyOne(ctx context.Context, c *gh.Client, n *applyNode, reg *HandlerRegistry) nodeResult {
+	handler, ok := reg.Lookup(n.ch.Scope, n.ch.Action)
+	if !ok {
+		util.Warnf("no handler for change %s:%s on %s", n.ch.Scope, n.ch.Action, n.ch.Target)
+		return nodeResult{node: n}
+	}
+	// Rate-limit waits happen in the transport under this span, so a
+	// change that sat out a limit reset is visible as such.
+	spanCtx, span := startChangeSpan(ctx, n.ch)
+	changeCtx, requestIDs := gh.WithRequestIDs(spanCtx)
+	start := time.Now()
+	err := handler.Apply(changeCtx, c, n.ch)
+	tracing.End(span, err)
+	return nodeResult{node: n, err: err, dur: time.Since(start), requestID: requestIDs.Last(), ran: true}
+}
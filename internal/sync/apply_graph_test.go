@@ -0,0 +1,249 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	gosync "sync"
+	"testing"
+	"time"
+
+	"github.com/DragonSecurity/gomgr/internal/gh"
+	"github.com/DragonSecurity/gomgr/internal/util"
+)
+
+// recordingRegistry registers every built-in change kind with a handler that
+// appends the change to order, failing those whose target is in fail.
+func recordingRegistry(order *[]string, mu *gosync.Mutex, fail map[string]bool) *HandlerRegistry {
+	r := NewHandlerRegistry()
+	for key, e := range defaultRegistry.entries {
+		scope, action, _ := strings.Cut(key, ":")
+		r.Register(scope, action, e.precedence, HandlerFunc(func(_ context.Context, _ *gh.Client, ch util.Change) error {
+			mu.Lock()
+			*order = append(*order, ch.Scope+":"+ch.Action+" "+ch.Target)
+			mu.Unlock()
+			if fail[ch.Target] {
+				return errors.New("boom")
+			}
+			return nil
+		}))
+	}
+	return r
+}
+
+func TestBuildApplyGraph_Dependencies(t *testing.T) {
+	changes := []util.Change{
+		{Scope: "team", Action: "create", Target: "backend"},
+		{Scope: "repo", Action: "ensure", Target: "tmpl"},
+		{Scope: "repo", Action: "ensure", Target: "api", Details: map[string]any{"from": "Tmpl"}},
+		{Scope: "team-repo", Action: "grant", Target: "backend/api"},
+		{Scope: "team-member", Action: "ensure", Target: "backend"},
+		{Scope: "repo-file", Action: "ensure", Target: "api:README.md"},
+		{Scope: "repo-file", Action: "ensure", Target: "api:CODEOWNERS"},
+		{Scope: "repo-template", Action: "ensure", Target: "tmpl"},
+		{Scope: "team", Action: "delete", Target: "legacy"},
+		{Scope: "repo", Action: "unarchive", Target: "web"},
+		{Scope: "repo-topics", Action: "ensure", Target: "web"},
+		{Scope: "repo", Action: "archive", Target: "old"},
+	}
+	nodes := buildApplyGraph(changes)
+	byName := map[string]*applyNode{}
+	for _, n := range nodes {
+		if !n.barrier {
+			byName[n.String()] = n
+		}
+	}
+	names := func(ns []*applyNode) []string {
+		var out []string
+		for _, n := range ns {
+			if n.barrier {
+				out = append(out, "barrier")
+				continue
+			}
+			out = append(out, n.String())
+		}
+		slices.Sort(out)
+		return out
+	}
+
+	tests := []struct {
+		node  string
+		needs []string
+		after []string
+	}{
+		{"team-repo:grant backend/api", []string{"repo:ensure api", "team:create backend"}, nil},
+		{"team-member:ensure backend", []string{"team:create backend"}, nil},
+		{"repo:ensure api", []string{"repo-template:ensure tmpl", "repo:ensure tmpl"}, nil},
+		{"repo-file:ensure api:CODEOWNERS", []string{"repo:ensure api"}, []string{"repo-file:ensure api:README.md"}},
+		{"team:delete legacy", nil, []string{"barrier"}},
+		{"repo-topics:ensure web", []string{"repo:unarchive web"}, nil},
+		{"repo:archive old", nil, []string{"barrier"}},
+		{"team:create backend", nil, nil},
+	}
+	for _, tt := range tests {
+		n := byName[tt.node]
+		if n == nil {
+			t.Fatalf("no node %s", tt.node)
+		}
+		if got := names(n.needs); !slices.Equal(got, tt.needs) {
+			t.Errorf("%s needs %v, want %v", tt.node, got, tt.needs)
+		}
+		if got := names(n.after); !slices.Equal(got, tt.after) {
+			t.Errorf("%s after %v, want %v", tt.node, got, tt.after)
+		}
+	}
+}
+
+func TestApplyChangesWith_KeepsOrderingGuarantees(t *testing.T) {
+	var mu gosync.Mutex
+	var order []string
+	reg := recordingRegistry(&order, &mu, nil)
+	changes := []util.Change{
+		{Scope: "team", Action: "delete", Target: "legacy"},
+		{Scope: "team-member", Action: "ensure", Target: "backend"},
+		{Scope: "team-repo", Action: "grant", Target: "backend/api"},
+		{Scope: "repo", Action: "ensure", Target: "api"},
+		{Scope: "team", Action: "create", Target: "backend"},
+		{Scope: "team-member", Action: "ensure", Target: "frontend"},
+	}
+	if err := applyChangesWith(context.Background(), nil, changes, reg, ApplyOptions{Concurrency: 8}); err != nil {
+		t.Fatal(err)
+	}
+
+	pos := map[string]int{}
+	for i, s := range order {
+		pos[s] = i
+	}
+	before := [][2]string{
+		{"team:create backend", "team-member:ensure backend"},
+		{"team:create backend", "team-repo:grant backend/api"},
+		{"repo:ensure api", "team-repo:grant backend/api"},
+	}
+	for _, b := range before {
+		if pos[b[0]] > pos[b[1]] {
+			t.Errorf("%s ran after %s: %v", b[0], b[1], order)
+		}
+	}
+	if order[len(order)-1] != "team:delete legacy" {
+		t.Errorf("expected the cleanup to run last, got %v", order)
+	}
+}
+
+func TestApplyChangesWith_RunsIndependentChangesInParallel(t *testing.T) {
+	var arrived gosync.WaitGroup
+	arrived.Add(2)
+	reg := NewHandlerRegistry()
+	reg.Register("team-member", "ensure", 10, HandlerFunc(func(context.Context, *gh.Client, util.Change) error {
+		arrived.Done()
+		done := make(chan struct{})
+		go func() { arrived.Wait(); close(done) }()
+		select {
+		case <-done:
+			return nil
+		case <-time.After(5 * time.Second):
+			return errors.New("changes did not run in parallel")
+		}
+	}))
+	changes := []util.Change{
+		{Scope: "team-member", Action: "ensure", Target: "backend"},
+		{Scope: "team-member", Action: "ensure", Target: "frontend"},
+	}
+	if err := applyChangesWith(context.Background(), nil, changes, reg, ApplyOptions{Concurrency: 2}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApplyChangesWith_ContinueOnErrorSkipsDependents(t *testing.T) {
+	var mu gosync.Mutex
+	var order []string
+	reg := recordingRegistry(&order, &mu, map[string]bool{"backend": true})
+	changes := []util.Change{
+		{Scope: "team", Action: "create", Target: "backend"},
+		{Scope: "team", Action: "create", Target: "frontend"},
+		{Scope: "team-member", Action: "ensure", Target: "backend"},
+		{Scope: "team-repo", Action: "grant", Target: "backend/api"},
+		{Scope: "team-member", Action: "ensure", Target: "frontend"},
+		{Scope: "org-member", Action: "remove", Target: "mallory"},
+	}
+	var skipped []string
+	err := applyChangesWith(context.Background(), nil, changes, reg, ApplyOptions{
+		ContinueOnError: true,
+		OnChange: func(ch util.Change, err error) {
+			if errors.Is(err, errDependencyFailed) {
+				skipped = append(skipped, ch.Scope+":"+ch.Action+" "+ch.Target)
+			}
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "3 error(s)") {
+		t.Fatalf("expected the failure and two skips to be reported, got %v", err)
+	}
+	slices.Sort(skipped)
+	if want := []string{"team-member:ensure backend", "team-repo:grant backend/api"}; !slices.Equal(skipped, want) {
+		t.Errorf("skipped %v, want %v", skipped, want)
+	}
+	for _, want := range []string{"team-member:ensure frontend", "org-member:remove mallory"} {
+		if !slices.Contains(order, want) {
+			t.Errorf("expected independent change %s to run, order %v", want, order)
+		}
+	}
+}
+
+func TestApplyChangesWith_ApproveGatesCleanups(t *testing.T) {
+	var mu gosync.Mutex
+	var order []string
+	reg := recordingRegistry(&order, &mu, nil)
+	changes := []util.Change{
+		{Scope: "team", Action: "delete", Target: "legacy"},
+		{Scope: "org-member", Action: "remove", Target: "mallory"},
+		{Scope: "team", Action: "create", Target: "backend"},
+		{Scope: "custom-role", Action: "delete", Target: "stale", Details: customRoleChange{Name: "stale"}},
+	}
+	var asked []string
+	var declined []string
+	err := applyChangesWith(context.Background(), nil, changes, reg, ApplyOptions{
+		Approve: func(_ context.Context, cleanups []util.Change) ([]bool, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if !slices.Equal(order, []string{"team:create backend"}) {
+				t.Errorf("approval asked before the other changes finished: %v", order)
+			}
+			verdicts := make([]bool, len(cleanups))
+			for i, ch := range cleanups {
+				asked = append(asked, ch.Scope+":"+ch.Action+" "+ch.Target)
+				verdicts[i] = ch.Target != "legacy"
+			}
+			return verdicts, nil
+		},
+		OnChange: func(ch util.Change, err error) {
+			if errors.Is(err, ErrDeclined) {
+				declined = append(declined, ch.Target)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("a declined change should not fail the apply: %v", err)
+	}
+	if want := []string{"org-member:remove mallory", "team:delete legacy", "custom-role:delete stale"}; !slices.Equal(asked, want) {
+		t.Errorf("asked about %v, want %v", asked, want)
+	}
+	if !slices.Equal(declined, []string{"legacy"}) {
+		t.Errorf("declined %v, want [legacy]", declined)
+	}
+	if slices.Contains(order, "team:delete legacy") || !slices.Contains(order, "custom-role:delete stale") {
+		t.Errorf("expected only approved cleanups to run, order %v", order)
+	}
+}
+
+func TestApplyChangesWith_ApproveErrorStopsCleanups(t *testing.T) {
+	var mu gosync.Mutex
+	var order []string
+	reg := recordingRegistry(&order, &mu, nil)
+	changes := []util.Change{{Scope: "team", Action: "delete", Target: "legacy"}}
+	err := applyChangesWith(context.Background(), nil, changes, reg, ApplyOptions{
+		Approve: func(context.Context, []util.Change) ([]bool, error) { return nil, errors.New("no tty") },
+	})
+	if err == nil || !strings.Contains(err.Error(), "no tty") || len(order) != 0 {
+		t.Fatalf("expected the approval error to stop the cleanup, got %v (ran %v)", err, order)
+	}
+}
@@ -2,6 +2,7 @@ package sync
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"net/http"
@@ -10,7 +11,9 @@ import (
 
 	"github.com/google/go-github/v88/github"
 
+	"github.com/DragonSecurity/gomgr/internal/config"
 	"github.com/DragonSecurity/gomgr/internal/gh"
+	"github.com/DragonSecurity/gomgr/internal/templates"
 	"github.com/DragonSecurity/gomgr/internal/util"
 )
 
@@ -43,6 +46,28 @@ func detailBool(d map[string]any, key string) bool {
 	return false
 }
 
+// detailStrings returns the string list stored under key, which may be a
+// []string from planning or a []any decoded from a journal. ok is false when
+// key is absent.
+func detailStrings(d map[string]any, key string) (list []string, ok bool, err error) {
+	v, ok := d[key]
+	if !ok {
+		return nil, false, nil
+	}
+	switch vs := v.(type) {
+	case []string:
+		return vs, true, nil
+	case []any:
+		for _, e := range vs {
+			if s, isString := e.(string); isString {
+				list = append(list, s)
+			}
+		}
+		return list, true, nil
+	}
+	return nil, true, fmt.Errorf("invalid type for %s: %T", key, v)
+}
+
 func applyTeamCreate(ctx context.Context, c *gh.Client, ch util.Change) error {
 	d, err := extractDetails(ch)
 	if err != nil {
@@ -113,6 +138,18 @@ func applyTeamMemberEnsure(ctx context.Context, c *gh.Client, ch util.Change) er
 	return nil
 }
 
+func applyTeamMemberRemove(ctx context.Context, c *gh.Client, ch util.Change) error {
+	d, ok := ch.Details.(teamMemberChange)
+	if !ok {
+		return fmt.Errorf("invalid details for team-member:remove: expected teamMemberChange, got %T", ch.Details)
+	}
+	_, err := c.REST.Teams.RemoveTeamMembershipBySlug(ctx, d.Org, d.Slug, d.User)
+	if err != nil {
+		return fmt.Errorf("remove %q from %q in org %q: %w", d.User, d.Slug, d.Org, err)
+	}
+	return nil
+}
+
 func applyRepoEnsure(ctx context.Context, c *gh.Client, ch util.Change) error {
 	d, err := extractDetails(ch)
 	if err != nil {
@@ -171,6 +208,10 @@ func applyRepoEnsure(ctx context.Context, c *gh.Client, ch util.Change) error {
 		}
 		_, _, err := c.REST.Repositories.Create(ctx, org, repo)
 		if err != nil {
+			if visibility == "internal" && isVisibilityRejected(err) {
+				err = c.Unsupported("internal repository visibility",
+					"internal repos need an organization owned by an enterprise account; use private instead", err)
+			}
 			if !isRepoAlreadyExists(err) {
 				return fmt.Errorf("create repo %s/%s: %w", org, name, err)
 			}
@@ -231,6 +272,21 @@ func isNotFound(err error) bool {
 	return errors.As(err, &ghErr) && ghErr.Response != nil && ghErr.Response.StatusCode == http.StatusNotFound
 }
 
+// isVisibilityRejected reports whether err is a GitHub 422 rejecting the
+// requested repository visibility.
+func isVisibilityRejected(err error) bool {
+	var ghErr *github.ErrorResponse
+	if !errors.As(err, &ghErr) || ghErr.Response == nil || ghErr.Response.StatusCode != http.StatusUnprocessableEntity {
+		return false
+	}
+	for _, e := range ghErr.Errors {
+		if strings.EqualFold(e.Field, "visibility") {
+			return true
+		}
+	}
+	return containsErrorMessage(ghErr, "visibility") || containsErrorMessage(ghErr, "Visibility")
+}
+
 // isRepoAlreadyExists reports whether err is a GitHub 422 indicating the
 // repository name is already taken. GitHub returns 422 for many other create
 // failures too (invalid name, org policy, disabled repo creation), so we must
@@ -253,19 +309,39 @@ func applyRepoFileEnsure(ctx context.Context, c *gh.Client, ch util.Change) erro
 	org := detailString(d, "org")
 	repo := detailString(d, "repo")
 	path := detailString(d, "path")
-	content := []byte(detailString(d, "content"))
+	content, err := fileContent(d)
+	if err != nil {
+		return fmt.Errorf("decode %s for %s/%s: %w", path, org, repo, err)
+	}
 	message := detailString(d, "message")
 	branch := detailString(d, "branch")
-	reconcile := detailBool(d, "reconcile")
+	block := detailString(d, "mode") == config.FileModeBlock
+	merge := detailString(d, "merge")
+	mergeArrays := detailString(d, "merge_arrays")
+	if _, explicit := d["default_branch"]; explicit {
+		if err := ensureBranch(ctx, c, org, repo, branch, detailString(d, "default_branch"), detailBool(d, "create_branch")); err != nil {
+			return err
+		}
+	}
 	file, _, resp, err := c.REST.Repositories.GetContents(ctx, org, repo, path, &github.RepositoryContentGetOptions{Ref: branch})
 	if err != nil && (resp == nil || resp.StatusCode != http.StatusNotFound) {
 		return fmt.Errorf("check %s/%s:%s: %w", org, repo, path, err)
 	}
 	if file == nil {
+		switch {
+		case block:
+			content = []byte(templates.RenderBlock(path, string(content)))
+		case merge != "":
+			rendered, _, err := templates.MergeStructured("", string(content), merge, mergeArrays)
+			if err != nil {
+				return fmt.Errorf("format %s for %s/%s: %w", path, org, repo, err)
+			}
+			content = []byte(rendered)
+		}
 		_, _, err := c.REST.Repositories.CreateFile(ctx, org, repo, path, &github.RepositoryContentFileOptions{
 			Message: github.Ptr(message),
 			Content: content,
-			Branch:  github.Ptr(branch),
+			Branch:  branchPtr(branch),
 		})
 		if err != nil {
 			// Handle race condition: If repository was created from template,
@@ -285,20 +361,14 @@ func applyRepoFileEnsure(ctx context.Context, c *gh.Client, ch util.Change) erro
 		}
 		return nil
 	}
-	if !reconcile {
-		return nil
-	}
-	current, err := file.GetContent()
-	if err != nil {
-		return fmt.Errorf("decode existing %s in %s/%s: %w", path, org, repo, err)
-	}
-	if current == string(content) {
-		return nil
+	content, write, err := updatedFileContent(d, file, content)
+	if err != nil || !write {
+		return err
 	}
 	_, _, err = c.REST.Repositories.UpdateFile(ctx, org, repo, path, &github.RepositoryContentFileOptions{
 		Message: github.Ptr(message),
 		Content: content,
-		Branch:  github.Ptr(branch),
+		Branch:  branchPtr(branch),
 		SHA:     github.Ptr(file.GetSHA()),
 	})
 	if err != nil {
@@ -307,6 +377,111 @@ func applyRepoFileEnsure(ctx context.Context, c *gh.Client, ch util.Change) erro
 	return nil
 }
 
+// fileContent returns the bytes a repo-file change writes. Content that is
+// not valid UTF-8 is planned base64-encoded under "content_base64", since a
+// JSON plan or journal would otherwise replace its bytes with U+FFFD.
+func fileContent(d map[string]any) ([]byte, error) {
+	if enc, ok := d["content_base64"]; ok {
+		return base64.StdEncoding.DecodeString(fmt.Sprint(enc))
+	}
+	return []byte(detailString(d, "content")), nil
+}
+
+// updatedFileContent returns what a repo-file:ensure change writes over the
+// existing file, and whether that differs from it. Without reconcile, block
+// mode or merge an existing file is never rewritten.
+func updatedFileContent(d map[string]any, file *github.RepositoryContent, content []byte) ([]byte, bool, error) {
+	org := detailString(d, "org")
+	repo := detailString(d, "repo")
+	path := detailString(d, "path")
+	block := detailString(d, "mode") == config.FileModeBlock
+	merge := detailString(d, "merge")
+	if !detailBool(d, "reconcile") && !block && merge == "" {
+		return nil, false, nil
+	}
+	current, err := file.GetContent()
+	if err != nil {
+		return nil, false, fmt.Errorf("decode existing %s in %s/%s: %w", path, org, repo, err)
+	}
+	switch {
+	case block:
+		// Only the marker-delimited section is ours: an in-sync block is left
+		// alone whatever changed around it, and otherwise the rendered body is
+		// spliced in so human-edited text outside the markers survives.
+		existing, err := templates.ExtractBlock(current, path)
+		if err != nil {
+			return nil, false, fmt.Errorf("update block in %s/%s: %w", org, repo, err)
+		}
+		if existing == templates.RenderBlock(path, string(content)) {
+			return nil, false, nil
+		}
+		spliced, err := templates.SpliceBlock(current, path, string(content))
+		if err != nil {
+			return nil, false, fmt.Errorf("update block in %s/%s: %w", org, repo, err)
+		}
+		content = []byte(spliced)
+	case merge != "":
+		// Keys the repo added locally survive the merge; a semantically
+		// identical document is left alone even if it is formatted differently.
+		merged, changed, err := templates.MergeStructured(current, string(content), merge, detailString(d, "merge_arrays"))
+		if err != nil {
+			return nil, false, fmt.Errorf("merge %s in %s/%s: %w", path, org, repo, err)
+		}
+		if !changed {
+			return nil, false, nil
+		}
+		content = []byte(merged)
+	}
+	return content, current != string(content), nil
+}
+
+// branchPtr returns nil for an empty branch so the contents API falls back to
+// the repository's default branch instead of rejecting branch "".
+func branchPtr(branch string) *string {
+	if branch == "" {
+		return nil
+	}
+	return github.Ptr(branch)
+}
+
+// ensureBranch verifies that an explicitly configured file branch exists.
+// When it is missing and create is set, the branch is created from base (the
+// repo's default branch, looked up if the plan did not know it); otherwise a
+// descriptive error is returned instead of the contents API's bare 404.
+func ensureBranch(ctx context.Context, c *gh.Client, org, repo, branch, base string, create bool) error {
+	_, resp, err := c.REST.Repositories.GetBranch(ctx, org, repo, branch, 1)
+	if err == nil {
+		return nil
+	}
+	// GetBranch reports non-200s as a plain error, so match on the response.
+	if resp == nil || resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("check branch %q in %s/%s: %w", branch, org, repo, err)
+	}
+	if !create {
+		return fmt.Errorf("branch %q does not exist in %s/%s (set create_branch: true to create it from the default branch)", branch, org, repo)
+	}
+	if base == "" {
+		r, _, err := c.REST.Repositories.Get(ctx, org, repo)
+		if err != nil {
+			return fmt.Errorf("look up default branch of %s/%s: %w", org, repo, err)
+		}
+		base = r.GetDefaultBranch()
+	}
+	ref, _, err := c.REST.Git.GetRef(ctx, org, repo, "heads/"+base)
+	if err != nil {
+		return fmt.Errorf("resolve %s/%s@%s: %w", org, repo, base, err)
+	}
+	_, _, err = c.REST.Git.CreateRef(ctx, org, repo, github.CreateRef{
+		Ref: "refs/heads/" + branch,
+		SHA: ref.GetObject().GetSHA(),
+	})
+	if err != nil {
+		return fmt.Errorf("create branch %q from %q in %s/%s: %w", branch, base, org, repo, err)
+	}
+	util.Infof("created branch %s in %s/%s from %s", branch, org, repo, base)
+	return nil
+}
+
 func applyRepoFileDelete(ctx context.Context, c *gh.Client, ch util.Change) error {
 	d, err := extractDetails(ch)
 	if err != nil {
@@ -326,7 +501,7 @@ func applyRepoFileDelete(ctx context.Context, c *gh.Client, ch util.Change) erro
 	}
 	_, _, err = c.REST.Repositories.DeleteFile(ctx, org, repo, path, &github.RepositoryContentFileOptions{
 		Message: github.Ptr(message),
-		Branch:  github.Ptr(branch),
+		Branch:  branchPtr(branch),
 		SHA:     github.Ptr(file.GetSHA()),
 	})
 	if err != nil {
@@ -343,21 +518,9 @@ func applyRepoTopicsEnsure(ctx context.Context, c *gh.Client, ch util.Change) er
 	org := detailString(d, "org")
 	repo := detailString(d, "repo")
 
-	// Handle topics - may come as []string or []any from planning
-	var topicsRaw []string
-	if v, ok := d["topics"]; ok {
-		switch topics := v.(type) {
-		case []string:
-			topicsRaw = topics
-		case []any:
-			for _, t := range topics {
-				if tStr, ok := t.(string); ok {
-					topicsRaw = append(topicsRaw, tStr)
-				}
-			}
-		default:
-			return fmt.Errorf("invalid type for topics for %s/%s: %T", org, repo, v)
-		}
+	topicsRaw, _, err := detailStrings(d, "topics")
+	if err != nil {
+		return fmt.Errorf("topics for %s/%s: %w", org, repo, err)
 	}
 
 	_, _, err = c.REST.Repositories.ReplaceAllTopics(ctx, org, repo, topicsRaw)
@@ -410,6 +573,56 @@ func applyRepoDelete(ctx context.Context, c *gh.Client, ch util.Change) error {
 	return nil
 }
 
+// applyRepoArchive archives an unmanaged repository. Topics, when planned,
+// are set first: an archived repository is read-only.
+func applyRepoArchive(ctx context.Context, c *gh.Client, ch util.Change) error {
+	d, err := extractDetails(ch)
+	if err != nil {
+		return err
+	}
+	org := detailString(d, "org")
+	repo := detailString(d, "repo")
+	if err := replaceTopicsIfPlanned(ctx, c, d, org, repo); err != nil {
+		return err
+	}
+	if _, _, err := c.REST.Repositories.Edit(ctx, org, repo, &github.Repository{Archived: github.Ptr(true)}); err != nil {
+		return fmt.Errorf("archive repo %s/%s: %w", org, repo, err)
+	}
+	return nil
+}
+
+// applyRepoUnarchive unarchives a repository that is managed again, then
+// sets its topics when planned (dropping the unmanaged marker).
+func applyRepoUnarchive(ctx context.Context, c *gh.Client, ch util.Change) error {
+	d, err := extractDetails(ch)
+	if err != nil {
+		return err
+	}
+	org := detailString(d, "org")
+	repo := detailString(d, "repo")
+	if _, _, err := c.REST.Repositories.Edit(ctx, org, repo, &github.Repository{Archived: github.Ptr(false)}); err != nil {
+		return fmt.Errorf("unarchive repo %s/%s: %w", org, repo, err)
+	}
+	return replaceTopicsIfPlanned(ctx, c, d, org, repo)
+}
+
+func replaceTopicsIfPlanned(ctx context.Context, c *gh.Client, d map[string]any, org, repo string) error {
+	topics, ok, err := detailStrings(d, "topics")
+	if err != nil {
+		return fmt.Errorf("topics for %s/%s: %w", org, repo, err)
+	}
+	if !ok {
+		return nil
+	}
+	if topics == nil {
+		topics = []string{}
+	}
+	if _, _, err := c.REST.Repositories.ReplaceAllTopics(ctx, org, repo, topics); err != nil {
+		return fmt.Errorf("set topics on %s/%s: %w", org, repo, err)
+	}
+	return nil
+}
+
 func applyOrgMemberRemove(ctx context.Context, c *gh.Client, ch util.Change) error {
 	d, err := extractDetails(ch)
 	if err != nil {
@@ -440,3 +653,113 @@ func normalizePermission(p string) string {
 		return p
 	}
 }
+
+// verifyTeamCreated reports whether the team a team:create change makes
+// already exists. The change target is the slug.
+func verifyTeamCreated(ctx context.Context, c *gh.Client, ch util.Change) (bool, error) {
+	d, err := extractDetails(ch)
+	if err != nil {
+		return false, err
+	}
+	return exists(c.REST.Teams.GetTeamBySlug(ctx, detailString(d, "org"), ch.Target))
+}
+
+// verifyTeamDeleted reports whether the team a team:delete change removes is
+// already gone.
+func verifyTeamDeleted(ctx context.Context, c *gh.Client, ch util.Change) (bool, error) {
+	d, err := extractDetails(ch)
+	if err != nil {
+		return false, err
+	}
+	found, err := exists(c.REST.Teams.GetTeamBySlug(ctx, detailString(d, "org"), detailString(d, "slug")))
+	return !found, err
+}
+
+// verifyRepoEnsured reports whether the repository a repo:ensure change
+// creates already exists.
+func verifyRepoEnsured(ctx context.Context, c *gh.Client, ch util.Change) (bool, error) {
+	d, err := extractDetails(ch)
+	if err != nil {
+		return false, err
+	}
+	return exists(c.REST.Repositories.Get(ctx, detailString(d, "org"), detailString(d, "name")))
+}
+
+// verifyRepoDeleted reports whether the repository a repo:delete change
+// removes is already gone.
+func verifyRepoDeleted(ctx context.Context, c *gh.Client, ch util.Change) (bool, error) {
+	d, err := extractDetails(ch)
+	if err != nil {
+		return false, err
+	}
+	found, err := exists(c.REST.Repositories.Get(ctx, detailString(d, "org"), detailString(d, "repo")))
+	return !found, err
+}
+
+// verifyRepoUnarchived reports whether the repository a repo:unarchive
+// change brings back is already unarchived.
+func verifyRepoUnarchived(ctx context.Context, c *gh.Client, ch util.Change) (bool, error) {
+	d, err := extractDetails(ch)
+	if err != nil {
+		return false, err
+	}
+	r, _, err := c.REST.Repositories.Get(ctx, detailString(d, "org"), detailString(d, "repo"))
+	if err != nil {
+		return false, err
+	}
+	return !r.GetArchived(), nil
+}
+
+// verifyRepoArchived reports whether the repository a repo:archive change
+// archives is already archived. Topics are replaced before archiving, so an
+// archived repo has them too.
+func verifyRepoArchived(ctx context.Context, c *gh.Client, ch util.Change) (bool, error) {
+	d, err := extractDetails(ch)
+	if err != nil {
+		return false, err
+	}
+	r, _, err := c.REST.Repositories.Get(ctx, detailString(d, "org"), detailString(d, "repo"))
+	if err != nil {
+		return false, err
+	}
+	return r.GetArchived(), nil
+}
+
+// verifyRepoFileEnsured reports whether the file a repo-file:ensure change
+// writes already holds what the change would commit, so a commit that landed
+// before the interruption is not made twice.
+func verifyRepoFileEnsured(ctx context.Context, c *gh.Client, ch util.Change) (bool, error) {
+	d, err := extractDetails(ch)
+	if err != nil {
+		return false, err
+	}
+	content, err := fileContent(d)
+	if err != nil {
+		return false, err
+	}
+	org, repo := detailString(d, "org"), detailString(d, "repo")
+	opts := &github.RepositoryContentGetOptions{Ref: detailString(d, "branch")}
+	file, _, resp, err := c.REST.Repositories.GetContents(ctx, org, repo, detailString(d, "path"), opts)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	if file == nil {
+		return false, nil
+	}
+	_, write, err := updatedFileContent(d, file, content)
+	return !write, err
+}
+
+// exists turns a GET result into found / not found, keeping other errors.
+func exists[T any](_ T, resp *github.Response, err error) (bool, error) {
+	if err == nil {
+		return true, nil
+	}
+	if (resp != nil && resp.StatusCode == http.StatusNotFound) || isNotFound(err) {
+		return false, nil
+	}
+	return false, err
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -28,6 +31,24 @@ func newTestClient(t *testing.T, server *httptest.Server) *gh.Client {
 	return &gh.Client{REST: client}
 }
 
+func TestApplyRepoEnsure_InternalVisibilityUnsupported(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_, _ = w.Write([]byte(`{"message":"Validation Failed","errors":[{"resource":"Repository","field":"visibility","code":"invalid"}]}`))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server)
+	ch := util.Change{Scope: "repo", Target: "api", Action: "ensure",
+		Details: map[string]any{"org": "myorg", "name": "api", "visibility": "internal"}}
+
+	err := applyRepoEnsure(context.Background(), c, ch)
+	var capErr *gh.CapabilityError
+	if !errors.As(err, &capErr) || capErr.Feature != "internal repository visibility" {
+		t.Fatalf("expected an internal visibility CapabilityError, got %v", err)
+	}
+}
+
 func TestApplyTeamCreate(t *testing.T) {
 	var gotBody map[string]any
 
@@ -817,6 +838,48 @@ func TestApplyRepoDelete(t *testing.T) {
 	}
 }
 
+func TestApplyRepoArchive(t *testing.T) {
+	var calls []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		switch {
+		case r.Method == "PUT" && r.URL.Path == "/repos/myorg/old-repo/topics":
+			calls = append(calls, fmt.Sprintf("topics %v", body["names"]))
+			_ = json.NewEncoder(w).Encode(map[string]any{"names": body["names"]})
+		case r.Method == "PATCH" && r.URL.Path == "/repos/myorg/old-repo":
+			calls = append(calls, fmt.Sprintf("archived=%v", body["archived"]))
+			_ = json.NewEncoder(w).Encode(map[string]any{"name": "old-repo"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	c := newTestClient(t, server)
+
+	ch := util.Change{Scope: "repo", Target: "old-repo", Action: "archive", Details: map[string]any{
+		"org": "myorg", "repo": "old-repo", "topics": []string{"go", "gomgr-unmanaged"},
+	}}
+	if err := applyRepoArchive(context.Background(), c, ch); err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+	// Topics can't change once the repository is archived.
+	if want := []string{"topics [go gomgr-unmanaged]", "archived=true"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("archive calls = %v, want %v", calls, want)
+	}
+
+	calls = nil
+	ch = util.Change{Scope: "repo", Target: "old-repo", Action: "unarchive", Details: map[string]any{
+		"org": "myorg", "repo": "old-repo", "topics": []any{},
+	}}
+	if err := applyRepoUnarchive(context.Background(), c, ch); err != nil {
+		t.Fatalf("unarchive: %v", err)
+	}
+	if want := []string{"archived=false", "topics []"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("unarchive calls = %v, want %v", calls, want)
+	}
+}
+
 func TestApplyTeamRepoGrant(t *testing.T) {
 	var gotPath string
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -1079,7 +1142,7 @@ func TestApplyCustomRoleCreate(t *testing.T) {
 		},
 	}
 
-	err := applyCustomRoleChanges(context.Background(), c, changes)
+	err := applyCustomRoleChanges(context.Background(), c, changes, ApplyOptions{})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -1126,7 +1189,7 @@ func TestApplyCustomRoleUpdate(t *testing.T) {
 		},
 	}
 
-	err := applyCustomRoleChanges(context.Background(), c, changes)
+	err := applyCustomRoleChanges(context.Background(), c, changes, ApplyOptions{})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -1169,7 +1232,9 @@ func TestApplyCustomRoleDelete(t *testing.T) {
 		},
 	}
 
-	err := applyCustomRoleChanges(context.Background(), c, changes)
+	// Deletes run in the cleanup phase of the graph, not the custom-role
+	// dispatcher.
+	err := applyChanges(context.Background(), c, changes)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -1183,7 +1248,7 @@ func TestApplyCustomRoleChanges_SkipsNonCustomRole(t *testing.T) {
 		{Scope: "team", Target: "backend", Action: "create", Details: map[string]any{"org": "myorg"}},
 	}
 	// Should not error - just skip non-custom-role changes
-	err := applyCustomRoleChanges(context.Background(), nil, changes)
+	err := applyCustomRoleChanges(context.Background(), nil, changes, ApplyOptions{})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -1237,4 +1302,234 @@ func TestPlanCustomRoleCleanups(t *testing.T) {
 	if !found {
 		t.Error("expected custom-role:delete change for stale-role")
 	}
+
+	cfg.App.Ignore.CustomRoles = []string{"Stale-*"}
+	changes, _, err = planCustomRoleCleanups(context.Background(), c, cfg, st)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(changes) != 0 || st.Ignored != 1 {
+		t.Errorf("expected the ignored role to be left alone, got %v (ignored %d)", changes, st.Ignored)
+	}
+}
+
+func TestApplyRepoFileEnsure_BlockModeSplicesIntoExisting(t *testing.T) {
+	const path = ".gitignore"
+	const existing = "*.log\n# BEGIN gomgr\nold/\n# END gomgr\nlocal/\n"
+
+	var putBody map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" && r.URL.Path == "/repos/myorg/api/contents/.gitignore" {
+			_, _ = w.Write(codeownersFileResponse(t, path, "sha-1", existing))
+			return
+		}
+		if r.Method == "PUT" && r.URL.Path == "/repos/myorg/api/contents/.gitignore" {
+			_ = json.NewDecoder(r.Body).Decode(&putBody)
+			_ = json.NewEncoder(w).Encode(map[string]any{})
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server)
+	ch := util.Change{
+		Scope:  "repo-file",
+		Target: "api:.gitignore",
+		Action: "ensure",
+		Details: map[string]any{
+			"org":     "myorg",
+			"repo":    "api",
+			"path":    path,
+			"content": "node_modules/\n",
+			"message": "chore: sync .gitignore",
+			"branch":  "main",
+			"mode":    config.FileModeBlock,
+		},
+	}
+	if err := applyRepoFileEnsure(context.Background(), c, ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if putBody == nil {
+		t.Fatal("expected UpdateFile for drifted block")
+	}
+	decoded, _ := base64.StdEncoding.DecodeString(putBody["content"].(string))
+	want := "*.log\n# BEGIN gomgr\nnode_modules/\n# END gomgr\nlocal/\n"
+	if string(decoded) != want {
+		t.Errorf("expected spliced content %q, got %q", want, string(decoded))
+	}
+}
+
+func TestApplyRepoFileEnsure_BlockModeIgnoresDriftOutsideBlock(t *testing.T) {
+	const path = ".gitignore"
+	const existing = "edited by humans\n# BEGIN gomgr\nnode_modules/\n# END gomgr\n"
+
+	var putCalled bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			_, _ = w.Write(codeownersFileResponse(t, path, "sha-1", existing))
+			return
+		}
+		if r.Method == "PUT" {
+			putCalled = true
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server)
+	ch := util.Change{
+		Scope:  "repo-file",
+		Target: "api:.gitignore",
+		Action: "ensure",
+		Details: map[string]any{
+			"org": "myorg", "repo": "api", "path": path, "content": "node_modules/\n",
+			"message": "m", "branch": "main", "mode": config.FileModeBlock,
+		},
+	}
+	if err := applyRepoFileEnsure(context.Background(), c, ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if putCalled {
+		t.Error("expected no update when only text outside the block differs")
+	}
+}
+
+func TestApplyRepoFileEnsure_MergeJSONKeepsLocalKeys(t *testing.T) {
+	const path = ".github/renovate.json"
+	const existing = `{"extends": ["old"], "labels": ["local"]}`
+
+	var putBody map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			_, _ = w.Write(codeownersFileResponse(t, path, "sha-1", existing))
+			return
+		}
+		if r.Method == "PUT" {
+			_ = json.NewDecoder(r.Body).Decode(&putBody)
+			_ = json.NewEncoder(w).Encode(map[string]any{})
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server)
+	ch := util.Change{
+		Scope:  "repo-file",
+		Target: "api:" + path,
+		Action: "ensure",
+		Details: map[string]any{
+			"org": "myorg", "repo": "api", "path": path,
+			"content": `{"extends": ["new"]}`, "message": "m", "branch": "main",
+			"merge": config.MergeJSON, "merge_arrays": "",
+		},
+	}
+	if err := applyRepoFileEnsure(context.Background(), c, ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if putBody == nil {
+		t.Fatal("expected UpdateFile for merged content")
+	}
+	decoded, _ := base64.StdEncoding.DecodeString(putBody["content"].(string))
+	want := "{\n  \"extends\": [\n    \"new\"\n  ],\n  \"labels\": [\n    \"local\"\n  ]\n}\n"
+	if string(decoded) != want {
+		t.Errorf("expected merged content %q, got %q", want, string(decoded))
+	}
+}
+
+func TestApplyRepoFileEnsure_EmptyBranchUsesRepoDefault(t *testing.T) {
+	var putBody map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			if r.URL.Query().Get("ref") != "" {
+				t.Errorf("expected no ref query for default branch, got %q", r.URL.RawQuery)
+			}
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]any{"message": "Not Found"})
+			return
+		}
+		if r.Method == "PUT" {
+			_ = json.NewDecoder(r.Body).Decode(&putBody)
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(map[string]any{})
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server)
+	ch := util.Change{
+		Scope: "repo-file", Target: "api:LICENSE", Action: "ensure",
+		Details: map[string]any{"org": "myorg", "repo": "api", "path": "LICENSE", "content": "MIT", "message": "m", "branch": ""},
+	}
+	if err := applyRepoFileEnsure(context.Background(), c, ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := putBody["branch"]; ok {
+		t.Errorf("expected branch to be omitted from create payload, got %v", putBody["branch"])
+	}
+}
+
+func TestApplyRepoFileEnsure_MissingExplicitBranch(t *testing.T) {
+	newServer := func(created *string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == "GET" && r.URL.Path == "/repos/myorg/api/branches/release":
+				w.WriteHeader(http.StatusNotFound)
+				_ = json.NewEncoder(w).Encode(map[string]any{"message": "Branch not found"})
+			case r.Method == "GET" && r.URL.Path == "/repos/myorg/api/git/ref/heads/develop":
+				_ = json.NewEncoder(w).Encode(map[string]any{"ref": "refs/heads/develop", "object": map[string]any{"sha": "abc123"}})
+			case r.Method == "POST" && r.URL.Path == "/repos/myorg/api/git/refs":
+				var body map[string]any
+				_ = json.NewDecoder(r.Body).Decode(&body)
+				*created = body["ref"].(string) + "@" + body["sha"].(string)
+				w.WriteHeader(http.StatusCreated)
+				_ = json.NewEncoder(w).Encode(map[string]any{"ref": body["ref"]})
+			case r.Method == "GET" && r.URL.Path == "/repos/myorg/api/contents/LICENSE":
+				w.WriteHeader(http.StatusNotFound)
+				_ = json.NewEncoder(w).Encode(map[string]any{"message": "Not Found"})
+			case r.Method == "PUT":
+				w.WriteHeader(http.StatusCreated)
+				_ = json.NewEncoder(w).Encode(map[string]any{})
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+	}
+	change := func(create bool) util.Change {
+		return util.Change{
+			Scope: "repo-file", Target: "api:LICENSE", Action: "ensure",
+			Details: map[string]any{
+				"org": "myorg", "repo": "api", "path": "LICENSE", "content": "MIT", "message": "m",
+				"branch": "release", "default_branch": "develop", "create_branch": create,
+			},
+		}
+	}
+
+	t.Run("reports clearly without create_branch", func(t *testing.T) {
+		var created string
+		server := newServer(&created)
+		defer server.Close()
+		err := applyRepoFileEnsure(context.Background(), newTestClient(t, server), change(false))
+		if err == nil || !containsSubstr(err.Error(), `branch "release" does not exist`) {
+			t.Fatalf("expected missing-branch error, got %v", err)
+		}
+		if created != "" {
+			t.Errorf("expected no branch to be created, got %s", created)
+		}
+	})
+
+	t.Run("creates from default branch", func(t *testing.T) {
+		var created string
+		server := newServer(&created)
+		defer server.Close()
+		if err := applyRepoFileEnsure(context.Background(), newTestClient(t, server), change(true)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if created != "refs/heads/release@abc123" {
+			t.Errorf("expected release created from develop's head, got %q", created)
+		}
+	})
 }
@@ -25,6 +25,25 @@ func (f HandlerFunc) Apply(ctx context.Context, c *gh.Client, ch util.Change) er
 	return f(ctx, c, ch)
 }
 
+// Verifier is implemented by handlers that can check, without changing
+// anything, whether a change has already taken effect. A resumed apply asks
+// it about changes the interrupted run started but never finished, so a
+// non-idempotent change such as a team create is not sent twice.
+type Verifier interface {
+	Verify(ctx context.Context, c *gh.Client, ch util.Change) (applied bool, err error)
+}
+
+// verifiedHandler pairs an apply function with its Verifier.
+type verifiedHandler struct {
+	HandlerFunc
+	verify func(ctx context.Context, c *gh.Client, ch util.Change) (bool, error)
+}
+
+// Verify implements Verifier.
+func (h verifiedHandler) Verify(ctx context.Context, c *gh.Client, ch util.Change) (bool, error) {
+	return h.verify(ctx, c, ch)
+}
+
 // registration bundles a handler with the ordering precedence used during apply.
 type registration struct {
 	handler    Handler
@@ -81,29 +100,33 @@ func buildDefaultRegistry() *HandlerRegistry {
 	// Creation / mutation phase (low precedence = runs first).
 	r.Register("custom-role", "create", precedenceCustomRoleCreate, HandlerFunc(applyCustomRoleNoop))
 	r.Register("custom-role", "update", precedenceCustomRoleUpdate, HandlerFunc(applyCustomRoleNoop))
-	r.Register("team", "create", precedenceTeamCreate, HandlerFunc(applyTeamCreate))
-	r.Register("repo", "ensure", precedenceRepoEnsure, HandlerFunc(applyRepoEnsure))
+	r.Register("team", "create", precedenceTeamCreate, verifiedHandler{applyTeamCreate, verifyTeamCreated})
+	r.Register("repo", "ensure", precedenceRepoEnsure, verifiedHandler{applyRepoEnsure, verifyRepoEnsured})
+	r.Register("repo", "unarchive", precedenceRepoUnarchive, verifiedHandler{applyRepoUnarchive, verifyRepoUnarchived})
 	r.Register("team", "update", precedenceTeamUpdate, HandlerFunc(applyTeamUpdate))
 	r.Register("team-repo", "grant", precedenceTeamRepoGrant, HandlerFunc(applyTeamRepoGrant))
 	r.Register("team-member", "ensure", precedenceTeamMemberEnsure, HandlerFunc(applyTeamMemberEnsure))
-	r.Register("repo-file", "ensure", precedenceRepoFileEnsure, HandlerFunc(applyRepoFileEnsure))
+	r.Register("repo-file", "ensure", precedenceRepoFileEnsure, verifiedHandler{applyRepoFileEnsure, verifyRepoFileEnsured})
 	r.Register("repo-topics", "ensure", precedenceRepoTopicsEnsure, HandlerFunc(applyRepoTopicsEnsure))
 	r.Register("repo-template", "ensure", precedenceRepoTemplateEnsure, HandlerFunc(applyRepoTemplateEnsure))
 	r.Register("repo-pin", "ensure", precedenceRepoPinEnsure, HandlerFunc(applyRepoPinEnsure))
 
 	// Cleanup phase (high precedence = runs last).
 	r.Register("repo-file", "delete", precedenceRepoFileDelete, HandlerFunc(applyRepoFileDelete))
+	r.Register("team-member", "remove", precedenceTeamMemberRemove, HandlerFunc(applyTeamMemberRemove))
 	r.Register("org-member", "remove", precedenceOrgMemberRemove, HandlerFunc(applyOrgMemberRemove))
-	r.Register("team", "delete", precedenceTeamDelete, HandlerFunc(applyTeamDelete))
-	r.Register("repo", "delete", precedenceRepoDelete, HandlerFunc(applyRepoDelete))
-	r.Register("custom-role", "delete", precedenceCustomRoleDelete, HandlerFunc(applyCustomRoleNoop))
+	r.Register("team", "delete", precedenceTeamDelete, verifiedHandler{applyTeamDelete, verifyTeamDeleted})
+	r.Register("repo", "archive", precedenceRepoArchive, verifiedHandler{applyRepoArchive, verifyRepoArchived})
+	r.Register("repo", "delete", precedenceRepoDelete, verifiedHandler{applyRepoDelete, verifyRepoDeleted})
+	r.Register("custom-role", "delete", precedenceCustomRoleDelete, HandlerFunc(applyCustomRoleDelete))
 
 	return r
 }
 
-// applyCustomRoleNoop is a placeholder for custom-role changes; they are
-// dispatched via applyCustomRoleChanges before the main loop runs, so this
-// handler is only consulted for precedence ordering and should never execute.
+// applyCustomRoleNoop is a placeholder for custom-role creates and updates;
+// they are dispatched via applyCustomRoleChanges before the main loop runs,
+// so this handler is only consulted for precedence ordering and should never
+// execute.
 func applyCustomRoleNoop(_ context.Context, _ *gh.Client, ch util.Change) error {
 	return fmt.Errorf("custom-role change reached generic apply loop: %s:%s %s", ch.Scope, ch.Action, ch.Target)
 }
@@ -2,13 +2,22 @@ package sync
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"math"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync/atomic"
 	"testing"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
 	"github.com/DragonSecurity/gomgr/internal/gh"
 	"github.com/DragonSecurity/gomgr/internal/util"
 )
@@ -66,6 +75,7 @@ func TestDefaultRegistry_HasKnownKinds(t *testing.T) {
 		{"team", "update"},
 		{"team", "delete"},
 		{"team-member", "ensure"},
+		{"team-member", "remove"},
 		{"repo", "ensure"},
 		{"repo", "delete"},
 		{"team-repo", "grant"},
@@ -101,8 +111,7 @@ func TestDefaultRegistry_PrecedenceOrdering(t *testing.T) {
 func noopHandler(context.Context, *gh.Client, util.Change) error { return nil }
 
 func TestApplyChangesWith_ContinueOnError(t *testing.T) {
-	// A test server so RespectRate's rate-limit lookup has somewhere to go; a
-	// 404 there is only warned about, not fatal.
+	// The handlers never call out; the server only gives the client a URL.
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
 		http.Error(w, "not found", http.StatusNotFound)
 	}))
@@ -157,3 +166,92 @@ func TestApplyChangesWith_ContinueOnError(t *testing.T) {
 		}
 	})
 }
+
+func TestApplyChangesWith_LogsStructuredRecord(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "apply.log")
+	closer, err := util.ConfigureLogging(util.LogOptions{Format: util.LogFormatJSON, File: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _, _ = util.ConfigureLogging(util.LogOptions{}) }()
+
+	reg := NewHandlerRegistry()
+	reg.Register("test", "fail", 10, HandlerFunc(func(context.Context, *gh.Client, util.Change) error {
+		return errors.New("boom")
+	}))
+	changes := []util.Change{{Scope: "test", Action: "fail", Target: "a"}}
+	_ = applyChangesWith(context.Background(), newTestClient(t, server), changes, reg, ApplyOptions{})
+	_ = closer.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rec map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var r map[string]any
+		if json.Unmarshal([]byte(line), &r) == nil && r["scope"] == "test" {
+			rec = r
+		}
+	}
+	if rec == nil {
+		t.Fatalf("no structured apply record in %q", data)
+	}
+	if rec["level"] != "ERROR" || rec["target"] != "a" || rec["action"] != "fail" || rec["error"] != "boom" {
+		t.Errorf("unexpected apply record %v", rec)
+	}
+	if _, ok := rec["duration"]; !ok {
+		t.Errorf("expected duration attribute, got %v", rec)
+	}
+}
+
+func TestApplyChangesWith_RecordsSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(prev)
+
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	reg := NewHandlerRegistry()
+	reg.Register("test", "ok", 10, HandlerFunc(noopHandler))
+	reg.Register("test", "fail", 20, HandlerFunc(func(context.Context, *gh.Client, util.Change) error {
+		return errors.New("boom")
+	}))
+	changes := []util.Change{
+		{Scope: "test", Action: "ok", Target: "a"},
+		{Scope: "test", Action: "fail", Target: "b"},
+	}
+	_ = applyChangesWith(context.Background(), newTestClient(t, server), changes, reg, ApplyOptions{ContinueOnError: true})
+
+	status := map[string]codes.Code{}
+	parents := map[string]string{}
+	ids := map[string]string{}
+	for _, s := range recorder.Ended() {
+		status[s.Name()] = s.Status().Code
+		ids[s.SpanContext().SpanID().String()] = s.Name()
+		parents[s.Name()] = s.Parent().SpanID().String()
+	}
+	if got, ok := status["apply test:ok"]; !ok || got == codes.Error {
+		t.Errorf("expected an OK span for test:ok, got %v (present=%v)", got, ok)
+	}
+	if status["apply test:fail"] != codes.Error {
+		t.Errorf("expected an error span for test:fail, got %v", status["apply test:fail"])
+	}
+	if _, ok := parents["apply test:ok"]; !ok || len(ids) != 2 {
+		t.Errorf("expected exactly the two change spans, got %v", ids)
+	}
+	// Rate limits are read from response headers; applying a change must not
+	// cost an extra /rate_limit lookup.
+	if n := atomic.LoadInt32(&hits); n != 0 {
+		t.Errorf("expected no API calls from no-op handlers, got %d", n)
+	}
+}
@@ -0,0 +1,207 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/DragonSecurity/gomgr/internal/config"
+	"github.com/DragonSecurity/gomgr/internal/gh"
+)
+
+// writeBaseRoles are the base roles that let a CODEOWNERS entry take effect.
+// GitHub silently ignores owners without write access to the repository.
+var writeBaseRoles = map[string]bool{
+	"push":     true,
+	"write":    true,
+	"maintain": true,
+	"admin":    true,
+}
+
+// hasWriteAccess reports whether perm — a built-in permission or the name of a
+// custom role from org.yaml — grants at least write access.
+func hasWriteAccess(perm string, customRoles map[string]string) bool {
+	if writeBaseRoles[perm] {
+		return true
+	}
+	return writeBaseRoles[customRoles[strings.ToLower(perm)]]
+}
+
+// checkCodeowners cross-checks every owner of every synthesized CODEOWNERS
+// file against the access gomgr will grant. A team ref must name a team in
+// the org that is configured or already exists and holds at least write on
+// the repo; a user must get write access through some configured team.
+// config.ValidateCodeOwner only checks syntax, and GitHub ignores entries
+// that fail these checks without telling anyone.
+//
+// Violations are returned as warnings, or as a single error when
+// app.strict_codeowners is set. Configured teams are checked against the
+// YAML; teams that only exist on GitHub cost one API call per repo.
+func checkCodeowners(ctx context.Context, c *gh.Client, cfg *config.Root, st *State) ([]string, error) {
+	for _, fs := range materializeFileSpecs(cfg.App) {
+		if fs.Path == codeownersPath {
+			return nil, nil // hand-authored file wins; nothing is synthesized
+		}
+	}
+
+	allSettings, _, err := collectRepoSettings(cfg, st.Org)
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := resolveAllTemplates(allSettings, st.Org)
+	if err != nil {
+		return nil, err
+	}
+
+	customRoles := map[string]string{}
+	for _, role := range cfg.Org.CustomRoles {
+		customRoles[strings.ToLower(role.Name)] = role.BaseRole
+	}
+	existingTeams := map[string]bool{}
+	for _, t := range st.ActualTeams {
+		existingTeams[strings.ToLower(t.GetSlug())] = true
+	}
+
+	// Mirror planRepoPerms: every team listing a repo is granted the repo's
+	// resolved permission. Org owners are admins of every repo.
+	configuredTeams := map[string]bool{}
+	teamPerm := map[string]map[string]string{} // repo -> team slug -> permission
+	writeUsers := map[string]map[string]bool{} // repo -> login -> has write via a team or as owner
+	for r := range resolved {
+		writeUsers[r] = map[string]bool{}
+		for _, u := range cfg.Org.Owners {
+			writeUsers[r][strings.ToLower(u)] = true
+		}
+	}
+	for _, t := range cfg.Team {
+		slug := strings.ToLower(t.ResolvedSlug())
+		configuredTeams[slug] = true
+		for repo := range t.Repositories {
+			r := strings.ToLower(repo)
+			perm := resolved[r].permission
+			if teamPerm[r] == nil {
+				teamPerm[r] = map[string]string{}
+			}
+			teamPerm[r][slug] = perm
+			if !hasWriteAccess(perm, customRoles) {
+				continue
+			}
+			if writeUsers[r] == nil {
+				writeUsers[r] = map[string]bool{}
+			}
+			for _, u := range append(append([]string{}, t.Maintainers...), t.Members...) {
+				writeUsers[r][strings.ToLower(u)] = true
+			}
+		}
+	}
+
+	repos := make([]string, 0, len(resolved))
+	for r := range resolved {
+		repos = append(repos, r)
+	}
+	sort.Strings(repos)
+	if st.scope.named() {
+		// A scope naming teams or repos only checks the repositories its
+		// changes can touch.
+		inScope := map[string]bool{}
+		for _, t := range cfg.Team {
+			if st.scope.hasTeam(t.ResolvedSlug()) {
+				for repo := range t.Repositories {
+					inScope[strings.ToLower(repo)] = true
+				}
+			}
+		}
+		repos = slices.DeleteFunc(repos, func(r string) bool {
+			return !inScope[r] && !st.scope.hasRepo(r)
+		})
+	}
+
+	// Without the org's full team list, unconfigured teams are looked up
+	// one at a time as CODEOWNERS mentions them.
+	lookedUp := map[string]bool{}
+
+	var violations []string
+	for _, r := range repos {
+		settings := resolved[r]
+		owners := settings.codeowners
+		for _, rule := range settings.codeownerRules {
+			owners = unionStrings(owners, rule.owners)
+		}
+		seen := map[string]bool{}
+		for _, o := range owners {
+			ref := normalizeOwnerRef(o)
+			key := strings.ToLower(ref)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			name := strings.TrimPrefix(key, "@")
+			orgPart, slug, isTeam := strings.Cut(name, "/")
+			if !isTeam {
+				if !writeUsers[r][name] {
+					violations = append(violations, fmt.Sprintf("CODEOWNERS for %s: user %s has no write access through any configured team and is not an org owner", r, ref))
+				}
+				continue
+			}
+
+			if st.teamsPartial && !configuredTeams[slug] && !lookedUp[slug] && strings.EqualFold(orgPart, st.Org) {
+				lookedUp[slug] = true
+				_, _, err := c.REST.Teams.GetTeamBySlug(ctx, st.Org, slug)
+				switch {
+				case err == nil:
+					existingTeams[slug] = true
+				case !isNotFound(err):
+					return nil, fmt.Errorf("get team %s: %w", slug, err)
+				}
+			}
+
+			switch {
+			case !strings.EqualFold(orgPart, st.Org):
+				violations = append(violations, fmt.Sprintf("CODEOWNERS for %s: team %s is not in organization %s", r, ref, st.Org))
+			case configuredTeams[slug]:
+				perm, granted := teamPerm[r][slug]
+				if !granted {
+					violations = append(violations, fmt.Sprintf("CODEOWNERS for %s: team %s is not granted access to the repository", r, ref))
+				} else if !hasWriteAccess(perm, customRoles) {
+					violations = append(violations, fmt.Sprintf("CODEOWNERS for %s: team %s has %q, which is below write access", r, ref, perm))
+				}
+			case existingTeams[slug]:
+				ok, err := existingTeamHasWrite(ctx, c, st.Org, slug, r)
+				if err != nil {
+					return nil, fmt.Errorf("check team %s access to %s: %w", slug, r, err)
+				}
+				if !ok {
+					violations = append(violations, fmt.Sprintf("CODEOWNERS for %s: unmanaged team %s has no write access to the repository", r, ref))
+				} else if cfg.App.DeleteUnconfiguredTeams {
+					violations = append(violations, fmt.Sprintf("CODEOWNERS for %s: team %s is not configured and will be deleted (delete_unconfigured_teams)", r, ref))
+				}
+			default:
+				violations = append(violations, fmt.Sprintf("CODEOWNERS for %s: team %s does not exist", r, ref))
+			}
+		}
+	}
+
+	if cfg.App.StrictCodeowners && len(violations) > 0 {
+		return nil, fmt.Errorf("codeowners validation failed (strict_codeowners):\n  %s", strings.Join(violations, "\n  "))
+	}
+	return violations, nil
+}
+
+// existingTeamHasWrite asks GitHub whether a team that is not in the config
+// holds write access to org/repo. A repo the team cannot see (404) — including
+// one that does not exist yet — counts as no access.
+func existingTeamHasWrite(ctx context.Context, c *gh.Client, org, slug, repo string) (bool, error) {
+	r, resp, err := c.REST.Teams.IsTeamRepoBySlug(ctx, org, slug, org, repo)
+	if err != nil {
+		if (resp != nil && resp.StatusCode == http.StatusNotFound) || isNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	perms := r.GetPermissions()
+	return perms.GetPush() || perms.GetMaintain() || perms.GetAdmin(), nil
+}
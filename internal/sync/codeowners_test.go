@@ -0,0 +1,112 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v88/github"
+
+	"github.com/DragonSecurity/gomgr/internal/config"
+)
+
+func codeownersCheckConfig() *config.Root {
+	return &config.Root{
+		App: config.AppConfig{Org: "acme"},
+		Org: config.OrgConfig{CustomRoles: []config.CustomRoleConfig{{Name: "Releaser", BaseRole: "write"}}},
+		Team: []config.TeamConfig{
+			{Name: "Backend", Members: []string{"octocat"}, Repositories: map[string]any{
+				"api": map[string]any{"permission": "push", "codeowners": []any{
+					"@acme/backend",
+					"octocat",
+					"@acme/typo-team",
+					"@other/backend",
+					"outsider",
+					map[string]any{"pattern": "/docs/", "owners": []any{"@acme/readers", "@acme/legacy"}},
+				}},
+			}},
+			{Name: "Readers", Members: []string{"reader"}, Repositories: map[string]any{
+				"docs": "pull",
+			}},
+			{Name: "Release", Repositories: map[string]any{
+				"tool": map[string]any{"permission": "Releaser", "codeowners": []any{"@acme/release"}},
+			}},
+		},
+	}
+}
+
+func TestCheckCodeowners_ReportsViolations(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/orgs/acme/teams/legacy/repos/acme/api" {
+			_ = json.NewEncoder(w).Encode(map[string]any{"name": "api", "permissions": map[string]bool{"pull": true}})
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	st := &State{Org: "acme", ActualTeams: []*github.Team{{Slug: github.Ptr("legacy")}}}
+	warnings, err := checkCodeowners(context.Background(), newTestClient(t, server), codeownersCheckConfig(), st)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{
+		"team @acme/typo-team does not exist",
+		"team @other/backend is not in organization acme",
+		"user @outsider has no write access",
+		"team @acme/readers is not granted access",
+		"unmanaged team @acme/legacy has no write access",
+	}
+	if len(warnings) != len(want) {
+		t.Fatalf("expected %d warnings, got %d: %v", len(want), len(warnings), warnings)
+	}
+	for _, w := range want {
+		if !containsSubstr(strings.Join(warnings, "\n"), w) {
+			t.Errorf("missing warning %q in %v", w, warnings)
+		}
+	}
+}
+
+func TestCheckCodeowners_OrgOwnerCanOwn(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	cfg := &config.Root{
+		App: config.AppConfig{Org: "acme", StrictCodeowners: true},
+		Org: config.OrgConfig{Owners: []string{"Admin"}},
+		Team: []config.TeamConfig{
+			{Name: "Readers", Members: []string{"reader"}, Repositories: map[string]any{
+				"docs": map[string]any{"permission": "pull", "codeowners": []any{"@admin"}},
+			}},
+		},
+	}
+	warnings, err := checkCodeowners(context.Background(), newTestClient(t, server), cfg, &State{Org: "acme"})
+	if err != nil || len(warnings) != 0 {
+		t.Fatalf("expected an org owner to be a valid codeowner, got %v, %v", warnings, err)
+	}
+}
+
+func TestCheckCodeowners_StrictFails(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	cfg := codeownersCheckConfig()
+	cfg.App.StrictCodeowners = true
+	_, err := checkCodeowners(context.Background(), newTestClient(t, server), cfg, &State{Org: "acme"})
+	if err == nil || !strings.Contains(err.Error(), "typo-team") {
+		t.Fatalf("expected strict mode error naming typo-team, got %v", err)
+	}
+}
+
+func TestCheckCodeowners_SkipsUserDeclaredFile(t *testing.T) {
+	cfg := codeownersCheckConfig()
+	cfg.App.Files = []config.FileSpec{{Path: codeownersPath, Content: "* @acme/backend\n"}}
+	warnings, err := checkCodeowners(context.Background(), nil, cfg, &State{Org: "acme"})
+	if err != nil || len(warnings) != 0 {
+		t.Fatalf("expected no checks when CODEOWNERS is hand-authored, got %v, %v", warnings, err)
+	}
+}
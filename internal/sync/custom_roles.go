@@ -9,6 +9,7 @@ import (
 
 	"github.com/DragonSecurity/gomgr/internal/config"
 	"github.com/DragonSecurity/gomgr/internal/gh"
+	"github.com/DragonSecurity/gomgr/internal/tracing"
 	"github.com/DragonSecurity/gomgr/internal/util"
 )
 
@@ -35,8 +36,10 @@ func planCustomRoles(ctx context.Context, c *gh.Client, cfg *config.Root, st *St
 	// Fetch existing custom roles from GitHub
 	existingRolesResp, _, err := c.REST.Organizations.ListCustomRepoRoles(ctx, org)
 	if err != nil {
-		// If the org doesn't have custom roles enabled (not Enterprise Cloud),
-		// return an error with helpful context
+		// A 404 means the server or the org's plan has no custom roles.
+		if isNotFound(err) {
+			return out, customRolesUnsupported(c, err)
+		}
 		return out, fmt.Errorf("list custom repo roles: %w (note: custom roles require GitHub Enterprise Cloud)", err)
 	}
 
@@ -131,6 +134,9 @@ func planCustomRoleCleanups(ctx context.Context, c *gh.Client, cfg *config.Root,
 	existingRolesResp, _, err := c.REST.Organizations.ListCustomRepoRoles(ctx, org)
 	if err != nil {
 		// If custom roles aren't available, skip cleanup
+		if isNotFound(err) && cfg.App.DryWarnings.WarnUnmanagedCustomRoles {
+			warnings = append(warnings, fmt.Sprintf("Skipped unmanaged custom role check: %v", customRolesUnsupported(c, nil)))
+		}
 		return out, warnings, nil
 	}
 
@@ -148,6 +154,10 @@ func planCustomRoleCleanups(ctx context.Context, c *gh.Client, cfg *config.Root,
 		}
 		roleName := *role.Name
 		if !desiredNames[strings.ToLower(roleName)] {
+			if matchesFold(cfg.App.Ignore.CustomRoles, roleName) {
+				st.Ignored++
+				continue
+			}
 			unmanagedRoles = append(unmanagedRoles, roleName)
 			if cfg.App.DeleteUnmanagedCustomRoles {
 				out = append(out, util.Change{
@@ -171,68 +181,93 @@ func planCustomRoleCleanups(ctx context.Context, c *gh.Client, cfg *config.Root,
 	return out, warnings, nil
 }
 
-// applyCustomRoleChanges handles creating, updating, and deleting custom roles
-func applyCustomRoleChanges(ctx context.Context, c *gh.Client, changes []util.Change) error {
+// customRolesUnsupported is the capability error for a server or org
+// without custom repository roles.
+func customRolesUnsupported(c *gh.Client, err error) error {
+	hint := "custom roles require GitHub Enterprise Cloud"
+	if c.IsGHES() {
+		hint = "this GitHub Enterprise Server version has no custom repository roles API; remove org.custom_roles or upgrade"
+	}
+	return c.Unsupported("custom repository roles", hint, err)
+}
+
+// applyCustomRoleChanges handles creating and updating custom roles. Each
+// outcome is reported through applyOpts (audit trail and OnChange hook).
+// Deletes run with the other cleanups, through applyCustomRoleDelete.
+func applyCustomRoleChanges(ctx context.Context, c *gh.Client, changes []util.Change, applyOpts ApplyOptions) error {
 	for _, ch := range changes {
-		if !strings.HasPrefix(ch.Scope, "custom-role") {
+		if !strings.HasPrefix(ch.Scope, "custom-role") || isCleanup(ch) {
 			continue
 		}
 
 		util.Infof("custom-role:%s %s", ch.Action, ch.Target)
+		applyOpts.Journal.Start(ch)
 
-		if err := gh.RespectRate(ctx, c.REST); err != nil {
-			util.Warnf("rate limit check failed: %v", err)
-		}
+		spanCtx, span := startChangeSpan(ctx, ch)
 
 		d, ok := ch.Details.(customRoleChange)
 		if !ok {
-			return fmt.Errorf("invalid details for custom-role change")
+			err := fmt.Errorf("invalid details for custom-role change")
+			tracing.End(span, err)
+			return err
 		}
 
-		switch ch.Scope + ":" + ch.Action {
-		case "custom-role:create":
-			opts := &github.CreateOrUpdateCustomRepoRoleOptions{
-				Name:        github.Ptr(d.Name),
-				BaseRole:    github.Ptr(d.BaseRole),
-				Permissions: d.Permissions,
-			}
-			if d.Description != "" {
-				opts.Description = github.Ptr(d.Description)
-			}
+		err := applyCustomRoleChange(spanCtx, c, ch, d)
+		tracing.End(span, err)
+		applyOpts.record(ctx, ch, err)
+		if err != nil {
+			return err
+		}
+	}
 
-			_, _, err := c.REST.Organizations.CreateCustomRepoRole(ctx, d.Org, opts)
-			if err != nil {
-				util.Audit(ch.Scope, ch.Target, ch.Action, "error")
-				return fmt.Errorf("create custom role %q: %w", d.Name, err)
-			}
+	return nil
+}
 
-		case "custom-role:update":
-			opts := &github.CreateOrUpdateCustomRepoRoleOptions{
-				Name:        github.Ptr(d.Name),
-				BaseRole:    github.Ptr(d.BaseRole),
-				Permissions: d.Permissions,
-			}
-			if d.Description != "" {
-				opts.Description = github.Ptr(d.Description)
-			}
+// applyCustomRoleDelete deletes a custom role no longer in org.yaml.
+func applyCustomRoleDelete(ctx context.Context, c *gh.Client, ch util.Change) error {
+	d, ok := ch.Details.(customRoleChange)
+	if !ok {
+		return fmt.Errorf("invalid details for custom-role change")
+	}
+	return applyCustomRoleChange(ctx, c, ch, d)
+}
 
-			_, _, err := c.REST.Organizations.UpdateCustomRepoRole(ctx, d.Org, d.ID, opts)
-			if err != nil {
-				util.Audit(ch.Scope, ch.Target, ch.Action, "error")
-				return fmt.Errorf("update custom role %q (ID %d): %w", d.Name, d.ID, err)
-			}
+// applyCustomRoleChange creates, updates or deletes one custom role.
+func applyCustomRoleChange(ctx context.Context, c *gh.Client, ch util.Change, d customRoleChange) error {
+	switch ch.Scope + ":" + ch.Action {
+	case "custom-role:create":
+		opts := &github.CreateOrUpdateCustomRepoRoleOptions{
+			Name:        github.Ptr(d.Name),
+			BaseRole:    github.Ptr(d.BaseRole),
+			Permissions: d.Permissions,
+		}
+		if d.Description != "" {
+			opts.Description = github.Ptr(d.Description)
+		}
 
-		case "custom-role:delete":
-			_, err := c.REST.Organizations.DeleteCustomRepoRole(ctx, d.Org, d.ID)
-			if err != nil {
-				util.Audit(ch.Scope, ch.Target, ch.Action, "error")
-				return fmt.Errorf("delete custom role %q (ID %d): %w", d.Name, d.ID, err)
-			}
+		if _, _, err := c.REST.Organizations.CreateCustomRepoRole(ctx, d.Org, opts); err != nil {
+			return fmt.Errorf("create custom role %q: %w", d.Name, err)
 		}
 
-		util.Audit(ch.Scope, ch.Target, ch.Action, "ok")
-	}
+	case "custom-role:update":
+		opts := &github.CreateOrUpdateCustomRepoRoleOptions{
+			Name:        github.Ptr(d.Name),
+			BaseRole:    github.Ptr(d.BaseRole),
+			Permissions: d.Permissions,
+		}
+		if d.Description != "" {
+			opts.Description = github.Ptr(d.Description)
+		}
 
+		if _, _, err := c.REST.Organizations.UpdateCustomRepoRole(ctx, d.Org, d.ID, opts); err != nil {
+			return fmt.Errorf("update custom role %q (ID %d): %w", d.Name, d.ID, err)
+		}
+
+	case "custom-role:delete":
+		if _, err := c.REST.Organizations.DeleteCustomRepoRole(ctx, d.Org, d.ID); err != nil {
+			return fmt.Errorf("delete custom role %q (ID %d): %w", d.Name, d.ID, err)
+		}
+	}
 	return nil
 }
 
@@ -1,7 +1,15 @@
 package sync
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/DragonSecurity/gomgr/internal/config"
+	"github.com/DragonSecurity/gomgr/internal/gh"
 )
 
 func TestPermissionsEqual(t *testing.T) {
@@ -64,3 +72,24 @@ func TestPermissionsEqual(t *testing.T) {
 		})
 	}
 }
+
+func TestPlanCustomRoles_UnsupportedServer(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	c := newTestClient(t, server)
+	c.Endpoints = gh.Endpoints{BaseURL: "https://ghe.example.com/api/v3/"}
+	cfg := &config.Root{
+		App: config.AppConfig{Org: "myorg"},
+		Org: config.OrgConfig{CustomRoles: []config.CustomRoleConfig{{Name: "deployer", BaseRole: "read"}}},
+	}
+
+	_, err := planCustomRoles(context.Background(), c, cfg, &State{Org: "myorg"})
+	var capErr *gh.CapabilityError
+	if !errors.As(err, &capErr) {
+		t.Fatalf("expected a CapabilityError, got %v", err)
+	}
+	if capErr.Server != "ghe.example.com" || !strings.Contains(capErr.Hint, "Enterprise Server") {
+		t.Errorf("capability error = %+v", capErr)
+	}
+}
@@ -1,22 +1,37 @@
 package sync
 
 import (
+	"context"
+	"encoding/base64"
 	"fmt"
+	"net/http"
 	"sort"
 	"strings"
+	"unicode/utf8"
+
+	"github.com/google/go-github/v88/github"
 
 	"github.com/DragonSecurity/gomgr/internal/config"
+	"github.com/DragonSecurity/gomgr/internal/gh"
 	"github.com/DragonSecurity/gomgr/internal/templates"
 	"github.com/DragonSecurity/gomgr/internal/util"
 )
 
-const defaultFileBranch = "main"
-
 // codeownersPath is the canonical CODEOWNERS location gomgr writes to.
 // GitHub also reads CODEOWNERS and docs/CODEOWNERS; .github/ is preferred so
 // the file stays out of the repo root.
 const codeownersPath = ".github/CODEOWNERS"
 
+// isCodeownersPath reports whether p is one of the locations GitHub reads
+// CODEOWNERS from.
+func isCodeownersPath(p string) bool {
+	switch p {
+	case codeownersPath, "CODEOWNERS", "docs/CODEOWNERS":
+		return true
+	}
+	return false
+}
+
 // signOffPrefix is the trailer key DCO tooling and commit_message_pattern
 // rulesets look for.
 const signOffPrefix = "Signed-off-by:"
@@ -52,7 +67,6 @@ func materializeFileSpecs(app config.AppConfig) []config.FileSpec {
 			Path:    ".github/renovate.json",
 			Content: app.RenovateConfig,
 			Message: "chore: add Renovate config",
-			Branch:  defaultFileBranch,
 		})
 	}
 
@@ -71,18 +85,25 @@ func materializeFileSpecs(app config.AppConfig) []config.FileSpec {
 	return final
 }
 
-// planRepoFiles renders each FileSpec for the given repo (when it matches the
-// Only filter) and returns a list of repo-file:ensure changes. emittedFiles is
+// planRepoFiles renders each FileSpec for the given repo (when its selectors
+// match, see templates.MatchesRepo) and returns a list of repo-file:ensure
+// changes. emittedFiles is
 // updated in place so the same path is only emitted once per repo, even when
 // multiple teams reference the same repository.
 //
 // signOff, when non-empty, is appended to every commit message as a
 // Signed-off-by trailer. It is applied here rather than at apply time so a dry
 // run shows the message that will actually be committed.
-func planRepoFiles(org, repo, repoKey string, specs []config.FileSpec, signOff string, emittedFiles map[string]bool) ([]util.Change, error) {
+//
+// Specs without an explicit Branch target the repo's actual default branch.
+// For repos that don't exist yet the branch is left empty, which the apply
+// handler turns into "whatever default the new repo got".
+func planRepoFiles(org string, info templates.RepoInfo, repoKey string, specs []config.FileSpec, signOff string, emittedFiles map[string]bool) ([]util.Change, []string, error) {
 	var out []util.Change
+	var warnings []string
+	repo := info.Name
 	for _, spec := range specs {
-		if !templates.MatchesRepo(spec, repo) {
+		if !templates.MatchesRepo(spec, info) {
 			continue
 		}
 		dedupeKey := repoKey + ":" + spec.Path
@@ -92,7 +113,20 @@ func planRepoFiles(org, repo, repoKey string, specs []config.FileSpec, signOff s
 
 		content, err := templates.RenderFile(spec, templates.FileData{Org: org, Repo: repo})
 		if err != nil {
-			return nil, fmt.Errorf("render %s for %s/%s: %w", spec.Path, org, repo, err)
+			return nil, nil, fmt.Errorf("render %s for %s/%s: %w", spec.Path, org, repo, err)
+		}
+		if spec.Merge != "" {
+			// Catch content that will never merge now rather than mid-apply.
+			if _, _, err := templates.MergeStructured("", content, spec.Merge, spec.MergeArrays); err != nil {
+				return nil, nil, fmt.Errorf("render %s for %s/%s: %w", spec.Path, org, repo, err)
+			}
+		}
+		if isCodeownersPath(spec.Path) && !spec.Raw {
+			// A hand-authored CODEOWNERS is the org's own; flag rules GitHub
+			// would ignore, but write it as given.
+			if err := config.ValidateCodeOwnersFile(content); err != nil {
+				warnings = append(warnings, fmt.Sprintf("%s for %s/%s: %v", spec.Path, org, repo, err))
+			}
 		}
 
 		message := spec.Message
@@ -102,26 +136,91 @@ func planRepoFiles(org, repo, repoKey string, specs []config.FileSpec, signOff s
 		message = withSignOff(message, signOff)
 		branch := spec.Branch
 		if branch == "" {
-			branch = defaultFileBranch
+			branch = info.DefaultBranch
 		}
 
+		details := map[string]any{
+			"org":       org,
+			"repo":      repo,
+			"path":      spec.Path,
+			"content":   content,
+			"message":   message,
+			"branch":    branch,
+			"reconcile": spec.Reconcile,
+		}
+		if !utf8.ValidString(content) {
+			// Binary raw content would not survive a JSON plan or journal.
+			delete(details, "content")
+			details["content_base64"] = base64.StdEncoding.EncodeToString([]byte(content))
+		}
+		if spec.Branch != "" && spec.Branch != info.DefaultBranch {
+			// An explicit non-default branch may not exist yet; the handler
+			// needs the base to branch from and whether it may create it.
+			details["default_branch"] = info.DefaultBranch
+			details["create_branch"] = spec.CreateBranch
+		}
+		if spec.Mode != "" {
+			details["mode"] = spec.Mode
+		}
+		if spec.Merge != "" {
+			details["merge"] = spec.Merge
+			details["merge_arrays"] = spec.MergeArrays
+		}
 		out = append(out, util.Change{
-			Scope:  "repo-file",
-			Target: repoKey + ":" + spec.Path,
-			Action: "ensure",
-			Details: map[string]any{
-				"org":       org,
-				"repo":      repo,
-				"path":      spec.Path,
-				"content":   content,
-				"message":   message,
-				"branch":    branch,
-				"reconcile": spec.Reconcile,
-			},
+			Scope:   "repo-file",
+			Target:  repoKey + ":" + spec.Path,
+			Action:  "ensure",
+			Details: details,
 		})
 		emittedFiles[dedupeKey] = true
 	}
-	return out, nil
+	return out, warnings, nil
+}
+
+// collectRepoInfos resolves the attributes FileSpec match criteria select on
+// for every managed repo, keyed by lower-cased name. Teams are unioned across
+// every team that references the repo; topics come from the resolved settings
+// (template inheritance applied), exactly as topic changes are planned.
+// Visibility falls back to the repo's actual GitHub
+// visibility when config leaves it unset, and to private (the create
+// default) for repos that don't exist yet.
+func collectRepoInfos(cfg *config.Root, resolved map[string]repoSettings, existingRepos map[string]*github.Repository) map[string]templates.RepoInfo {
+	infos := map[string]templates.RepoInfo{}
+	for _, t := range cfg.Team {
+		slug := t.ResolvedSlug()
+		for repo := range t.Repositories {
+			r := strings.ToLower(repo)
+			settings := resolved[r]
+			info, ok := infos[r]
+			if !ok {
+				info = templates.RepoInfo{Name: repo, Visibility: settings.visibility}
+				existing := existingRepos[r]
+				if existing != nil {
+					info.DefaultBranch = existing.GetDefaultBranch()
+				}
+				if info.Visibility == "" {
+					info.Visibility = "private"
+					if existing.GetVisibility() != "" {
+						info.Visibility = existing.GetVisibility()
+					}
+				}
+			}
+			info.Template = settings.template
+			info.Topics = settings.topics
+			info.Teams = appendUnique(info.Teams, slug)
+			infos[r] = info
+		}
+	}
+	return infos
+}
+
+func appendUnique(list []string, v string) []string {
+	for _, item := range list {
+		if item == v {
+			return list
+		}
+	}
+	return append(list, v)
 }
 
 // normalizeOwnerRef prefixes bare usernames with @ so CODEOWNERS reads
@@ -134,9 +233,20 @@ func normalizeOwnerRef(o string) string {
 	return "@" + o
 }
 
-// renderCodeowners returns the canonical CODEOWNERS body for a single repo:
-// a single catch-all rule listing every owner. Duplicate refs are collapsed.
-func renderCodeowners(owners []string) string {
+// codeownersSpec is the desired CODEOWNERS state for one repo: catch-all
+// owners plus ordered path-scoped rules.
+type codeownersSpec struct {
+	owners []string
+	rules  []codeownerRule
+}
+
+// empty reports whether the spec declares nothing to render.
+func (s codeownersSpec) empty() bool {
+	return len(s.owners) == 0 && len(s.rules) == 0
+}
+
+// normalizeOwnerRefs prefixes each owner with @ and collapses duplicates.
+func normalizeOwnerRefs(owners []string) []string {
 	refs := make([]string, 0, len(owners))
 	seen := map[string]bool{}
 	for _, o := range owners {
@@ -147,10 +257,26 @@ func renderCodeowners(owners []string) string {
 		seen[ref] = true
 		refs = append(refs, ref)
 	}
-	if len(refs) == 0 {
-		return ""
+	return refs
+}
+
+// renderCodeowners returns the canonical CODEOWNERS body for a single repo:
+// a catch-all rule listing every owner, followed by one line per path-scoped
+// rule in declaration order. Since GitHub applies the last matching line, the
+// catch-all goes first so path rules override it. Duplicate refs are collapsed.
+func renderCodeowners(spec codeownersSpec) string {
+	var b strings.Builder
+	if refs := normalizeOwnerRefs(spec.owners); len(refs) > 0 {
+		fmt.Fprintf(&b, "* %s\n", strings.Join(refs, " "))
+	}
+	for _, rule := range spec.rules {
+		refs := normalizeOwnerRefs(rule.owners)
+		if len(refs) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "%s %s\n", rule.pattern, strings.Join(refs, " "))
 	}
-	return fmt.Sprintf("* %s\n", strings.Join(refs, " "))
+	return b.String()
 }
 
 // planCodeowners emits a repo-file:ensure change writing .github/CODEOWNERS
@@ -158,11 +284,12 @@ func renderCodeowners(owners []string) string {
 // CODEOWNERS file via app.files, synthesis is skipped entirely so the
 // hand-authored content wins.
 //
-// ownersByRepo is keyed by lower-cased repo name; repoNames maps that key
-// back to the canonical name for the apply payload.
-func planCodeowners(org string, ownersByRepo map[string][]string, repoNames map[string]string, userFilePaths map[string]bool, signOff string, emittedFiles map[string]bool) []util.Change {
+// ownersByRepo is keyed by lower-cased repo name; repos maps that key back to
+// the canonical name and default branch for the apply payload. Each rendered
+// file is validated so a rule GitHub would silently ignore fails the plan.
+func planCodeowners(org string, ownersByRepo map[string]codeownersSpec, repos map[string]templates.RepoInfo, userFilePaths map[string]bool, signOff string, emittedFiles map[string]bool) ([]util.Change, error) {
 	if userFilePaths[codeownersPath] {
-		return nil
+		return nil, nil
 	}
 	keys := make([]string, 0, len(ownersByRepo))
 	for r := range ownersByRepo {
@@ -172,16 +299,18 @@ func planCodeowners(org string, ownersByRepo map[string][]string, repoNames map[
 
 	var out []util.Change
 	for _, r := range keys {
-		owners := ownersByRepo[r]
-		content := renderCodeowners(owners)
+		content := renderCodeowners(ownersByRepo[r])
 		if content == "" {
 			continue
 		}
+		if err := config.ValidateCodeOwnersFile(content); err != nil {
+			return nil, fmt.Errorf("codeowners for repo %s: %w", r, err)
+		}
 		dedupeKey := r + ":" + codeownersPath
 		if emittedFiles[dedupeKey] {
 			continue
 		}
-		repoName := repoNames[r]
+		repoName := repos[r].Name
 		if repoName == "" {
 			repoName = r
 		}
@@ -195,13 +324,13 @@ func planCodeowners(org string, ownersByRepo map[string][]string, repoNames map[
 				"path":      codeownersPath,
 				"content":   content,
 				"message":   withSignOff("chore: sync CODEOWNERS", signOff),
-				"branch":    defaultFileBranch,
+				"branch":    repos[r].DefaultBranch,
 				"reconcile": true,
 			},
 		})
 		emittedFiles[dedupeKey] = true
 	}
-	return out
+	return out, nil
 }
 
 // planCodeownersDeletions emits a repo-file:delete change for every managed
@@ -209,16 +338,16 @@ func planCodeowners(org string, ownersByRepo map[string][]string, repoNames map[
 // app.delete_stale_codeowners; when the user has declared CODEOWNERS in
 // app.files the deletion is skipped (hand-authored file wins).
 //
-// The apply handler is idempotent — a delete against a repo with no
-// .github/CODEOWNERS no-ops — so this can safely fire for repos that never
-// had the file.
-func planCodeownersDeletions(org string, managedRepos map[string]bool, repoNames map[string]string, ownersByRepo map[string][]string, userFilePaths map[string]bool, signOff string, emittedFiles map[string]bool) []util.Change {
+// Candidates are emitted whether or not the file exists; the caller passes
+// them through keepExistingFiles so repos that never had a CODEOWNERS do not
+// plan a delete that counts against the destructive-change limit.
+func planCodeownersDeletions(org string, managedRepos map[string]bool, repos map[string]templates.RepoInfo, ownersByRepo map[string]codeownersSpec, userFilePaths map[string]bool, signOff string, emittedFiles map[string]bool) []util.Change {
 	if userFilePaths[codeownersPath] {
 		return nil
 	}
 	keys := make([]string, 0, len(managedRepos))
 	for r := range managedRepos {
-		if len(ownersByRepo[r]) > 0 {
+		if !ownersByRepo[r].empty() {
 			continue
 		}
 		keys = append(keys, r)
@@ -231,7 +360,7 @@ func planCodeownersDeletions(org string, managedRepos map[string]bool, repoNames
 		if emittedFiles[dedupeKey] {
 			continue
 		}
-		repoName := repoNames[r]
+		repoName := repos[r].Name
 		if repoName == "" {
 			repoName = r
 		}
@@ -244,10 +373,35 @@ func planCodeownersDeletions(org string, managedRepos map[string]bool, repoNames
 				"repo":    repoName,
 				"path":    codeownersPath,
 				"message": withSignOff("chore: remove stale CODEOWNERS", signOff),
-				"branch":  defaultFileBranch,
+				"branch":  repos[r].DefaultBranch,
 			},
 		})
 		emittedFiles[dedupeKey] = true
 	}
 	return out
 }
+
+// keepExistingFiles drops the repo-file changes whose file does not exist on
+// their branch. A missing repository or branch counts as a missing file.
+func keepExistingFiles(ctx context.Context, c *gh.Client, changes []util.Change) ([]util.Change, error) {
+	var out []util.Change
+	for _, ch := range changes {
+		d, err := extractDetails(ch)
+		if err != nil {
+			return nil, err
+		}
+		org, repo, path := detailString(d, "org"), detailString(d, "repo"), detailString(d, "path")
+		opts := &github.RepositoryContentGetOptions{Ref: detailString(d, "branch")}
+		file, _, resp, err := c.REST.Repositories.GetContents(ctx, org, repo, path, opts)
+		if err != nil {
+			if (resp != nil && resp.StatusCode == http.StatusNotFound) || isNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("check %s/%s:%s: %w", org, repo, path, err)
+		}
+		if file != nil {
+			out = append(out, ch)
+		}
+	}
+	return out, nil
+}
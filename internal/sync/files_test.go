@@ -4,7 +4,10 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/google/go-github/v88/github"
+
 	"github.com/DragonSecurity/gomgr/internal/config"
+	"github.com/DragonSecurity/gomgr/internal/templates"
 )
 
 func TestMaterializeFileSpecs_LegacyFlags(t *testing.T) {
@@ -104,7 +107,7 @@ func TestPlanRepoFiles_SignsOffCustomAndDefaultMessages(t *testing.T) {
 		{Path: "LICENSE", Content: "MIT\n"},
 	}
 
-	changes, err := planRepoFiles("Acme", "widgets", "widgets", specs, testSignOff, map[string]bool{})
+	changes, _, err := planRepoFiles("Acme", templates.RepoInfo{Name: "widgets"}, "widgets", specs, testSignOff, map[string]bool{})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -123,10 +126,13 @@ func TestPlanRepoFiles_SignsOffCustomAndDefaultMessages(t *testing.T) {
 }
 
 func TestPlanCodeowners_SignsOffSyncAndDeleteMessages(t *testing.T) {
-	owners := map[string][]string{"widgets": {"@acme/platform"}}
-	names := map[string]string{"widgets": "widgets"}
+	owners := map[string]codeownersSpec{"widgets": {owners: []string{"@acme/platform"}}}
+	names := map[string]templates.RepoInfo{"widgets": {Name: "widgets", DefaultBranch: "main"}}
 
-	changes := planCodeowners("acme", owners, names, map[string]bool{}, testSignOff, map[string]bool{})
+	changes, err := planCodeowners("acme", owners, names, map[string]bool{}, testSignOff, map[string]bool{})
+	if err != nil {
+		t.Fatalf("planCodeowners: %v", err)
+	}
 	if len(changes) != 1 {
 		t.Fatalf("expected 1 codeowners change, got %d", len(changes))
 	}
@@ -136,7 +142,7 @@ func TestPlanCodeowners_SignsOffSyncAndDeleteMessages(t *testing.T) {
 	}
 
 	managed := map[string]bool{"widgets": true}
-	deletions := planCodeownersDeletions("acme", managed, names, map[string][]string{}, map[string]bool{}, testSignOff, map[string]bool{})
+	deletions := planCodeownersDeletions("acme", managed, names, map[string]codeownersSpec{}, map[string]bool{}, testSignOff, map[string]bool{})
 	if len(deletions) != 1 {
 		t.Fatalf("expected 1 deletion change, got %d", len(deletions))
 	}
@@ -153,7 +159,7 @@ func TestPlanRepoFiles_RendersAndDedupes(t *testing.T) {
 	}
 	emitted := map[string]bool{}
 
-	changes, err := planRepoFiles("Acme", "widgets", "widgets", specs, "", emitted)
+	changes, _, err := planRepoFiles("Acme", templates.RepoInfo{Name: "widgets", DefaultBranch: "trunk"}, "widgets", specs, "", emitted)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -176,12 +182,18 @@ func TestPlanRepoFiles_RendersAndDedupes(t *testing.T) {
 	if licenseDetails["message"] != "chore: add LICENSE" {
 		t.Errorf("expected default commit message, got %q", licenseDetails["message"])
 	}
-	if licenseDetails["branch"] != "main" {
-		t.Errorf("expected default branch main, got %q", licenseDetails["branch"])
+	if licenseDetails["branch"] != "trunk" {
+		t.Errorf("expected repo default branch trunk, got %q", licenseDetails["branch"])
+	}
+	if _, ok := licenseDetails["default_branch"]; ok {
+		t.Error("expected no branch-creation details when writing to the default branch")
+	}
+	if readmeDetails["default_branch"] != "trunk" {
+		t.Errorf("expected explicit branch to carry the default branch as base, got %v", readmeDetails["default_branch"])
 	}
 
 	// Calling again should be a no-op because emitted tracks both paths now.
-	more, err := planRepoFiles("Acme", "widgets", "widgets", specs, "", emitted)
+	more, _, err := planRepoFiles("Acme", templates.RepoInfo{Name: "widgets"}, "widgets", specs, "", emitted)
 	if err != nil {
 		t.Fatalf("unexpected error on second call: %v", err)
 	}
@@ -194,7 +206,7 @@ func TestPlanRepoFiles_OnlyGlobSkipsNonMatch(t *testing.T) {
 	specs := []config.FileSpec{
 		{Path: "LICENSE", Content: "MIT", Only: []string{"public-*"}},
 	}
-	changes, err := planRepoFiles("Acme", "internal-api", "internal-api", specs, "", map[string]bool{})
+	changes, _, err := planRepoFiles("Acme", templates.RepoInfo{Name: "internal-api"}, "internal-api", specs, "", map[string]bool{})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -202,7 +214,7 @@ func TestPlanRepoFiles_OnlyGlobSkipsNonMatch(t *testing.T) {
 		t.Errorf("expected no changes for non-matching repo, got %d", len(changes))
 	}
 
-	changes, err = planRepoFiles("Acme", "public-docs", "public-docs", specs, "", map[string]bool{})
+	changes, _, err = planRepoFiles("Acme", templates.RepoInfo{Name: "public-docs"}, "public-docs", specs, "", map[string]bool{})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -211,14 +223,62 @@ func TestPlanRepoFiles_OnlyGlobSkipsNonMatch(t *testing.T) {
 	}
 }
 
+func TestCollectRepoInfos(t *testing.T) {
+	cfg := &config.Root{Team: []config.TeamConfig{
+		{Name: "Backend", Repositories: map[string]any{
+			"API":  map[string]any{"permission": "push", "topics": []any{"go"}},
+			"docs": "pull",
+		}},
+		{Name: "Platform", Repositories: map[string]any{
+			"api": map[string]any{"permission": "admin", "topics": []any{"infra"}, "visibility": "internal"},
+		}},
+	}}
+	all, _, err := collectRepoSettings(cfg, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	existing := map[string]*github.Repository{"docs": {Visibility: github.Ptr("public")}}
+
+	infos := collectRepoInfos(cfg, all, existing)
+	api := infos["api"]
+	if len(api.Teams) != 2 {
+		t.Errorf("expected teams unioned across teams, got %+v", api)
+	}
+	if api.Visibility != "internal" || len(api.Topics) != 1 || api.Topics[0] != "infra" {
+		t.Errorf("expected resolved settings for api, got %+v", api)
+	}
+	if infos["docs"].Visibility != "public" {
+		t.Errorf("expected docs visibility from GitHub, got %q", infos["docs"].Visibility)
+	}
+}
+
+func TestPlanRepoFiles_UnknownDefaultBranchLeftEmpty(t *testing.T) {
+	specs := []config.FileSpec{{Path: "LICENSE", Content: "MIT"}}
+	changes, _, err := planRepoFiles("Acme", templates.RepoInfo{Name: "new-repo"}, "new-repo", specs, "", map[string]bool{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := changes[0].Details.(map[string]any)["branch"]; got != "" {
+		t.Errorf("expected empty branch for a repo not yet created, got %q", got)
+	}
+}
+
 func TestPlanRepoFiles_BadTemplatePropagates(t *testing.T) {
 	specs := []config.FileSpec{{Path: "bad.md", Content: "{{.Missing}}"}}
-	_, err := planRepoFiles("Acme", "widgets", "widgets", specs, "", map[string]bool{})
+	_, _, err := planRepoFiles("Acme", templates.RepoInfo{Name: "widgets"}, "widgets", specs, "", map[string]bool{})
 	if err == nil {
 		t.Fatal("expected template error")
 	}
 }
 
+func TestPlanRepoFiles_MergeRejectsUnparseableContent(t *testing.T) {
+	specs := []config.FileSpec{{Path: "renovate.json", Content: `{"extends": [{{.Repo}}]}`, Merge: config.MergeJSON}}
+	_, _, err := planRepoFiles("Acme", templates.RepoInfo{Name: "widgets"}, "widgets", specs, "", map[string]bool{})
+	if err == nil || !strings.Contains(err.Error(), "parse rendered content as json") {
+		t.Fatalf("expected parse error at plan time, got %v", err)
+	}
+}
+
 func TestMaterializeFileSpecs_PreservesUserOrder(t *testing.T) {
 	app := config.AppConfig{
 		Files: []config.FileSpec{
@@ -237,36 +297,55 @@ func TestMaterializeFileSpecs_PreservesUserOrder(t *testing.T) {
 
 func TestRenderCodeowners(t *testing.T) {
 	tests := []struct {
-		name   string
-		owners []string
-		want   string
+		name string
+		spec codeownersSpec
+		want string
 	}{
-		{"empty", nil, ""},
-		{"bare username", []string{"octocat"}, "* @octocat\n"},
-		{"already prefixed", []string{"@octocat"}, "* @octocat\n"},
-		{"team ref", []string{"@my-org/team"}, "* @my-org/team\n"},
-		{"dedup", []string{"octocat", "@octocat"}, "* @octocat\n"},
-		{"multiple", []string{"a", "@b", "@org/t"}, "* @a @b @org/t\n"},
+		{"empty", codeownersSpec{}, ""},
+		{"bare username", codeownersSpec{owners: []string{"octocat"}}, "* @octocat\n"},
+		{"already prefixed", codeownersSpec{owners: []string{"@octocat"}}, "* @octocat\n"},
+		{"team ref", codeownersSpec{owners: []string{"@my-org/team"}}, "* @my-org/team\n"},
+		{"dedup", codeownersSpec{owners: []string{"octocat", "@octocat"}}, "* @octocat\n"},
+		{"multiple", codeownersSpec{owners: []string{"a", "@b", "@org/t"}}, "* @a @b @org/t\n"},
+		{
+			"catch-all then rules in order",
+			codeownersSpec{
+				owners: []string{"@org/platform"},
+				rules: []codeownerRule{
+					{pattern: "/infra/", owners: []string{"@org/devops-team"}},
+					{pattern: "*.sql", owners: []string{"dba", "@dba"}},
+				},
+			},
+			"* @org/platform\n/infra/ @org/devops-team\n*.sql @dba\n",
+		},
+		{
+			"rules only",
+			codeownersSpec{rules: []codeownerRule{{pattern: "docs/", owners: []string{"@org/docs"}}}},
+			"docs/ @org/docs\n",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := renderCodeowners(tt.owners)
+			got := renderCodeowners(tt.spec)
 			if got != tt.want {
-				t.Errorf("renderCodeowners(%v) = %q, want %q", tt.owners, got, tt.want)
+				t.Errorf("renderCodeowners(%+v) = %q, want %q", tt.spec, got, tt.want)
 			}
 		})
 	}
 }
 
 func TestPlanCodeowners_EmitsPerRepo(t *testing.T) {
-	owners := map[string][]string{
-		"api": {"allanice001"},
-		"web": {"@org/frontend"},
+	owners := map[string]codeownersSpec{
+		"api": {owners: []string{"allanice001"}},
+		"web": {owners: []string{"@org/frontend"}},
 	}
-	names := map[string]string{"api": "api", "web": "web"}
+	names := map[string]templates.RepoInfo{"api": {Name: "api", DefaultBranch: "main"}, "web": {Name: "web", DefaultBranch: "main"}}
 	emitted := map[string]bool{}
 
-	changes := planCodeowners("acme", owners, names, map[string]bool{}, "", emitted)
+	changes, err := planCodeowners("acme", owners, names, map[string]bool{}, "", emitted)
+	if err != nil {
+		t.Fatalf("planCodeowners: %v", err)
+	}
 	if len(changes) != 2 {
 		t.Fatalf("expected 2 changes, got %d", len(changes))
 	}
@@ -294,23 +373,29 @@ func TestPlanCodeowners_EmitsPerRepo(t *testing.T) {
 }
 
 func TestPlanCodeowners_SkipsWhenUserDeclared(t *testing.T) {
-	owners := map[string][]string{"api": {"octocat"}}
-	names := map[string]string{"api": "api"}
+	owners := map[string]codeownersSpec{"api": {owners: []string{"octocat"}}}
+	names := map[string]templates.RepoInfo{"api": {Name: "api", DefaultBranch: "main"}}
 	userFiles := map[string]bool{".github/CODEOWNERS": true}
 
-	changes := planCodeowners("acme", owners, names, userFiles, "", map[string]bool{})
+	changes, err := planCodeowners("acme", owners, names, userFiles, "", map[string]bool{})
+	if err != nil {
+		t.Fatalf("planCodeowners: %v", err)
+	}
 	if len(changes) != 0 {
 		t.Errorf("expected user-declared CODEOWNERS to win, got %d synthesized changes", len(changes))
 	}
 }
 
 func TestPlanCodeowners_SkipsRepoWithoutOwners(t *testing.T) {
-	owners := map[string][]string{
-		"api":   {"octocat"},
-		"empty": nil,
+	owners := map[string]codeownersSpec{
+		"api":   {owners: []string{"octocat"}},
+		"empty": {},
+	}
+	names := map[string]templates.RepoInfo{"api": {Name: "api", DefaultBranch: "main"}, "empty": {Name: "empty", DefaultBranch: "main"}}
+	changes, err := planCodeowners("acme", owners, names, map[string]bool{}, "", map[string]bool{})
+	if err != nil {
+		t.Fatalf("planCodeowners: %v", err)
 	}
-	names := map[string]string{"api": "api", "empty": "empty"}
-	changes := planCodeowners("acme", owners, names, map[string]bool{}, "", map[string]bool{})
 	if len(changes) != 1 {
 		t.Fatalf("expected 1 change (api only), got %d", len(changes))
 	}
@@ -320,11 +405,14 @@ func TestPlanCodeowners_SkipsRepoWithoutOwners(t *testing.T) {
 }
 
 func TestPlanCodeowners_RespectsEmittedSet(t *testing.T) {
-	owners := map[string][]string{"api": {"octocat"}}
-	names := map[string]string{"api": "api"}
+	owners := map[string]codeownersSpec{"api": {owners: []string{"octocat"}}}
+	names := map[string]templates.RepoInfo{"api": {Name: "api", DefaultBranch: "main"}}
 	emitted := map[string]bool{"api:.github/CODEOWNERS": true}
 
-	changes := planCodeowners("acme", owners, names, map[string]bool{}, "", emitted)
+	changes, err := planCodeowners("acme", owners, names, map[string]bool{}, "", emitted)
+	if err != nil {
+		t.Fatalf("planCodeowners: %v", err)
+	}
 	if len(changes) != 0 {
 		t.Errorf("expected no changes when already emitted, got %d", len(changes))
 	}
@@ -332,8 +420,8 @@ func TestPlanCodeowners_RespectsEmittedSet(t *testing.T) {
 
 func TestPlanCodeownersDeletions_OnlyForReposWithoutOwners(t *testing.T) {
 	managed := map[string]bool{"api": true, "web": true, "infra": true}
-	names := map[string]string{"api": "api", "web": "web", "infra": "infra"}
-	owners := map[string][]string{"api": {"octocat"}}
+	names := map[string]templates.RepoInfo{"api": {Name: "api", DefaultBranch: "main"}, "web": {Name: "web", DefaultBranch: "main"}, "infra": {Name: "infra", DefaultBranch: "main"}}
+	owners := map[string]codeownersSpec{"api": {owners: []string{"octocat"}}}
 
 	changes := planCodeownersDeletions("acme", managed, names, owners, map[string]bool{}, "", map[string]bool{})
 	if len(changes) != 2 {
@@ -357,8 +445,8 @@ func TestPlanCodeownersDeletions_OnlyForReposWithoutOwners(t *testing.T) {
 
 func TestPlanCodeownersDeletions_SkipsWhenUserDeclared(t *testing.T) {
 	managed := map[string]bool{"api": true}
-	names := map[string]string{"api": "api"}
-	owners := map[string][]string{} // no owners -> would normally delete
+	names := map[string]templates.RepoInfo{"api": {Name: "api", DefaultBranch: "main"}}
+	owners := map[string]codeownersSpec{} // no owners -> would normally delete
 	userFiles := map[string]bool{".github/CODEOWNERS": true}
 
 	changes := planCodeownersDeletions("acme", managed, names, owners, userFiles, "", map[string]bool{})
@@ -369,11 +457,40 @@ func TestPlanCodeownersDeletions_SkipsWhenUserDeclared(t *testing.T) {
 
 func TestPlanCodeownersDeletions_RespectsEmittedSet(t *testing.T) {
 	managed := map[string]bool{"api": true}
-	names := map[string]string{"api": "api"}
+	names := map[string]templates.RepoInfo{"api": {Name: "api", DefaultBranch: "main"}}
 	emitted := map[string]bool{"api:.github/CODEOWNERS": true}
 
-	changes := planCodeownersDeletions("acme", managed, names, map[string][]string{}, map[string]bool{}, "", emitted)
+	changes := planCodeownersDeletions("acme", managed, names, map[string]codeownersSpec{}, map[string]bool{}, "", emitted)
 	if len(changes) != 0 {
 		t.Errorf("expected no changes when already emitted (write wins), got %d", len(changes))
 	}
 }
+
+func TestPlanCodeowners_RejectsIgnoredPattern(t *testing.T) {
+	owners := map[string]codeownersSpec{
+		"api": {rules: []codeownerRule{{pattern: "!vendor/", owners: []string{"@org/platform"}}}},
+	}
+	names := map[string]templates.RepoInfo{"api": {Name: "api", DefaultBranch: "main"}}
+	if _, err := planCodeowners("acme", owners, names, map[string]bool{}, "", map[string]bool{}); err == nil {
+		t.Fatal("expected error for a negated pattern GitHub ignores")
+	}
+}
+
+func TestPlanRepoFiles_WarnsOnUserCodeowners(t *testing.T) {
+	specs := []config.FileSpec{{Path: ".github/CODEOWNERS", Content: "* @{{.Org}}/platform\n[abc].go @{{.Org}}/go\n"}}
+	changes, warnings, err := planRepoFiles("acme", templates.RepoInfo{Name: "api"}, "api", specs, "", map[string]bool{})
+	if err != nil {
+		t.Fatalf("a hand-authored CODEOWNERS should not fail the plan: %v", err)
+	}
+	if len(changes) != 1 {
+		t.Errorf("expected the file to be written as given, got %d changes", len(changes))
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "character range") {
+		t.Fatalf("expected a character range warning, got %v", warnings)
+	}
+
+	specs[0].Content = "# owners\n* @{{.Org}}/platform\n\n/docs/ @octocat docs@example.com # docs\n"
+	if _, warnings, err := planRepoFiles("acme", templates.RepoInfo{Name: "api"}, "api", specs, "", map[string]bool{}); err != nil || len(warnings) != 0 {
+		t.Fatalf("unexpected result for valid CODEOWNERS: %v %v", warnings, err)
+	}
+}
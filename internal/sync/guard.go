@@ -0,0 +1,134 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/DragonSecurity/gomgr/internal/config"
+	"github.com/DragonSecurity/gomgr/internal/util"
+)
+
+// ErrDestructiveLimit is returned by ApplyWithOptions when a plan holds more
+// delete and remove changes than its DestructiveLimit allows.
+var ErrDestructiveLimit = errors.New("destructive change limit exceeded")
+
+// guardChanges drops the destructive changes the config forbids, with a
+// warning for each reason:
+//
+//   - with no team configured, every delete and remove is dropped, so an
+//     empty or misplaced teams/ directory cannot read as "delete the org";
+//   - changes that would delete or remove a protected resource are dropped.
+func guardChanges(cfg *config.Root, changes []util.Change) ([]util.Change, []string) {
+	var (
+		kept     []util.Change
+		warnings []string
+		refused  int
+	)
+	for _, ch := range changes {
+		if !isCleanup(ch) {
+			kept = append(kept, ch)
+			continue
+		}
+		if len(cfg.Team) == 0 {
+			refused++
+			continue
+		}
+		if what := protectedTarget(cfg.App.Protected, ch); what != "" {
+			warnings = append(warnings, fmt.Sprintf("Skipping %s:%s %s: %s is protected", ch.Scope, ch.Action, ch.Target, what))
+			continue
+		}
+		kept = append(kept, ch)
+	}
+	if refused > 0 {
+		warnings = append(warnings, fmt.Sprintf("No teams are configured; refusing %d delete/remove change(s). Check the teams/ directory.", refused))
+	}
+	return kept, warnings
+}
+
+// protectedTarget returns the protected resource ch would delete or remove,
+// such as "repo infra", or "" when ch touches nothing protected.
+func protectedTarget(p config.ProtectedConfig, ch util.Change) string {
+	switch ch.Scope + ":" + ch.Action {
+	case "team:delete":
+		if containsFold(p.Teams, ch.Target) {
+			return "team " + ch.Target
+		}
+	case "repo:delete", "repo:archive":
+		if containsFold(p.Repos, ch.Target) {
+			return "repo " + ch.Target
+		}
+	case "org-member:remove":
+		if containsFold(p.Users, ch.Target) {
+			return "user " + ch.Target
+		}
+	case "team-member:remove":
+		var user string
+		switch d := ch.Details.(type) {
+		case teamMemberChange:
+			user = d.User
+		case map[string]any:
+			user = detailString(d, "user")
+		}
+		if containsFold(p.Users, user) {
+			return "user " + user
+		}
+	}
+	return ""
+}
+
+// CountDestructive returns how many of changes delete or remove something.
+func CountDestructive(changes []util.Change) int {
+	n := 0
+	for _, ch := range changes {
+		if isCleanup(ch) {
+			n++
+		}
+	}
+	return n
+}
+
+// DestructiveLimit caps the delete and remove changes one apply may make.
+// Max is the most it allows; negative means no cap. Percent, when positive,
+// also caps them as a percentage of the resources that exist according to
+// the plan's stats.
+type DestructiveLimit struct {
+	Max     int
+	Percent int
+}
+
+// DestructiveLimitFor returns the guardrail configured in app. allow, unless
+// negative, replaces it with a plain cap of allow changes: the
+// --allow-destructive override for a plan someone has reviewed.
+func DestructiveLimitFor(app config.AppConfig, allow int) *DestructiveLimit {
+	if allow >= 0 {
+		return &DestructiveLimit{Max: allow}
+	}
+	l := &DestructiveLimit{Max: app.Guardrails.MaxDestructiveChanges, Percent: app.Guardrails.MaxDestructivePercent}
+	if l.Max == 0 {
+		l.Max = config.DefaultMaxDestructive
+	}
+	return l
+}
+
+// Check returns an error wrapping ErrDestructiveLimit when plan exceeds l.
+// A nil limit allows everything.
+func (l *DestructiveLimit) Check(plan util.Plan) error {
+	if l == nil {
+		return nil
+	}
+	n := CountDestructive(plan.Changes)
+	if n == 0 {
+		return nil
+	}
+	if l.Max >= 0 && n > l.Max {
+		return fmt.Errorf("%w: plan has %d delete/remove changes, the limit is %d; review the plan and re-run with --allow-destructive %d", ErrDestructiveLimit, n, l.Max, n)
+	}
+	if l.Percent > 0 && plan.Stats != nil {
+		s := plan.Stats
+		existing := s.Teams.Current + s.TeamMembers.Current + s.Repositories.Current + s.CustomRoles.Current
+		if existing > 0 && n*100 > l.Percent*existing {
+			return fmt.Errorf("%w: plan has %d delete/remove changes against %d existing resources, the limit is %d%%; review the plan and re-run with --allow-destructive %d", ErrDestructiveLimit, n, existing, l.Percent, n)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/DragonSecurity/gomgr/internal/config"
+	"github.com/DragonSecurity/gomgr/internal/util"
+)
+
+func TestGuardChanges(t *testing.T) {
+	changes := []util.Change{
+		{Scope: "team", Action: "create", Target: "web"},
+		{Scope: "team", Action: "delete", Target: "Admins"},
+		{Scope: "team", Action: "delete", Target: "legacy"},
+		{Scope: "repo", Action: "delete", Target: "infra"},
+		{Scope: "org-member", Action: "remove", Target: "breakglass"},
+		{Scope: "team-member", Action: "remove", Target: "web", Details: teamMemberChange{User: "breakglass"}},
+		{Scope: "team-member", Action: "remove", Target: "web", Details: map[string]any{"user": "alice"}},
+	}
+	cfg := &config.Root{
+		App: config.AppConfig{Protected: config.ProtectedConfig{
+			Repos: []string{"INFRA"},
+			Teams: []string{"admins"},
+			Users: []string{"breakglass"},
+		}},
+		Team: []config.TeamConfig{{Name: "web"}},
+	}
+
+	kept, warnings := guardChanges(cfg, changes)
+	var got []string
+	for _, ch := range kept {
+		got = append(got, ch.Scope+":"+ch.Action+" "+ch.Target)
+	}
+	want := []string{"team:create web", "team:delete legacy", "team-member:remove web"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("kept %v, want %v", got, want)
+	}
+	if len(warnings) != 4 || !strings.Contains(warnings[0], "team Admins is protected") {
+		t.Errorf("expected one warning per protected change, got %v", warnings)
+	}
+
+	archive := util.Change{Scope: "repo", Action: "archive", Target: "infra"}
+	if kept, _ := guardChanges(cfg, []util.Change{archive}); len(kept) != 0 {
+		t.Errorf("expected a protected repo not to be archived, kept %v", kept)
+	}
+
+	cfg.Team = nil
+	kept, warnings = guardChanges(cfg, changes)
+	if len(kept) != 1 || kept[0].Action != "create" {
+		t.Errorf("expected a plan without teams to keep no deletions, got %v", kept)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "refusing 6 delete/remove") {
+		t.Errorf("expected a single no-teams warning, got %v", warnings)
+	}
+}
+
+func TestDestructiveLimit(t *testing.T) {
+	plan := func(deletes int) util.Plan {
+		p := util.Plan{Stats: &util.StateStats{Repositories: util.StatePair{Current: 40}}}
+		p.Changes = append(p.Changes, util.Change{Scope: "team", Action: "create", Target: "web"})
+		for range deletes {
+			p.Changes = append(p.Changes, util.Change{Scope: "repo", Action: "delete", Target: "old"})
+		}
+		return p
+	}
+	tests := []struct {
+		name    string
+		app     config.AppConfig
+		allow   int
+		deletes int
+		wantErr bool
+	}{
+		{"default allows ten", config.AppConfig{}, -1, 10, false},
+		{"default refuses eleven", config.AppConfig{}, -1, 11, true},
+		{"configured cap", config.AppConfig{Guardrails: config.GuardrailsConfig{MaxDestructiveChanges: 2}}, -1, 3, true},
+		{"cap disabled", config.AppConfig{Guardrails: config.GuardrailsConfig{MaxDestructiveChanges: -1}}, -1, 30, false},
+		{"percentage", config.AppConfig{Guardrails: config.GuardrailsConfig{MaxDestructivePercent: 10}}, -1, 5, true},
+		{"override", config.AppConfig{}, 30, 30, false},
+		{"override zero", config.AppConfig{}, 0, 1, true},
+	}
+	for _, tt := range tests {
+		err := DestructiveLimitFor(tt.app, tt.allow).Check(plan(tt.deletes))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		if err != nil && !errors.Is(err, ErrDestructiveLimit) {
+			t.Errorf("%s: expected ErrDestructiveLimit, got %v", tt.name, err)
+		}
+	}
+}
+
+func TestApplyWithOptions_RefusesOverLimit(t *testing.T) {
+	plan := util.Plan{Changes: []util.Change{
+		{Scope: "repo", Action: "delete", Target: "a", Details: map[string]any{"org": "o", "repo": "a"}},
+		{Scope: "repo", Action: "delete", Target: "b", Details: map[string]any{"org": "o", "repo": "b"}},
+	}}
+	// A nil client would panic if a handler ran.
+	err := ApplyWithOptions(context.Background(), nil, plan, ApplyOptions{Limit: &DestructiveLimit{Max: 1}})
+	if !errors.Is(err, ErrDestructiveLimit) || !strings.Contains(err.Error(), "--allow-destructive 2") {
+		t.Fatalf("expected the limit to stop the apply, got %v", err)
+	}
+}
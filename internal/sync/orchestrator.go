@@ -5,9 +5,13 @@ import (
 	"fmt"
 
 	"github.com/google/go-github/v88/github"
+	"go.opentelemetry.io/otel/attribute"
 
+	"github.com/DragonSecurity/gomgr/internal/audit"
 	"github.com/DragonSecurity/gomgr/internal/config"
 	"github.com/DragonSecurity/gomgr/internal/gh"
+	"github.com/DragonSecurity/gomgr/internal/journal"
+	"github.com/DragonSecurity/gomgr/internal/tracing"
 	"github.com/DragonSecurity/gomgr/internal/util"
 )
 
@@ -18,6 +22,9 @@ type State struct {
 	// Cached API results to avoid duplicate calls
 	ActualTeams []*github.Team
 	ActualRepos []*github.Repository
+	// teamsPartial is set when a scoped plan fetched only some teams (or
+	// none), so ActualTeams does not list every team in the org.
+	teamsPartial bool
 
 	// Current state from GitHub
 	CurrentTeams       int
@@ -32,46 +39,136 @@ type State struct {
 	DesiredRepos       int
 	DesiredRepoPerms   int
 	DesiredCustomRoles int
+
+	// Ignored counts unmanaged resources skipped by app.ignore.
+	Ignored int
+
+	// scope narrows planning; see BuildScopedPlan.
+	scope Scope
 }
 
 func BuildPlan(ctx context.Context, c *gh.Client, cfg *config.Root) (util.Plan, error) {
-	st := &State{Org: cfg.App.Org}
-	var plan util.Plan
+	return BuildScopedPlan(ctx, c, cfg, Scope{})
+}
 
+// BuildScopedPlan plans only the part of the org selected by scope. State
+// counts in plan.Stats then cover the scoped teams and repos only.
+func BuildScopedPlan(ctx context.Context, c *gh.Client, cfg *config.Root, scope Scope) (plan util.Plan, err error) {
+	ctx, span := tracing.Start(ctx, "BuildPlan",
+		attribute.String("github.org", cfg.App.Org),
+		attribute.String("gomgr.scope", scope.String()),
+	)
+	defer func() {
+		span.SetAttributes(attribute.Int("gomgr.changes", len(plan.Changes)))
+		tracing.End(span, err)
+	}()
+	st := &State{Org: cfg.App.Org, scope: scope}
+
+	// Each phase gets its own span so a slow plan shows where the time went.
 	// Prefetch teams and repos once to avoid duplicate API calls
-	if err := prefetchState(ctx, c, st); err != nil {
+	phaseCtx, phase := tracing.Start(ctx, "plan prefetchState")
+	err = prefetchState(phaseCtx, c, st)
+	tracing.End(phase, err)
+	if err != nil {
 		return plan, fmt.Errorf("prefetch state: %w", err)
 	}
 
 	// Custom roles must be created before teams/repos use them
-	customRoleChanges, err := planCustomRoles(ctx, c, cfg, st)
-	if err != nil {
-		return plan, fmt.Errorf("plan custom roles: %w", err)
+	var customRoleChanges []util.Change
+	if scope.phase(PhaseCustomRoles) {
+		phaseCtx, phase = tracing.Start(ctx, "plan planCustomRoles")
+		customRoleChanges, err = planCustomRoles(phaseCtx, c, cfg, st)
+		tracing.End(phase, err)
+		if err != nil {
+			return plan, fmt.Errorf("plan custom roles: %w", err)
+		}
 	}
 
-	teamChanges, desiredBySlug, err := planTeams(ctx, c, cfg, st)
+	// planTeams makes no API calls; its desired set is needed by membership
+	// and cleanups even when team changes are out of scope.
+	phaseCtx, phase = tracing.Start(ctx, "plan planTeams")
+	teamChanges, desiredBySlug, err := planTeams(phaseCtx, c, cfg, st)
+	tracing.End(phase, err)
 	if err != nil {
 		return plan, fmt.Errorf("plan teams: %w", err)
 	}
 
-	memChanges, err := planTeamMembership(ctx, c, st, desiredBySlug)
-	if err != nil {
-		return plan, fmt.Errorf("plan team membership: %w", err)
+	var memChanges []util.Change
+	if scope.phase(PhaseMembers) {
+		memberTeams := desiredBySlug
+		if scope.named() {
+			memberTeams = map[string]config.TeamConfig{}
+			for slug, t := range desiredBySlug {
+				if scope.hasTeam(slug) {
+					memberTeams[slug] = t
+				}
+			}
+		}
+		phaseCtx, phase = tracing.Start(ctx, "plan planTeamMembership")
+		memChanges, err = planTeamMembership(phaseCtx, c, st, memberTeams, cfg.App.RemoveExtraTeamMembers, cfg.App.Ignore.Users)
+		tracing.End(phase, err)
+		if err != nil {
+			return plan, fmt.Errorf("plan team membership: %w", err)
+		}
 	}
 
-	repoChanges, err := planRepoPerms(ctx, c, cfg, st)
-	if err != nil {
-		return plan, fmt.Errorf("plan repo permissions: %w", err)
+	var (
+		repoChanges       []util.Change
+		fileWarnings      []string
+		codeownerWarnings []string
+	)
+	if scope.phase(PhaseRepos) {
+		phaseCtx, phase = tracing.Start(ctx, "plan planRepoPerms")
+		repoChanges, fileWarnings, err = planRepoPerms(phaseCtx, c, cfg, st)
+		tracing.End(phase, err)
+		if err != nil {
+			return plan, fmt.Errorf("plan repo permissions: %w", err)
+		}
+
+		phaseCtx, phase = tracing.Start(ctx, "plan checkCodeowners")
+		codeownerWarnings, err = checkCodeowners(phaseCtx, c, cfg, st)
+		tracing.End(phase, err)
+		if err != nil {
+			return plan, fmt.Errorf("check codeowners: %w", err)
+		}
 	}
 
-	cleanupChanges, warnings, err := planCleanups(ctx, c, cfg, st, desiredBySlug)
-	if err != nil {
-		return plan, fmt.Errorf("plan cleanups: %w", err)
+	var (
+		cleanupChanges, customRoleCleanups []util.Change
+		warnings, roleWarnings             []string
+	)
+	if scope.cleanups() {
+		// Phases out of scope keep their cleanup switches off, which also
+		// skips the listings those cleanups would need.
+		scoped := *cfg
+		scoped.App.DeleteUnconfiguredTeams = cfg.App.DeleteUnconfiguredTeams && scope.phase(PhaseTeams)
+		scoped.App.DryWarnings.WarnUnmanagedTeams = cfg.App.DryWarnings.WarnUnmanagedTeams && scope.phase(PhaseTeams)
+		// Finding members without a team needs every team's member list;
+		// that is an org-wide question a plan for named teams or repos does
+		// not ask.
+		orgMembers := scope.phase(PhaseMembers) && !scope.named()
+		scoped.App.RemoveMembersWithoutTeam = cfg.App.RemoveMembersWithoutTeam && orgMembers
+		scoped.App.DryWarnings.WarnMembersWithoutAnyTeam = cfg.App.DryWarnings.WarnMembersWithoutAnyTeam && orgMembers
+		if !scope.phase(PhaseRepos) {
+			scoped.App.UnmanagedRepoAction = ""
+			scoped.App.DeleteUnmanagedRepos = false
+			scoped.App.DryWarnings.WarnUnmanagedRepos = false
+		}
+		phaseCtx, phase = tracing.Start(ctx, "plan planCleanups")
+		cleanupChanges, warnings, err = planCleanups(phaseCtx, c, &scoped, st, desiredBySlug)
+		tracing.End(phase, err)
+		if err != nil {
+			return plan, fmt.Errorf("plan cleanups: %w", err)
+		}
 	}
 
-	customRoleCleanups, roleWarnings, err := planCustomRoleCleanups(ctx, c, cfg, st)
-	if err != nil {
-		return plan, fmt.Errorf("plan custom role cleanups: %w", err)
+	if scope.cleanups() && scope.phase(PhaseCustomRoles) {
+		phaseCtx, phase = tracing.Start(ctx, "plan planCustomRoleCleanups")
+		customRoleCleanups, roleWarnings, err = planCustomRoleCleanups(phaseCtx, c, cfg, st)
+		tracing.End(phase, err)
+		if err != nil {
+			return plan, fmt.Errorf("plan custom role cleanups: %w", err)
+		}
 	}
 
 	plan.Changes = append(plan.Changes, customRoleChanges...)
@@ -80,7 +177,12 @@ func BuildPlan(ctx context.Context, c *gh.Client, cfg *config.Root) (util.Plan,
 	plan.Changes = append(plan.Changes, repoChanges...)
 	plan.Changes = append(plan.Changes, cleanupChanges...)
 	plan.Changes = append(plan.Changes, customRoleCleanups...)
+	var guardWarnings []string
+	plan.Changes, guardWarnings = guardChanges(cfg, scope.filter(plan.Changes))
 	plan.Warnings = append(warnings, roleWarnings...)
+	plan.Warnings = append(plan.Warnings, fileWarnings...)
+	plan.Warnings = append(plan.Warnings, codeownerWarnings...)
+	plan.Warnings = append(plan.Warnings, guardWarnings...)
 
 	// Populate stats
 	plan.Stats = &util.StateStats{
@@ -104,39 +206,74 @@ func BuildPlan(ctx context.Context, c *gh.Client, cfg *config.Root) (util.Plan,
 			Current: st.CurrentCustomRoles,
 			Desired: st.DesiredCustomRoles,
 		},
+		Ignored: st.Ignored,
 	}
 
 	return plan, nil
 }
 
 // prefetchState fetches teams and repos from GitHub once, caching them in State
-// so that both planning and cleanup phases can reuse the data.
+// so that both planning and cleanup phases can reuse the data. A scope naming
+// teams or repos fetches just those instead of listing the org, and phases
+// out of scope fetch nothing.
 func prefetchState(ctx context.Context, c *gh.Client, st *State) error {
-	if err := paginate(func(opts *github.ListOptions) (*github.Response, error) {
-		ts, resp, err := c.REST.Teams.ListTeams(ctx, st.Org, opts)
-		if err != nil {
-			return nil, err
+	scope := st.scope
+	st.teamsPartial = !scope.phase(PhaseTeams) || scope.named()
+	switch {
+	case !scope.phase(PhaseTeams):
+	case scope.named():
+		for _, slug := range scope.Teams {
+			t, _, err := c.REST.Teams.GetTeamBySlug(ctx, st.Org, slug)
+			if isNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("get team %s: %w", slug, err)
+			}
+			st.ActualTeams = append(st.ActualTeams, t)
+		}
+	default:
+		if err := paginate(func(opts *github.ListOptions) (*github.Response, error) {
+			ts, resp, err := c.REST.Teams.ListTeams(ctx, st.Org, opts)
+			if err != nil {
+				return nil, err
+			}
+			st.ActualTeams = append(st.ActualTeams, ts...)
+			return resp, nil
+		}); err != nil {
+			return fmt.Errorf("list teams: %w", err)
 		}
-		st.ActualTeams = append(st.ActualTeams, ts...)
-		return resp, nil
-	}); err != nil {
-		return fmt.Errorf("list teams: %w", err)
 	}
 
-	repoOpt := &github.RepositoryListByOrgOptions{
-		ListOptions: github.ListOptions{PerPage: defaultPerPage},
-		Type:        "all",
-	}
-	if err := paginate(func(opts *github.ListOptions) (*github.Response, error) {
-		repoOpt.ListOptions = *opts
-		repos, resp, err := c.REST.Repositories.ListByOrg(ctx, st.Org, repoOpt)
-		if err != nil {
-			return nil, err
+	switch {
+	case !scope.phase(PhaseRepos):
+	case scope.named():
+		for _, name := range scope.Repos {
+			r, _, err := c.REST.Repositories.Get(ctx, st.Org, name)
+			if isNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("get repo %s: %w", name, err)
+			}
+			st.ActualRepos = append(st.ActualRepos, r)
+		}
+	default:
+		repoOpt := &github.RepositoryListByOrgOptions{
+			ListOptions: github.ListOptions{PerPage: defaultPerPage},
+			Type:        "all",
+		}
+		if err := paginate(func(opts *github.ListOptions) (*github.Response, error) {
+			repoOpt.ListOptions = *opts
+			repos, resp, err := c.REST.Repositories.ListByOrg(ctx, st.Org, repoOpt)
+			if err != nil {
+				return nil, err
+			}
+			st.ActualRepos = append(st.ActualRepos, repos...)
+			return resp, nil
+		}); err != nil {
+			return fmt.Errorf("list repos: %w", err)
 		}
-		st.ActualRepos = append(st.ActualRepos, repos...)
-		return resp, nil
-	}); err != nil {
-		return fmt.Errorf("list repos: %w", err)
 	}
 
 	return nil
@@ -148,6 +285,45 @@ type ApplyOptions struct {
 	// then returns an aggregated error at the end. When false (the default),
 	// the first handler error aborts the run.
 	ContinueOnError bool
+
+	// Concurrency caps how many changes are applied at once. Changes only
+	// run in parallel when neither depends on the other. Zero means
+	// DefaultConcurrency; 1 applies changes one at a time.
+	Concurrency int
+
+	// Audit receives a record for every applied change, bracketed by run
+	// start/end records. Nil disables auditing.
+	Audit *audit.Logger
+
+	// OnChange, when set, is called after every change a handler ran for,
+	// with the handler's error (nil on success).
+	OnChange func(ch util.Change, err error)
+
+	// Approve, when set, is asked about the cleanup phase — every delete and
+	// remove — once the changes before it have finished, and returns one
+	// verdict per change. Declined changes are skipped and reported to
+	// OnChange with ErrDeclined; an error stops the apply before any cleanup
+	// runs.
+	Approve func(ctx context.Context, cleanups []util.Change) ([]bool, error)
+
+	// Limit refuses to apply a plan with more delete and remove changes
+	// than it allows, before anything is changed. Nil applies no limit.
+	Limit *DestructiveLimit
+
+	// Journal checkpoints every change as it starts and finishes. When it
+	// was opened to resume, changes it records as completed are skipped and
+	// in-flight ones are re-checked first. Nil disables journaling.
+	Journal *journal.Journal
+}
+
+// record reports the outcome of one applied change to the journal, the audit
+// trail and the OnChange hook.
+func (o ApplyOptions) record(ctx context.Context, ch util.Change, err error) {
+	o.Journal.Done(ch, err)
+	o.Audit.Change(ctx, ch, err)
+	if o.OnChange != nil {
+		o.OnChange(ch, err)
+	}
 }
 
 func Apply(ctx context.Context, c *gh.Client, plan util.Plan) error {
@@ -156,5 +332,18 @@ func Apply(ctx context.Context, c *gh.Client, plan util.Plan) error {
 
 // ApplyWithOptions applies the plan's changes using the given options.
 func ApplyWithOptions(ctx context.Context, c *gh.Client, plan util.Plan, opts ApplyOptions) error {
-	return applyChangesWith(ctx, c, plan.Changes, defaultRegistry, opts)
+	ctx, span := tracing.Start(ctx, "Apply", attribute.Int("gomgr.changes", len(plan.Changes)))
+	if err := opts.Limit.Check(plan); err != nil {
+		tracing.End(span, err)
+		return err
+	}
+	opts.Audit.Start(ctx, len(plan.Changes))
+	changes := plan.Changes
+	if opts.Journal.Resumed() {
+		changes = resumeChanges(ctx, c, changes, defaultRegistry, opts)
+	}
+	err := applyChangesWith(ctx, c, changes, defaultRegistry, opts)
+	opts.Audit.Finish(ctx, err)
+	tracing.End(span, err)
+	return err
 }
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/DragonSecurity/gomgr/internal/config"
@@ -102,3 +103,54 @@ func TestApply_ContextCanceled(t *testing.T) {
 		t.Fatal("expected error for canceled context")
 	}
 }
+
+func TestBuildScopedPlan_SkipsOrgWideFetches(t *testing.T) {
+	var listed []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/orgs/myorg/teams", "/orgs/myorg/repos", "/orgs/myorg/members":
+			listed = append(listed, r.URL.Path)
+			_ = json.NewEncoder(w).Encode([]map[string]any{{"slug": "legacy", "name": "legacy"}})
+		case "/orgs/myorg/teams/backend", "/repos/myorg/api":
+			http.NotFound(w, r)
+		case "/users/alice":
+			_ = json.NewEncoder(w).Encode(map[string]any{"login": "alice"})
+		default:
+			_ = json.NewEncoder(w).Encode([]map[string]any{})
+		}
+	}))
+	defer server.Close()
+
+	cfg := &config.Root{
+		App: config.AppConfig{
+			Org:                      "myorg",
+			CreateRepo:               true,
+			DeleteUnconfiguredTeams:  true,
+			DeleteUnmanagedRepos:     true,
+			RemoveMembersWithoutTeam: true,
+		},
+		Team: []config.TeamConfig{
+			{Name: "Backend", Slug: "backend", Members: []string{"alice"}, Repositories: map[string]any{"api": "push"}},
+			{Name: "Web", Slug: "web", Repositories: map[string]any{"site": "push"}},
+		},
+	}
+	plan, err := BuildScopedPlan(context.Background(), newTestClient(t, server), cfg, Scope{Teams: []string{"backend"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(listed) > 0 {
+		t.Errorf("scoped plan listed the whole org: %v", listed)
+	}
+	var got []string
+	for _, ch := range plan.Changes {
+		if isCleanup(ch) {
+			t.Errorf("scoped plan without cleanups planned %s:%s %s", ch.Scope, ch.Action, ch.Target)
+		}
+		got = append(got, ch.Scope+":"+ch.Action+" "+ch.Target)
+	}
+	for _, want := range []string{"team:create backend", "team-member:ensure backend", "team-repo:grant backend/api"} {
+		if !containsSubstr(strings.Join(got, "\n"), want) {
+			t.Errorf("missing %s in %v", want, got)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/DragonSecurity/gomgr/internal/gh"
+	"github.com/DragonSecurity/gomgr/internal/util"
+)
+
+// resumeChanges drops the changes opts.Journal records as completed. A
+// change the interrupted run started but never finished is checked with
+// its handler's Verifier when it has one: if it already took effect it is
+// recorded as applied and dropped, otherwise it runs again. Handlers
+// without a Verifier are idempotent, so their in-flight changes simply run
+// again.
+func resumeChanges(ctx context.Context, c *gh.Client, changes []util.Change, reg *HandlerRegistry, opts ApplyOptions) []util.Change {
+	var out []util.Change
+	skipped := 0
+	for _, ch := range changes {
+		if opts.Journal.Completed(ch) {
+			skipped++
+			continue
+		}
+		if opts.Journal.InFlight(ch) {
+			h, _ := reg.Lookup(ch.Scope, ch.Action)
+			if v, ok := h.(Verifier); ok {
+				applied, err := v.Verify(ctx, c, ch)
+				switch {
+				case err != nil:
+					util.Warnf("resume: could not check %s:%s %s, applying it again: %v", ch.Scope, ch.Action, ch.Target, err)
+				case applied:
+					util.Infof("resume: %s:%s %s took effect before the interruption", ch.Scope, ch.Action, ch.Target)
+					opts.record(ctx, ch, nil)
+					skipped++
+					continue
+				default:
+					util.Infof("resume: %s:%s %s did not take effect, applying it again", ch.Scope, ch.Action, ch.Target)
+				}
+			}
+		}
+		out = append(out, ch)
+	}
+	util.Infof("resume: %d change(s) already applied, %d to go", skipped, len(out))
+	return out
+}
+
+// RestorePlan gives the changes of a plan read back from JSON (such as a
+// journal) the typed Details the apply handlers expect. Map-shaped details
+// need no restoring: handlers already accept their JSON forms.
+func RestorePlan(plan util.Plan) (util.Plan, error) {
+	for i, ch := range plan.Changes {
+		var err error
+		switch ch.Scope {
+		case "team-member":
+			plan.Changes[i].Details, err = restoreDetails[teamMemberChange](ch.Details)
+		case "custom-role":
+			plan.Changes[i].Details, err = restoreDetails[customRoleChange](ch.Details)
+		}
+		if err != nil {
+			return plan, fmt.Errorf("restore %s:%s %s: %w", ch.Scope, ch.Action, ch.Target, err)
+		}
+	}
+	return plan, nil
+}
+
+func restoreDetails[T any](details any) (T, error) {
+	var out T
+	b, err := json.Marshal(details)
+	if err != nil {
+		return out, err
+	}
+	err = json.Unmarshal(b, &out)
+	return out, err
+}
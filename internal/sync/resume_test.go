@@ -0,0 +1,213 @@
+package sync
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	gosync "sync"
+	"testing"
+
+	"github.com/DragonSecurity/gomgr/internal/config"
+	"github.com/DragonSecurity/gomgr/internal/journal"
+	"github.com/DragonSecurity/gomgr/internal/templates"
+	"github.com/DragonSecurity/gomgr/internal/util"
+)
+
+func TestApplyWithOptions_Resume(t *testing.T) {
+	var mu gosync.Mutex
+	var calls []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+		switch r.Method + " " + r.URL.Path {
+		case "GET /orgs/acme/teams/backend":
+			_, _ = w.Write([]byte(`{"slug":"backend"}`))
+		case "POST /orgs/acme/teams":
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"slug":"frontend"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	plan := util.Plan{Changes: []util.Change{
+		{Scope: "team", Action: "create", Target: "backend", Details: map[string]any{"org": "acme", "name": "Backend"}},
+		{Scope: "team", Action: "create", Target: "frontend", Details: map[string]any{"org": "acme", "name": "Frontend"}},
+		{Scope: "repo", Action: "delete", Target: "old", Details: map[string]any{"org": "acme", "repo": "old"}},
+	}}
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	j, err := journal.Create(path, journal.Header{Org: "acme"}, plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Start(plan.Changes[0])
+	j.Start(plan.Changes[1])
+	j.Start(plan.Changes[2])
+	j.Done(plan.Changes[2], nil)
+	if err := j.Close(errors.New("killed")); err != nil {
+		t.Fatal(err)
+	}
+
+	r, resumed, err := journal.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed, err = RestorePlan(resumed); err != nil {
+		t.Fatal(err)
+	}
+	var recorded []string
+	err = ApplyWithOptions(context.Background(), newTestClient(t, server), resumed, ApplyOptions{
+		Journal:  r,
+		OnChange: func(ch util.Change, err error) { recorded = append(recorded, ch.Target) },
+	})
+	if err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+	if err := r.Close(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"GET /orgs/acme/teams/backend", "GET /orgs/acme/teams/frontend", "POST /orgs/acme/teams"}
+	if !slices.Equal(calls, want) {
+		t.Errorf("API calls %v, want %v", calls, want)
+	}
+	slices.Sort(recorded)
+	if !slices.Equal(recorded, []string{"backend", "frontend"}) {
+		t.Errorf("recorded %v, want the verified and the re-applied change", recorded)
+	}
+	if _, _, err := journal.Open(path); err == nil {
+		t.Error("expected the journal to be complete after the resume")
+	}
+}
+
+func TestApplyWithOptions_ResumeVerifiesFilesAndArchives(t *testing.T) {
+	var mu gosync.Mutex
+	var calls []string
+	readme := base64.StdEncoding.EncodeToString([]byte("hello\n"))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+		switch r.Method + " " + r.URL.Path {
+		case "GET /repos/acme/api/contents/README.md":
+			_, _ = w.Write([]byte(`{"type":"file","encoding":"base64","content":"` + readme + `","sha":"abc"}`))
+		case "GET /repos/acme/old":
+			_, _ = w.Write([]byte(`{"name":"old","archived":true}`))
+		case "GET /repos/acme/legacy":
+			_, _ = w.Write([]byte(`{"name":"legacy","archived":false}`))
+		case "PATCH /repos/acme/legacy":
+			_, _ = w.Write([]byte(`{"name":"legacy","archived":true}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	plan := util.Plan{Changes: []util.Change{
+		{Scope: "repo-file", Action: "ensure", Target: "api:README.md", Details: map[string]any{
+			"org": "acme", "repo": "api", "path": "README.md", "content": "hello\n", "branch": "main", "reconcile": true,
+		}},
+		{Scope: "repo", Action: "archive", Target: "old", Details: map[string]any{"org": "acme", "repo": "old"}},
+		{Scope: "repo", Action: "archive", Target: "legacy", Details: map[string]any{"org": "acme", "repo": "legacy"}},
+	}}
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	j, err := journal.Create(path, journal.Header{Org: "acme"}, plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ch := range plan.Changes {
+		j.Start(ch)
+	}
+	if err := j.Close(errors.New("killed")); err != nil {
+		t.Fatal(err)
+	}
+
+	r, resumed, err := journal.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed, err = RestorePlan(resumed); err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyWithOptions(context.Background(), newTestClient(t, server), resumed, ApplyOptions{Journal: r}); err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+	_ = r.Close(nil)
+
+	slices.Sort(calls)
+	want := []string{
+		"GET /repos/acme/api/contents/README.md",
+		"GET /repos/acme/legacy",
+		"GET /repos/acme/old",
+		"PATCH /repos/acme/legacy",
+	}
+	if !slices.Equal(calls, want) {
+		t.Errorf("API calls %v, want %v", calls, want)
+	}
+}
+
+func TestJournal_RawBinaryContentRoundTrip(t *testing.T) {
+	logo := "\x89PNG\r\n\x1a\n\x00\xff\xfe"
+	specs := []config.FileSpec{{Path: "logo.png", Content: logo, Raw: true}}
+	changes, _, err := planRepoFiles("acme", templates.RepoInfo{Name: "api", DefaultBranch: "main"}, "api", specs, "", map[string]bool{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := util.Plan{Changes: changes}
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	j, err := journal.Create(path, journal.Header{Org: "acme"}, plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Start(changes[0])
+	if err := j.Close(errors.New("killed")); err != nil {
+		t.Fatal(err)
+	}
+
+	r, resumed, err := journal.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = r.Close(nil) }()
+	if resumed, err = RestorePlan(resumed); err != nil {
+		t.Fatal(err)
+	}
+	ch := resumed.Changes[0]
+	if journal.ChangeID(ch) != journal.ChangeID(changes[0]) || !r.InFlight(ch) {
+		t.Error("expected the journaled change to keep its ID")
+	}
+	got, err := fileContent(ch.Details.(map[string]any))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != logo {
+		t.Errorf("content = %q, want %q byte for byte", got, logo)
+	}
+}
+
+func TestRestorePlan(t *testing.T) {
+	plan := util.Plan{Changes: []util.Change{
+		{Scope: "team-member", Action: "ensure", Target: "backend", Details: map[string]any{"Org": "acme", "Slug": "backend", "User": "bob", "Role": "member"}},
+		{Scope: "custom-role", Action: "update", Target: "deployer", Details: map[string]any{"ID": float64(42), "Name": "deployer", "Permissions": []any{"read"}}},
+		{Scope: "repo", Action: "ensure", Target: "api", Details: map[string]any{"org": "acme"}},
+	}}
+	got, err := RestorePlan(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, ok := got.Changes[0].Details.(teamMemberChange); !ok || m.User != "bob" || m.Role != "member" {
+		t.Errorf("team-member details = %#v", got.Changes[0].Details)
+	}
+	if r, ok := got.Changes[1].Details.(customRoleChange); !ok || r.ID != 42 || !slices.Equal(r.Permissions, []string{"read"}) {
+		t.Errorf("custom-role details = %#v", got.Changes[1].Details)
+	}
+	if _, ok := got.Changes[2].Details.(map[string]any); !ok {
+		t.Errorf("map details should be left alone, got %T", got.Changes[2].Details)
+	}
+}
@@ -0,0 +1,211 @@
+package sync
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/DragonSecurity/gomgr/internal/config"
+	"github.com/DragonSecurity/gomgr/internal/util"
+)
+
+// Planning phases a Scope can be limited to.
+const (
+	PhaseTeams       = "teams"        // team create and update
+	PhaseMembers     = "members"      // team membership, org members without a team
+	PhaseRepos       = "repos"        // repositories, their grants, files, topics and flags
+	PhaseCustomRoles = "custom-roles" // custom repository roles
+)
+
+// Phases lists every phase in planning order.
+var Phases = []string{PhaseCustomRoles, PhaseTeams, PhaseMembers, PhaseRepos}
+
+// Scope narrows a plan to part of the org. The zero Scope plans everything.
+//
+// A scoped plan only contains changes to the listed teams (the team itself,
+// its members and its repository grants) and repositories (the repo, its
+// files, topics, template flag and grants), plus custom roles when
+// CustomRoles is set. Phases further limits it to the listed phases. Org-wide
+// work — listing every team and repository, or every team's members for
+// remove_members_without_team — is skipped, and cleanups are only planned
+// when Cleanups is set, restricted to the same teams, repos and phases.
+type Scope struct {
+	Teams       []string // team slugs
+	Repos       []string // repository names
+	CustomRoles bool
+	Cleanups    bool
+	Phases      []string // Phase* names; empty selects every phase
+}
+
+// ParseScope builds a Scope from the sync command's --team, --repo and
+// --scope values. scopes holds phase names plus "cleanups", which is the only
+// way a scope plans deletions.
+func ParseScope(teams, repos, scopes []string) (Scope, error) {
+	s := Scope{Teams: teams, Repos: repos}
+	for _, name := range scopes {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch {
+		case name == "cleanups":
+			s.Cleanups = true
+		case containsFold(Phases, name):
+			s.Phases = append(s.Phases, name)
+		default:
+			return Scope{}, fmt.Errorf("unknown scope %q (want %s or cleanups)", name, strings.Join(Phases, ", "))
+		}
+	}
+	return s, nil
+}
+
+// IsZero reports whether s selects the whole org.
+func (s Scope) IsZero() bool {
+	return !s.named() && !s.CustomRoles && len(s.Phases) == 0
+}
+
+// named reports whether s is limited to named teams or repositories, which
+// is what makes org-wide listings unnecessary.
+func (s Scope) named() bool {
+	return len(s.Teams) > 0 || len(s.Repos) > 0
+}
+
+// phase reports whether s plans the given phase.
+func (s Scope) phase(p string) bool {
+	switch {
+	case s.IsZero():
+		return true
+	case len(s.Phases) > 0:
+		return containsFold(s.Phases, p) || (p == PhaseCustomRoles && s.CustomRoles)
+	case p == PhaseCustomRoles:
+		return s.CustomRoles
+	default:
+		return s.named()
+	}
+}
+
+// cleanups reports whether s plans cleanups at all.
+func (s Scope) cleanups() bool {
+	return s.IsZero() || s.Cleanups
+}
+
+// String describes s for logs.
+func (s Scope) String() string {
+	if s.IsZero() {
+		return "org"
+	}
+	var parts []string
+	if len(s.Teams) > 0 {
+		parts = append(parts, "teams="+strings.Join(s.Teams, ","))
+	}
+	if len(s.Repos) > 0 {
+		parts = append(parts, "repos="+strings.Join(s.Repos, ","))
+	}
+	if len(s.Phases) > 0 {
+		parts = append(parts, "phases="+strings.Join(s.Phases, ","))
+	}
+	if s.CustomRoles {
+		parts = append(parts, "custom-roles")
+	}
+	if s.Cleanups {
+		parts = append(parts, "cleanups")
+	}
+	return strings.Join(parts, " ")
+}
+
+func (s Scope) hasTeam(slug string) bool { return containsFold(s.Teams, slug) }
+func (s Scope) hasRepo(name string) bool { return containsFold(s.Repos, name) }
+
+func containsFold(list []string, v string) bool {
+	for _, x := range list {
+		if strings.EqualFold(x, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesFold reports whether v matches one of the path.Match globs in
+// patterns, ignoring case.
+func matchesFold(patterns []string, v string) bool {
+	v = strings.ToLower(v)
+	for _, p := range patterns {
+		if ok, _ := path.Match(strings.ToLower(p), v); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// changePhase returns the planning phase a change belongs to.
+func changePhase(ch util.Change) string {
+	switch ch.Scope {
+	case "custom-role":
+		return PhaseCustomRoles
+	case "team":
+		return PhaseTeams
+	case "team-member", "org-member":
+		return PhaseMembers
+	default:
+		return PhaseRepos
+	}
+}
+
+// includes reports whether ch falls inside s. Changes are matched on their
+// Target: "slug" for teams and members, "slug/repo" for grants, "repo" or
+// "repo:path" for repository changes.
+func (s Scope) includes(ch util.Change) bool {
+	if s.IsZero() {
+		return true
+	}
+	if !s.phase(changePhase(ch)) {
+		return false
+	}
+	if !s.named() {
+		return true
+	}
+	switch ch.Scope {
+	case "custom-role":
+		return true
+	case "org-member":
+		return false
+	case "team", "team-member":
+		return s.hasTeam(ch.Target)
+	case "team-repo":
+		slug, repo, _ := strings.Cut(ch.Target, "/")
+		return s.hasTeam(slug) || s.hasRepo(repo)
+	default:
+		repo, _, _ := strings.Cut(ch.Target, ":")
+		return s.hasRepo(repo)
+	}
+}
+
+// teams returns the configured teams a scoped plan has to look at: the
+// scoped teams and every team granting one of the scoped repos.
+func (s Scope) teams(cfg *config.Root) []config.TeamConfig {
+	if !s.named() {
+		return cfg.Team
+	}
+	var out []config.TeamConfig
+	for _, t := range cfg.Team {
+		relevant := s.hasTeam(t.ResolvedSlug())
+		for repo := range t.Repositories {
+			relevant = relevant || s.hasRepo(repo)
+		}
+		if relevant {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// filter keeps the changes inside s.
+func (s Scope) filter(changes []util.Change) []util.Change {
+	if s.IsZero() {
+		return changes
+	}
+	var out []util.Change
+	for _, ch := range changes {
+		if s.includes(ch) {
+			out = append(out, ch)
+		}
+	}
+	return out
+}
@@ -0,0 +1,109 @@
+package sync
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/DragonSecurity/gomgr/internal/config"
+	"github.com/DragonSecurity/gomgr/internal/util"
+)
+
+func TestScopeIncludes(t *testing.T) {
+	scope := Scope{Teams: []string{"platform"}, Repos: []string{"API"}}
+	tests := []struct {
+		ch   util.Change
+		want bool
+	}{
+		{util.Change{Scope: "team", Target: "platform", Action: "create"}, true},
+		{util.Change{Scope: "team-member", Target: "Platform", Action: "remove"}, true},
+		{util.Change{Scope: "team-member", Target: "web", Action: "remove"}, false},
+		{util.Change{Scope: "team-repo", Target: "web/api", Action: "grant"}, true},
+		{util.Change{Scope: "team-repo", Target: "platform/web", Action: "grant"}, true},
+		{util.Change{Scope: "team-repo", Target: "web/web", Action: "grant"}, false},
+		{util.Change{Scope: "repo", Target: "api", Action: "create"}, true},
+		{util.Change{Scope: "repo-file", Target: "api:README.md", Action: "create"}, true},
+		{util.Change{Scope: "repo-file", Target: "web:README.md", Action: "create"}, false},
+		{util.Change{Scope: "org-member", Target: "alice", Action: "remove"}, false},
+		{util.Change{Scope: "custom-role", Target: "auditor", Action: "create"}, false},
+	}
+	for _, tt := range tests {
+		if got := scope.includes(tt.ch); got != tt.want {
+			t.Errorf("includes(%s:%s %s) = %v, want %v", tt.ch.Scope, tt.ch.Action, tt.ch.Target, got, tt.want)
+		}
+	}
+
+	if !(Scope{}).includes(util.Change{Scope: "org-member", Target: "alice"}) {
+		t.Error("the zero scope should include everything")
+	}
+	if !(Scope{CustomRoles: true}).includes(util.Change{Scope: "custom-role", Target: "auditor"}) {
+		t.Error("CustomRoles scope should include custom-role changes")
+	}
+}
+
+func TestScopeTeams(t *testing.T) {
+	cfg := &config.Root{Team: []config.TeamConfig{
+		{Name: "Platform"},
+		{Name: "Web", Repositories: map[string]any{"api": "pull"}},
+		{Name: "Data", Repositories: map[string]any{"warehouse": "push"}},
+	}}
+	got := Scope{Teams: []string{"platform"}, Repos: []string{"api"}}.teams(cfg)
+	var names []string
+	for _, tm := range got {
+		names = append(names, tm.Name)
+	}
+	if want := []string{"Platform", "Web"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("teams = %v, want %v", names, want)
+	}
+	if len(Scope{}.teams(cfg)) != 3 {
+		t.Error("the zero scope should keep every team")
+	}
+}
+
+func TestScopeString(t *testing.T) {
+	if got := (Scope{}).String(); got != "org" {
+		t.Errorf("zero scope = %q", got)
+	}
+	s := Scope{Teams: []string{"a", "b"}, Repos: []string{"r"}, Cleanups: true}
+	if got, want := s.String(), "teams=a,b repos=r cleanups"; got != want {
+		t.Errorf("String = %q, want %q", got, want)
+	}
+}
+
+func TestParseScope(t *testing.T) {
+	s, err := ParseScope([]string{"platform"}, nil, []string{"Repos", " cleanups"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Scope{Teams: []string{"platform"}, Phases: []string{PhaseRepos}, Cleanups: true}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("ParseScope = %+v, want %+v", s, want)
+	}
+	if _, err := ParseScope(nil, nil, []string{"all"}); err == nil {
+		t.Error("expected an unknown scope to be rejected")
+	}
+	if s, _ := ParseScope(nil, nil, nil); !s.IsZero() {
+		t.Error("no filters should plan the whole org")
+	}
+}
+
+func TestScopePhases(t *testing.T) {
+	s := Scope{Phases: []string{PhaseMembers}}
+	tests := []struct {
+		ch   util.Change
+		want bool
+	}{
+		{util.Change{Scope: "team-member", Target: "web", Action: "ensure"}, true},
+		{util.Change{Scope: "org-member", Target: "alice", Action: "remove"}, true},
+		{util.Change{Scope: "team", Target: "web", Action: "create"}, false},
+		{util.Change{Scope: "repo-file", Target: "api:README.md", Action: "ensure"}, false},
+		{util.Change{Scope: "custom-role", Target: "auditor", Action: "create"}, false},
+	}
+	for _, tt := range tests {
+		if got := s.includes(tt.ch); got != tt.want {
+			t.Errorf("includes(%s:%s %s) = %v, want %v", tt.ch.Scope, tt.ch.Action, tt.ch.Target, got, tt.want)
+		}
+	}
+	if s.cleanups() {
+		t.Error("a phase scope should not plan cleanups unless asked to")
+	}
+}
@@ -4,15 +4,21 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"regexp"
+	"slices"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/google/go-github/v88/github"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/DragonSecurity/gomgr/internal/config"
 	"github.com/DragonSecurity/gomgr/internal/gh"
+	"github.com/DragonSecurity/gomgr/internal/tracing"
 	"github.com/DragonSecurity/gomgr/internal/util"
 )
 
@@ -40,6 +46,7 @@ const (
 	precedenceTeamCreate         = 10
 	precedenceTeamUpdate         = 15
 	precedenceRepoEnsure         = 10
+	precedenceRepoUnarchive      = 10
 	precedenceTeamRepoGrant      = 20
 	precedenceTeamMemberEnsure   = 30
 	precedenceRepoFileEnsure     = 40
@@ -47,8 +54,10 @@ const (
 	precedenceRepoTemplateEnsure = 46
 	precedenceRepoPinEnsure      = 47
 	precedenceRepoFileDelete     = 80
+	precedenceTeamMemberRemove   = 82
 	precedenceOrgMemberRemove    = 85
 	precedenceTeamDelete         = 90
+	precedenceRepoArchive        = 90
 	precedenceRepoDelete         = 90
 	precedenceCustomRoleDelete   = 95
 )
@@ -73,8 +82,18 @@ type repoSettings struct {
 	pinned     bool
 	template   bool
 	from       string
-	visibility string // "", "public", "private", or "internal"
-	codeowners []string
+	visibility string   // "", "public", "private", or "internal"
+	codeowners []string // catch-all (*) owners
+	// codeownerRules are path-scoped CODEOWNERS lines rendered after the
+	// catch-all, in order. GitHub applies the last matching line, so later
+	// rules take precedence over earlier ones.
+	codeownerRules []codeownerRule
+}
+
+// codeownerRule is a single path-scoped CODEOWNERS line.
+type codeownerRule struct {
+	pattern string
+	owners  []string
 }
 
 var validVisibilities = map[string]bool{
@@ -175,27 +194,158 @@ func parseRepoConfig(val any) (repoSettings, error) {
 		}
 
 		if raw, has := m["codeowners"]; has {
-			items, ok := raw.([]any)
-			if !ok {
-				return settings, fmt.Errorf("codeowners must be a list, got %T", raw)
-			}
-			for _, item := range items {
-				coStr, ok := item.(string)
-				if !ok {
-					return settings, fmt.Errorf("codeowners entries must be strings, got %T", item)
-				}
-				coStr = strings.TrimSpace(coStr)
-				if err := config.ValidateCodeOwner(coStr); err != nil {
-					return settings, err
-				}
-				settings.codeowners = append(settings.codeowners, coStr)
+			owners, rules, err := parseCodeowners(raw)
+			if err != nil {
+				return settings, err
 			}
+			settings.codeowners = owners
+			settings.codeownerRules = rules
 		}
 	}
 
 	return settings, nil
 }
 
+// parseCodeowners parses the codeowners value of a repo config. It accepts:
+//   - a list of owners, each applied to every path (*)
+//   - a list mixing owners and {pattern, owners} entries, kept in order
+//   - a map of pattern -> owners, rendered in sorted pattern order
+//
+// owners may be a single string or a list of strings. Rules for the "*"
+// pattern are folded into the catch-all owners.
+func parseCodeowners(raw any) (owners []string, rules []codeownerRule, err error) {
+	if m, ok := normalizeYAMLMap(raw); ok {
+		patterns := make([]string, 0, len(m))
+		for p := range m {
+			patterns = append(patterns, p)
+		}
+		sort.Strings(patterns)
+		for _, p := range patterns {
+			ruleOwners, err := parseOwnerList(m[p])
+			if err != nil {
+				return nil, nil, fmt.Errorf("codeowners pattern %q: %w", p, err)
+			}
+			owners, rules, err = addCodeownerRule(owners, rules, p, ruleOwners)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		return owners, rules, nil
+	}
+
+	items, ok := raw.([]any)
+	if !ok {
+		return nil, nil, fmt.Errorf("codeowners must be a list or a map of pattern to owners, got %T", raw)
+	}
+	for _, item := range items {
+		if coStr, ok := item.(string); ok {
+			coStr = strings.TrimSpace(coStr)
+			if err := config.ValidateCodeOwner(coStr); err != nil {
+				return nil, nil, err
+			}
+			owners = append(owners, coStr)
+			continue
+		}
+		entry, ok := normalizeYAMLMap(item)
+		if !ok {
+			return nil, nil, fmt.Errorf("codeowners entries must be strings or {pattern, owners} maps, got %T", item)
+		}
+		pattern, ok := entry["pattern"].(string)
+		if !ok {
+			return nil, nil, fmt.Errorf("codeowners rule must have a string pattern, got %T", entry["pattern"])
+		}
+		ruleOwners, err := parseOwnerList(entry["owners"])
+		if err != nil {
+			return nil, nil, fmt.Errorf("codeowners pattern %q: %w", pattern, err)
+		}
+		owners, rules, err = addCodeownerRule(owners, rules, pattern, ruleOwners)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return owners, rules, nil
+}
+
+// parseOwnerList accepts a single owner string or a list of them and
+// validates each entry.
+func parseOwnerList(raw any) ([]string, error) {
+	var items []any
+	switch v := raw.(type) {
+	case string:
+		items = []any{v}
+	case []any:
+		items = v
+	default:
+		return nil, fmt.Errorf("owners must be a string or a list, got %T", raw)
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("owners must not be empty")
+	}
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		coStr, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("owners entries must be strings, got %T", item)
+		}
+		coStr = strings.TrimSpace(coStr)
+		if err := config.ValidateCodeOwner(coStr); err != nil {
+			return nil, err
+		}
+		out = append(out, coStr)
+	}
+	return out, nil
+}
+
+// addCodeownerRule validates pattern and appends it to rules, or to the
+// catch-all owners when the pattern is "*".
+func addCodeownerRule(owners []string, rules []codeownerRule, pattern string, ruleOwners []string) ([]string, []codeownerRule, error) {
+	pattern = strings.TrimSpace(pattern)
+	if err := config.ValidateCodeOwnersPattern(pattern); err != nil {
+		return nil, nil, err
+	}
+	if pattern == "*" {
+		return append(owners, ruleOwners...), rules, nil
+	}
+	return owners, append(rules, codeownerRule{pattern: pattern, owners: ruleOwners}), nil
+}
+
+// mergeCodeowners unions the codeowners of base and extra. Catch-all owners
+// keep base's order followed by extra's new entries; rules are ordered the
+// same way, and a rule whose pattern already appears in base is merged into
+// that earlier position with its owners unioned.
+func mergeCodeowners(base, extra repoSettings) ([]string, []codeownerRule) {
+	owners := unionStrings(base.codeowners, extra.codeowners)
+
+	var rules []codeownerRule
+	index := map[string]int{}
+	for _, list := range [][]codeownerRule{base.codeownerRules, extra.codeownerRules} {
+		for _, rule := range list {
+			if i, ok := index[rule.pattern]; ok {
+				rules[i].owners = unionStrings(rules[i].owners, rule.owners)
+				continue
+			}
+			index[rule.pattern] = len(rules)
+			rules = append(rules, codeownerRule{pattern: rule.pattern, owners: unionStrings(nil, rule.owners)})
+		}
+	}
+	return owners, rules
+}
+
+// unionStrings returns a followed by the entries of b not already in a.
+func unionStrings(a, b []string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, list := range [][]string{a, b} {
+		for _, s := range list {
+			if !seen[s] {
+				seen[s] = true
+				out = append(out, s)
+			}
+		}
+	}
+	return out
+}
+
 // parseTemplateRef splits a template reference into org and repo parts.
 // Supports "repo-name" (uses defaultOrg) or "org/repo-name".
 func parseTemplateRef(ref, defaultOrg string) (org, repo string) {
@@ -260,19 +410,8 @@ func resolveTemplate(_ string, settings repoSettings, allRepos map[string]repoSe
 		}
 	}
 
-	// Merge codeowners (union): template codeowners + repo-specific codeowners
-	result.codeowners = nil
-	ownerSet := make(map[string]bool)
-	for _, co := range templateSettings.codeowners {
-		ownerSet[co] = true
-		result.codeowners = append(result.codeowners, co)
-	}
-	for _, co := range settings.codeowners {
-		if !ownerSet[co] {
-			ownerSet[co] = true
-			result.codeowners = append(result.codeowners, co)
-		}
-	}
+	// Merge codeowners (union): template owners and rules first, then repo-specific
+	result.codeowners, result.codeownerRules = mergeCodeowners(templateSettings, settings)
 
 	// Don't inherit template or pinned flags
 	// result.template is already false (or explicitly set)
@@ -366,7 +505,10 @@ func planTeams(_ context.Context, _ *gh.Client, cfg *config.Root, st *State) ([]
 	return out, desired, nil
 }
 
-func planTeamMembership(ctx context.Context, c *gh.Client, st *State, desiredBySlug map[string]config.TeamConfig) ([]util.Change, error) {
+// planTeamMembership ensures every configured maintainer and member holds
+// their role in each desired team. With removeExtra, users in a team who are
+// not configured for it are removed as well, unless they match ignoreUsers.
+func planTeamMembership(ctx context.Context, c *gh.Client, st *State, desiredBySlug map[string]config.TeamConfig, removeExtra bool, ignoreUsers []string) ([]util.Change, error) {
 	var out []util.Change
 	org := st.Org
 
@@ -460,7 +602,28 @@ func planTeamMembership(ctx context.Context, c *gh.Client, st *State, desiredByS
 				Details: teamMemberChange{Org: org, Slug: slug, User: user, Role: role},
 			})
 		}
-		// (optional) removals left for later
+		if removeExtra {
+			var extra []string
+			for user := range got {
+				if _, ok := wantRole[user]; ok {
+					continue
+				}
+				if matchesFold(ignoreUsers, user) {
+					st.Ignored++
+					continue
+				}
+				extra = append(extra, user)
+			}
+			sort.Strings(extra)
+			for _, user := range extra {
+				out = append(out, util.Change{
+					Scope:   "team-member",
+					Target:  slug,
+					Action:  "remove",
+					Details: teamMemberChange{Org: org, Slug: slug, User: user, Role: got[user]},
+				})
+			}
+		}
 	}
 
 	// Update state
@@ -485,6 +648,11 @@ func collectRepoSettings(cfg *config.Root, _ string) (allSettings map[string]rep
 			if err != nil {
 				return nil, nil, fmt.Errorf("invalid config for repo %s in team %s: %w", repo, slug, err)
 			}
+			// Codeowners accumulate across teams (earlier teams first);
+			// every other setting is taken from the last team declaring the repo.
+			if prev, ok := allSettings[r]; ok {
+				settings.codeowners, settings.codeownerRules = mergeCodeowners(prev, settings)
+			}
 			allSettings[r] = settings
 		}
 	}
@@ -562,8 +730,12 @@ func extractRepoPerm(repo *github.Repository) string {
 	}
 }
 
-func planRepoPerms(ctx context.Context, c *gh.Client, cfg *config.Root, st *State) ([]util.Change, error) {
+// planRepoPerms plans repository creation, team grants, files, topics and
+// template flags. The warnings flag hand-authored files GitHub would
+// partly ignore.
+func planRepoPerms(ctx context.Context, c *gh.Client, cfg *config.Root, st *State) ([]util.Change, []string, error) {
 	var out []util.Change
+	var warnings []string
 	org := st.Org
 
 	// use prefetched repos
@@ -577,14 +749,15 @@ func planRepoPerms(ctx context.Context, c *gh.Client, cfg *config.Root, st *Stat
 
 	allRepoSettings, managedRepos, err := collectRepoSettings(cfg, org)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	resolvedSettings, err := resolveAllTemplates(allRepoSettings, org)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
+	repoInfos := collectRepoInfos(cfg, resolvedSettings, existingRepos)
 	fileSpecs := materializeFileSpecs(cfg.App)
 	userFilePaths := map[string]bool{}
 	for _, fs := range fileSpecs {
@@ -594,14 +767,12 @@ func planRepoPerms(ctx context.Context, c *gh.Client, cfg *config.Root, st *Stat
 	desiredTopics := map[string][]string{}
 	desiredPinned := map[string]bool{}
 	desiredTemplates := map[string]bool{}
-	desiredOwners := map[string][]string{}
-	ownerSeen := map[string]map[string]bool{}
-	repoNames := map[string]string{}
+	desiredOwners := map[string]codeownersSpec{}
 	emittedFiles := map[string]bool{} // tracks repo-level file changes to avoid duplicates
 
 	for _, t := range cfg.Team {
 		if ctx.Err() != nil {
-			return nil, ctx.Err()
+			return nil, nil, ctx.Err()
 		}
 		slug := t.ResolvedSlug()
 		for repo := range t.Repositories {
@@ -657,7 +828,7 @@ func planRepoPerms(ctx context.Context, c *gh.Client, cfg *config.Root, st *Stat
 				}
 				for _, topic := range settings.topics {
 					if err := validateTopic(topic); err != nil {
-						return nil, fmt.Errorf("invalid topic for repo %s: %w", repo, err)
+						return nil, nil, fmt.Errorf("invalid topic for repo %s: %w", repo, err)
 					}
 					if !topicSet[topic] {
 						existingTopics = append(existingTopics, topic)
@@ -671,40 +842,37 @@ func planRepoPerms(ctx context.Context, c *gh.Client, cfg *config.Root, st *Stat
 				desiredPinned[r] = true
 			}
 
-			if len(settings.codeowners) > 0 {
-				if _, ok := repoNames[r]; !ok {
-					repoNames[r] = repo
-				}
-				if ownerSeen[r] == nil {
-					ownerSeen[r] = map[string]bool{}
-				}
-				for _, co := range settings.codeowners {
-					if ownerSeen[r][co] {
-						continue
-					}
-					ownerSeen[r][co] = true
-					desiredOwners[r] = append(desiredOwners[r], co)
-				}
+			if len(settings.codeowners) > 0 || len(settings.codeownerRules) > 0 {
+				desiredOwners[r] = codeownersSpec{owners: settings.codeowners, rules: settings.codeownerRules}
 			}
 
 			// Emit file changes only once per repo (skip if already emitted from another team)
-			fileChanges, err := planRepoFiles(org, repo, r, fileSpecs, cfg.App.SignOff, emittedFiles)
+			fileChanges, fileWarnings, err := planRepoFiles(org, repoInfos[r], r, fileSpecs, cfg.App.SignOff, emittedFiles)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			out = append(out, fileChanges...)
+			warnings = append(warnings, fileWarnings...)
 		}
 	}
 
-	out = append(out, planCodeowners(org, desiredOwners, repoNames, userFilePaths, cfg.App.SignOff, emittedFiles)...)
+	codeownerChanges, err := planCodeowners(org, desiredOwners, repoInfos, userFilePaths, cfg.App.SignOff, emittedFiles)
+	if err != nil {
+		return nil, nil, err
+	}
+	out = append(out, codeownerChanges...)
 	if cfg.App.DeleteStaleCodeowners {
-		out = append(out, planCodeownersDeletions(org, managedRepos, repoNames, desiredOwners, userFilePaths, cfg.App.SignOff, emittedFiles)...)
+		stale, err := keepExistingFiles(ctx, c, planCodeownersDeletions(org, managedRepos, repoInfos, desiredOwners, userFilePaths, cfg.App.SignOff, emittedFiles))
+		if err != nil {
+			return nil, nil, err
+		}
+		out = append(out, stale...)
 	}
 
 	// Plan topic updates
 	for repo, topics := range desiredTopics {
 		if len(topics) > 20 {
-			return nil, fmt.Errorf("repo %s has %d topics (max 20 allowed)", repo, len(topics))
+			return nil, nil, fmt.Errorf("repo %s has %d topics (max 20 allowed)", repo, len(topics))
 		}
 		needsUpdate := false
 		if existingRepo, ok := existingRepos[repo]; ok {
@@ -782,13 +950,23 @@ func planRepoPerms(ctx context.Context, c *gh.Client, cfg *config.Root, st *Stat
 		}
 	}
 
+	if cfg.App.UnarchiveManagedRepos {
+		out = append(out, planRepoUnarchives(org, managedRepos, existingRepos, cfg.App.UnmanagedRepoTopic)...)
+	}
+
 	st.ManagedRepos = managedRepos
 	st.CurrentRepos = len(existing)
 	st.DesiredRepos = len(managedRepos)
 
-	currentPerms, currentPermMap, err := fetchCurrentPermissions(ctx, c, cfg, org)
+	fetchCtx, span := tracing.Start(ctx, "plan fetchCurrentPermissions")
+	// A scoped plan only needs the grants of teams that can produce changes
+	// inside the scope.
+	fetchCfg := *cfg
+	fetchCfg.Team = st.scope.teams(cfg)
+	currentPerms, currentPermMap, err := fetchCurrentPermissions(fetchCtx, c, &fetchCfg, org)
+	tracing.End(span, err)
 	if err != nil {
-		return nil, fmt.Errorf("fetch current permissions: %w", err)
+		return nil, nil, fmt.Errorf("fetch current permissions: %w", err)
 	}
 	st.CurrentRepoPerms = currentPerms
 	desiredPermsCount := 0
@@ -813,22 +991,52 @@ func planRepoPerms(ctx context.Context, c *gh.Client, cfg *config.Root, st *Stat
 		filtered = append(filtered, ch)
 	}
 
-	return filtered, nil
+	return filtered, warnings, nil
+}
+
+// planRepoUnarchives generates unarchive changes for archived repositories
+// that are managed again. With a marker topic, only repositories carrying it
+// (the ones gomgr archived) are unarchived, and the topic is dropped.
+func planRepoUnarchives(org string, managedRepos map[string]bool, existingRepos map[string]*github.Repository, topic string) []util.Change {
+	var out []util.Change
+	for name := range managedRepos {
+		r, ok := existingRepos[name]
+		if !ok || !r.GetArchived() {
+			continue
+		}
+		details := map[string]any{"org": org, "repo": r.GetName()}
+		if topic != "" {
+			if !slices.Contains(r.Topics, topic) {
+				continue
+			}
+			details["topics"] = slices.DeleteFunc(slices.Clone(r.Topics), func(t string) bool { return t == topic })
+		}
+		out = append(out, util.Change{Scope: "repo", Target: name, Action: "unarchive", Details: details})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Target < out[j].Target })
+	return out
 }
 
-// planTeamCleanups generates delete changes for teams not in the desired set.
-func planTeamCleanups(st *State, org string, desired map[string]config.TeamConfig) ([]util.Change, error) {
+// planTeamCleanups generates delete changes for teams not in the desired set
+// and not ignored.
+func planTeamCleanups(st *State, org string, desired map[string]config.TeamConfig, ignore []string) ([]util.Change, error) {
 	var out []util.Change
 	for _, at := range st.ActualTeams {
 		if _, ok := desired[at.GetSlug()]; !ok {
+			if matchesFold(ignore, at.GetSlug()) {
+				st.Ignored++
+				continue
+			}
 			out = append(out, util.Change{Scope: "team", Target: at.GetSlug(), Action: "delete", Details: map[string]any{"org": org, "slug": at.GetSlug()}})
 		}
 	}
 	return out, nil
 }
 
-// planMemberCleanups generates remove changes for org members not in any team.
-func planMemberCleanups(ctx context.Context, c *gh.Client, org string) ([]util.Change, error) {
+// planMemberCleanups generates remove changes for org members not in any team
+// and not ignored.
+func planMemberCleanups(ctx context.Context, c *gh.Client, st *State, ignore []string) ([]util.Change, error) {
+	org := st.Org
 	var out []util.Change
 	memOpt := &github.ListMembersOptions{
 		Role:        roleMember,
@@ -877,37 +1085,75 @@ func planMemberCleanups(ctx context.Context, c *gh.Client, org string) ([]util.C
 	for _, u := range members {
 		login := strings.ToLower(u.GetLogin())
 		if !inAnyTeam[login] {
+			if matchesFold(ignore, login) {
+				st.Ignored++
+				continue
+			}
 			out = append(out, util.Change{Scope: "org-member", Target: login, Action: "remove", Details: map[string]any{"org": org, "user": login}})
 		}
 	}
 	return out, nil
 }
 
-// planRepoCleanups generates delete/warning changes for unmanaged repositories.
+// planRepoCleanups generates warnings and archive or delete changes for
+// unmanaged repositories, as cfg.App.RepoCleanupAction says. With a grace
+// period, repositories pushed to more recently are left alone; archived
+// repositories are never archived again. Ignored repositories are skipped
+// entirely.
 func planRepoCleanups(cfg *config.Root, st *State) ([]util.Change, []string, error) {
 	var out []util.Change
 	var warnings []string
 	org := st.Org
-	var unmanagedRepos []string
+	action := cfg.App.RepoCleanupAction()
+	var cutoff time.Time
+	if days := cfg.App.UnmanagedRepoGraceDays; days > 0 {
+		cutoff = time.Now().AddDate(0, 0, -days)
+	}
+	var unmanagedRepos, recentRepos []string
 	for _, repo := range st.ActualRepos {
 		repoName := strings.ToLower(repo.GetName())
-		if !st.ManagedRepos[repoName] {
-			unmanagedRepos = append(unmanagedRepos, repo.GetName())
-			if cfg.App.DeleteUnmanagedRepos {
-				out = append(out, util.Change{
-					Scope:  "repo",
-					Target: repoName,
-					Action: "delete",
-					Details: map[string]any{
-						"org":  org,
-						"repo": repo.GetName(),
-					},
-				})
+		if st.ManagedRepos[repoName] {
+			continue
+		}
+		if matchesFold(cfg.App.Ignore.Repos, repoName) {
+			st.Ignored++
+			continue
+		}
+		unmanagedRepos = append(unmanagedRepos, repo.GetName())
+		if action != config.UnmanagedRepoArchive && action != config.UnmanagedRepoDelete {
+			continue
+		}
+		if !cutoff.IsZero() && repo.GetPushedAt().After(cutoff) {
+			recentRepos = append(recentRepos, repo.GetName())
+			continue
+		}
+		details := map[string]any{
+			"org":  org,
+			"repo": repo.GetName(),
+		}
+		if action == config.UnmanagedRepoArchive {
+			if repo.GetArchived() {
+				continue
 			}
+			if topic := cfg.App.UnmanagedRepoTopic; topic != "" && !slices.Contains(repo.Topics, topic) {
+				details["topics"] = append(slices.Clone(repo.Topics), topic)
+			}
+		}
+		out = append(out, util.Change{
+			Scope:   "repo",
+			Target:  repoName,
+			Action:  action,
+			Details: details,
+		})
+	}
+	if cfg.App.DryWarnings.WarnUnmanagedRepos || action == config.UnmanagedRepoWarn {
+		if len(unmanagedRepos) > 0 {
+			warnings = append(warnings, fmt.Sprintf("Found %d unmanaged repositories: %v", len(unmanagedRepos), unmanagedRepos))
 		}
 	}
-	if cfg.App.DryWarnings.WarnUnmanagedRepos && len(unmanagedRepos) > 0 {
-		warnings = append(warnings, fmt.Sprintf("Found %d unmanaged repositories: %v", len(unmanagedRepos), unmanagedRepos))
+	if len(recentRepos) > 0 {
+		warnings = append(warnings, fmt.Sprintf("Leaving %d unmanaged repositories pushed to in the last %d days: %v",
+			len(recentRepos), cfg.App.UnmanagedRepoGraceDays, recentRepos))
 	}
 	return out, warnings, nil
 }
@@ -917,29 +1163,39 @@ func planCleanups(ctx context.Context, c *gh.Client, cfg *config.Root, st *State
 	var warnings []string
 	org := st.Org
 
-	if cfg.App.DeleteUnconfiguredTeams {
+	// The dry warnings report what the matching cleanup would do, ignore
+	// lists included; with the cleanup on, its changes say it instead.
+	if cfg.App.DeleteUnconfiguredTeams || cfg.App.DryWarnings.WarnUnmanagedTeams {
 		if ctx.Err() != nil {
 			return nil, nil, ctx.Err()
 		}
-		changes, err := planTeamCleanups(st, org, desired)
+		changes, err := planTeamCleanups(st, org, desired, cfg.App.Ignore.Teams)
 		if err != nil {
 			return nil, nil, err
 		}
-		out = append(out, changes...)
+		if cfg.App.DeleteUnconfiguredTeams {
+			out = append(out, changes...)
+		} else if len(changes) > 0 {
+			warnings = append(warnings, fmt.Sprintf("Found %d unmanaged teams: %v", len(changes), changeTargets(changes)))
+		}
 	}
 
-	if cfg.App.RemoveMembersWithoutTeam {
+	if cfg.App.RemoveMembersWithoutTeam || cfg.App.DryWarnings.WarnMembersWithoutAnyTeam {
 		if ctx.Err() != nil {
 			return nil, nil, ctx.Err()
 		}
-		changes, err := planMemberCleanups(ctx, c, org)
+		changes, err := planMemberCleanups(ctx, c, st, cfg.App.Ignore.Users)
 		if err != nil {
 			return nil, nil, err
 		}
-		out = append(out, changes...)
+		if cfg.App.RemoveMembersWithoutTeam {
+			out = append(out, changes...)
+		} else if len(changes) > 0 {
+			warnings = append(warnings, fmt.Sprintf("Found %d org members without any team: %v", len(changes), changeTargets(changes)))
+		}
 	}
 
-	if cfg.App.DeleteUnmanagedRepos || cfg.App.DryWarnings.WarnUnmanagedRepos {
+	if cfg.App.RepoCleanupAction() != "" {
 		if ctx.Err() != nil {
 			return nil, nil, ctx.Err()
 		}
@@ -954,6 +1210,15 @@ func planCleanups(ctx context.Context, c *gh.Client, cfg *config.Root, st *State
 	return out, warnings, nil
 }
 
+// changeTargets returns the targets of changes, in order.
+func changeTargets(changes []util.Change) []string {
+	out := make([]string, 0, len(changes))
+	for _, ch := range changes {
+		out = append(out, ch.Target)
+	}
+	return out
+}
+
 // containsErrorMessage checks if a GitHub ErrorResponse contains a specific error message
 // in either the main Message field or in any of the individual Error messages in the Errors array.
 func containsErrorMessage(ghErr *github.ErrorResponse, searchTerms ...string) bool {
@@ -994,6 +1259,9 @@ func applyChanges(ctx context.Context, c *gh.Client, changes []util.Change) erro
 	return applyChangesWith(ctx, c, changes, defaultRegistry, ApplyOptions{})
 }
 
+// applyChangesWith applies changes through reg. Precedence fixes the plan
+// order; the dependency graph built from it decides what may run in
+// parallel.
 func applyChangesWith(ctx context.Context, c *gh.Client, changes []util.Change, reg *HandlerRegistry, opts ApplyOptions) error {
 	sort.SliceStable(changes, func(i, j int) bool {
 		return reg.Precedence(changes[i].Scope, changes[i].Action) <
@@ -1003,56 +1271,46 @@ func applyChangesWith(ctx context.Context, c *gh.Client, changes []util.Change,
 	// Apply custom role changes first — they have their own dispatcher. These
 	// are a prerequisite for dependent changes, so a failure here always aborts
 	// regardless of ContinueOnError.
-	if err := applyCustomRoleChanges(ctx, c, changes); err != nil {
+	if err := applyCustomRoleChanges(ctx, c, changes, opts); err != nil {
 		return err
 	}
 
-	// Count non-custom-role changes for progress display.
-	total := 0
+	var rest []util.Change
 	for _, ch := range changes {
-		if !strings.HasPrefix(ch.Scope, "custom-role") {
-			total++
+		if !strings.HasPrefix(ch.Scope, "custom-role") || isCleanup(ch) {
+			rest = append(rest, ch)
 		}
 	}
+	return runApplyGraph(ctx, c, buildApplyGraph(rest), reg, opts)
+}
 
-	var failed []error
-	applied := 0
-	for _, ch := range changes {
-		if ctx.Err() != nil {
-			return ctx.Err()
-		}
-		if strings.HasPrefix(ch.Scope, "custom-role") {
-			continue
-		}
-
-		applied++
-		util.Infof("[%d/%d] %s:%s %s", applied, total, ch.Scope, ch.Action, ch.Target)
-
-		if err := gh.RespectRate(ctx, c.REST); err != nil {
-			util.Warnf("rate limit check failed: %v", err)
-		}
+// startChangeSpan starts the span one change is applied in.
+func startChangeSpan(ctx context.Context, ch util.Change) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "apply "+ch.Scope+":"+ch.Action,
+		attribute.String("gomgr.scope", ch.Scope),
+		attribute.String("gomgr.action", ch.Action),
+		attribute.String("gomgr.target", ch.Target),
+	)
+}
 
-		handler, ok := reg.Lookup(ch.Scope, ch.Action)
-		if !ok {
-			util.Warnf("no handler for change %s:%s on %s", ch.Scope, ch.Action, ch.Target)
-			continue
-		}
-		if err := handler.Apply(ctx, c, ch); err != nil {
-			util.Audit(ch.Scope, ch.Target, ch.Action, "error")
-			if !opts.ContinueOnError {
-				return err
-			}
-			wrapped := fmt.Errorf("%s:%s %s: %w", ch.Scope, ch.Action, ch.Target, err)
-			util.Warnf("continuing after error: %v", wrapped)
-			failed = append(failed, wrapped)
-			continue
-		}
-		util.Audit(ch.Scope, ch.Target, ch.Action, "ok")
+// logAppliedChange emits the progress record for one applied change. Besides
+// the change identity it carries how long the handler took and the GitHub
+// request ID of its last API call, so a failure can be traced in GitHub's own
+// logs.
+func logAppliedChange(ctx context.Context, n, total int, ch util.Change, d time.Duration, requestID string, err error) {
+	attrs := []slog.Attr{
+		slog.String("scope", ch.Scope),
+		slog.String("target", ch.Target),
+		slog.String("action", ch.Action),
+		slog.Duration("duration", d),
 	}
-
-	if len(failed) > 0 {
-		util.Warnf("%d of %d changes failed", len(failed), total)
-		return fmt.Errorf("apply completed with %d error(s): %w", len(failed), errors.Join(failed...))
+	if requestID != "" {
+		attrs = append(attrs, slog.String("request_id", requestID))
 	}
-	return nil
+	level := slog.LevelInfo
+	if err != nil {
+		level = slog.LevelError
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	util.Logger().LogAttrs(ctx, level, fmt.Sprintf("[%d/%d] %s:%s %s", n, total, ch.Scope, ch.Action, ch.Target), attrs...)
 }
@@ -3,10 +3,13 @@ package sync
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-github/v88/github"
 
@@ -820,23 +823,45 @@ func TestPlanTeamMembership(t *testing.T) {
 		},
 	}
 
-	changes, err := planTeamMembership(context.Background(), c, st, desiredBySlug)
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
-	}
+	for _, removeExtra := range []bool{false, true} {
+		changes, err := planTeamMembership(context.Background(), c, st, desiredBySlug, removeExtra, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
 
-	// Should have a change for charlie (new member)
-	found := false
-	for _, ch := range changes {
-		if ch.Scope == "team-member" && ch.Action == "ensure" {
+		// Should have a change for charlie (new member); bob is only
+		// removed when extra members are removed.
+		found, removed := false, false
+		for _, ch := range changes {
 			d := ch.Details.(teamMemberChange)
-			if d.User == "charlie" && d.Role == "member" {
+			switch {
+			case ch.Action == "ensure" && d.User == "charlie" && d.Role == "member":
 				found = true
+			case ch.Action == "remove" && d.User == "bob":
+				removed = true
+			case ch.Action == "remove":
+				t.Errorf("unexpected removal of %s", d.User)
 			}
 		}
+		if !found {
+			t.Error("expected team-member:ensure change for charlie")
+		}
+		if removed != removeExtra {
+			t.Errorf("removeExtra=%v: team-member:remove for bob planned = %v", removeExtra, removed)
+		}
 	}
-	if !found {
-		t.Error("expected team-member:ensure change for charlie")
+
+	changes, err := planTeamMembership(context.Background(), c, st, desiredBySlug, true, []string{"B*"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, ch := range changes {
+		if ch.Action == "remove" {
+			t.Errorf("expected ignored bob to stay in the team, got %+v", ch)
+		}
+	}
+	if st.Ignored != 1 {
+		t.Errorf("expected 1 ignored member, got %d", st.Ignored)
 	}
 }
 
@@ -875,7 +900,7 @@ func TestPlanRepoPerms(t *testing.T) {
 		},
 	}
 
-	changes, err := planRepoPerms(context.Background(), c, cfg, st)
+	changes, _, err := planRepoPerms(context.Background(), c, cfg, st)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -902,6 +927,51 @@ func TestPlanRepoPerms(t *testing.T) {
 	}
 }
 
+func TestPlanRepoPerms_StaleCodeownersOnlyWhereTheFileExists(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/orgs/myorg/teams/") && strings.HasSuffix(r.URL.Path, "/repos"):
+			_ = json.NewEncoder(w).Encode([]map[string]any{})
+		case r.URL.Path == "/repos/myorg/svc-00/contents/.github/CODEOWNERS":
+			_, _ = w.Write([]byte(`{"type":"file","path":".github/CODEOWNERS","sha":"abc"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	// Twelve owner-less repos, more than the default destructive limit; only
+	// one of them still has a CODEOWNERS to delete.
+	repos := map[string]any{}
+	st := &State{Org: "myorg"}
+	for i := range 12 {
+		name := fmt.Sprintf("svc-%02d", i)
+		repos[name] = "push"
+		st.ActualRepos = append(st.ActualRepos, &github.Repository{Name: github.Ptr(name), DefaultBranch: github.Ptr("main")})
+	}
+	cfg := &config.Root{
+		App:  config.AppConfig{Org: "myorg", DeleteStaleCodeowners: true},
+		Team: []config.TeamConfig{{Name: "Backend", Slug: "backend", Repositories: repos}},
+	}
+
+	changes, _, err := planRepoPerms(context.Background(), newTestClient(t, server), cfg, st)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var deletes []string
+	for _, ch := range changes {
+		if ch.Scope == "repo-file" && ch.Action == "delete" {
+			deletes = append(deletes, ch.Target)
+		}
+	}
+	if !reflect.DeepEqual(deletes, []string{"svc-00:.github/CODEOWNERS"}) {
+		t.Errorf("expected a delete only for the repo with a CODEOWNERS, got %v", deletes)
+	}
+	if err := DestructiveLimitFor(cfg.App, -1).Check(util.Plan{Changes: changes}); err != nil {
+		t.Errorf("guardrail fired for absent CODEOWNERS files: %v", err)
+	}
+}
+
 func TestPlanCleanups(t *testing.T) {
 	cfg := &config.Root{
 		App: config.AppConfig{
@@ -954,6 +1024,156 @@ func TestPlanCleanups(t *testing.T) {
 	}
 }
 
+func TestPlanCleanups_Ignore(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/orgs/myorg/members":
+			_ = json.NewEncoder(w).Encode([]map[string]any{{"login": "alice"}, {"login": "renovate-bot"}, {"login": "mallory"}})
+		case "/orgs/myorg/teams":
+			_ = json.NewEncoder(w).Encode([]map[string]any{{"slug": "backend"}})
+		case "/orgs/myorg/teams/backend/members":
+			_ = json.NewEncoder(w).Encode([]map[string]any{{"login": "alice"}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cfg := &config.Root{
+		App: config.AppConfig{
+			Org:                      "myorg",
+			DeleteUnconfiguredTeams:  true,
+			RemoveMembersWithoutTeam: true,
+			UnmanagedRepoAction:      config.UnmanagedRepoDelete,
+			Ignore: config.IgnoreConfig{
+				Teams: []string{"idp-*"},
+				Repos: []string{"archive-*"},
+				Users: []string{"*-bot"},
+			},
+		},
+	}
+	cfg.App.DryWarnings.WarnUnmanagedRepos = true
+	desired := map[string]config.TeamConfig{"backend": {Name: "Backend", Slug: "backend"}}
+	st := &State{
+		Org:          "myorg",
+		ManagedRepos: map[string]bool{"api": true},
+		ActualTeams: []*github.Team{
+			{Slug: github.Ptr("backend")},
+			{Slug: github.Ptr("old-team")},
+			{Slug: github.Ptr("idp-engineering")},
+		},
+		ActualRepos: []*github.Repository{
+			{Name: github.Ptr("api")},
+			{Name: github.Ptr("legacy-app")},
+			{Name: github.Ptr("Archive-2019")},
+		},
+	}
+
+	changes, warnings, err := planCleanups(context.Background(), newTestClient(t, server), cfg, st, desired)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got []string
+	for _, ch := range changes {
+		got = append(got, ch.Scope+":"+ch.Action+" "+ch.Target)
+	}
+	want := []string{"team:delete old-team", "org-member:remove mallory", "repo:delete legacy-app"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("changes = %v, want %v", got, want)
+	}
+	if len(warnings) != 1 || strings.Contains(warnings[0], "Archive-2019") {
+		t.Errorf("expected ignored repos to stay out of the warning, got %v", warnings)
+	}
+	if st.Ignored != 3 {
+		t.Errorf("expected 3 ignored resources, got %d", st.Ignored)
+	}
+
+	// Warning instead of cleaning up leaves ignored teams and users out too.
+	cfg.App.DeleteUnconfiguredTeams = false
+	cfg.App.RemoveMembersWithoutTeam = false
+	cfg.App.UnmanagedRepoAction = ""
+	cfg.App.DryWarnings.WarnUnmanagedRepos = false
+	cfg.App.DryWarnings.WarnUnmanagedTeams = true
+	cfg.App.DryWarnings.WarnMembersWithoutAnyTeam = true
+	changes, warnings, err = planCleanups(context.Background(), newTestClient(t, server), cfg, st, desired)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wantWarnings := []string{
+		"Found 1 unmanaged teams: [old-team]",
+		"Found 1 org members without any team: [mallory]",
+	}
+	if len(changes) != 0 || !reflect.DeepEqual(warnings, wantWarnings) {
+		t.Errorf("changes = %v, warnings = %v; want no changes and %v", changes, warnings, wantWarnings)
+	}
+}
+
+func TestPlanRepoCleanups_Archive(t *testing.T) {
+	now := time.Now()
+	pushed := func(daysAgo int) *github.Timestamp {
+		return &github.Timestamp{Time: now.AddDate(0, 0, -daysAgo)}
+	}
+	cfg := &config.Root{App: config.AppConfig{
+		Org:                    "myorg",
+		UnmanagedRepoAction:    config.UnmanagedRepoArchive,
+		UnmanagedRepoGraceDays: 90,
+		UnmanagedRepoTopic:     "gomgr-unmanaged",
+	}}
+	st := &State{
+		Org:          "myorg",
+		ManagedRepos: map[string]bool{"api": true},
+		ActualRepos: []*github.Repository{
+			{Name: github.Ptr("api"), PushedAt: pushed(400)},
+			{Name: github.Ptr("Legacy"), PushedAt: pushed(400), Topics: []string{"go"}},
+			{Name: github.Ptr("spike"), PushedAt: pushed(10)},
+			{Name: github.Ptr("frozen"), PushedAt: pushed(400), Archived: github.Ptr(true)},
+		},
+	}
+
+	changes, warnings, err := planRepoCleanups(cfg, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Action != "archive" || changes[0].Target != "legacy" {
+		t.Fatalf("expected one archive of legacy, got %+v", changes)
+	}
+	if topics := changes[0].Details.(map[string]any)["topics"]; !reflect.DeepEqual(topics, []string{"go", "gomgr-unmanaged"}) {
+		t.Errorf("expected the marker topic to be added, got %v", topics)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "[spike]") {
+		t.Errorf("expected a grace period warning for spike, got %v", warnings)
+	}
+
+	cfg.App.UnmanagedRepoAction = config.UnmanagedRepoWarn
+	changes, warnings, _ = planRepoCleanups(cfg, st)
+	if len(changes) != 0 || len(warnings) != 1 || !strings.Contains(warnings[0], "Found 3 unmanaged") {
+		t.Errorf("expected warn to only warn, got %v %v", changes, warnings)
+	}
+}
+
+func TestPlanRepoUnarchives(t *testing.T) {
+	existing := map[string]*github.Repository{
+		"api":    {Name: github.Ptr("api"), Archived: github.Ptr(true), Topics: []string{"go", "gomgr-unmanaged"}},
+		"web":    {Name: github.Ptr("web"), Archived: github.Ptr(true)},
+		"docs":   {Name: github.Ptr("docs")},
+		"legacy": {Name: github.Ptr("legacy"), Archived: github.Ptr(true), Topics: []string{"gomgr-unmanaged"}},
+	}
+	managed := map[string]bool{"api": true, "web": true, "docs": true}
+
+	got := planRepoUnarchives("myorg", managed, existing, "gomgr-unmanaged")
+	if len(got) != 1 || got[0].Target != "api" || got[0].Action != "unarchive" {
+		t.Fatalf("expected only the repo gomgr archived to come back, got %+v", got)
+	}
+	if topics := got[0].Details.(map[string]any)["topics"]; !reflect.DeepEqual(topics, []string{"go"}) {
+		t.Errorf("expected the marker topic to be dropped, got %v", topics)
+	}
+
+	got = planRepoUnarchives("myorg", managed, existing, "")
+	if len(got) != 2 || got[0].Target != "api" || got[1].Target != "web" {
+		t.Errorf("expected every archived managed repo without a marker topic, got %+v", got)
+	}
+}
+
 func TestApplyChanges_ContextCanceled(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel() // cancel immediately
@@ -1126,3 +1346,134 @@ func TestResolveTemplate_CodeownersUnion(t *testing.T) {
 		}
 	}
 }
+
+func TestParseRepoConfig_CodeownerRules(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      any
+		wantOwners []string
+		wantRules  []codeownerRule
+		wantErr    bool
+	}{
+		{
+			name: "ordered list mixing owners and rules",
+			input: map[string]any{"codeowners": []any{
+				"@org/platform",
+				map[string]any{"pattern": "/infra/", "owners": []any{"@org/devops-team"}},
+				map[string]any{"pattern": "*.sql", "owners": "@org/dba"},
+			}},
+			wantOwners: []string{"@org/platform"},
+			wantRules: []codeownerRule{
+				{pattern: "/infra/", owners: []string{"@org/devops-team"}},
+				{pattern: "*.sql", owners: []string{"@org/dba"}},
+			},
+		},
+		{
+			name: "map sorted by pattern, star folded into catch-all",
+			input: map[string]any{"codeowners": map[string]any{
+				"docs/":  []any{"octocat"},
+				"*":      "@org/platform",
+				"/infra": []any{"@org/devops-team"},
+			}},
+			wantOwners: []string{"@org/platform"},
+			wantRules: []codeownerRule{
+				{pattern: "/infra", owners: []string{"@org/devops-team"}},
+				{pattern: "docs/", owners: []string{"octocat"}},
+			},
+		},
+		{
+			name:    "negated pattern",
+			input:   map[string]any{"codeowners": map[string]any{"!vendor/": "octocat"}},
+			wantErr: true,
+		},
+		{
+			name:    "character range",
+			input:   map[string]any{"codeowners": []any{map[string]any{"pattern": "*.[ch]", "owners": "octocat"}}},
+			wantErr: true,
+		},
+		{
+			name:    "rule without owners",
+			input:   map[string]any{"codeowners": []any{map[string]any{"pattern": "docs/", "owners": []any{}}}},
+			wantErr: true,
+		},
+		{
+			name:    "rule with invalid owner",
+			input:   map[string]any{"codeowners": map[string]any{"docs/": "bad user"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRepoConfig(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRepoConfig err=%v wantErr=%v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(got.codeowners, tt.wantOwners) {
+				t.Errorf("codeowners=%v want %v", got.codeowners, tt.wantOwners)
+			}
+			if !reflect.DeepEqual(got.codeownerRules, tt.wantRules) {
+				t.Errorf("codeownerRules=%+v want %+v", got.codeownerRules, tt.wantRules)
+			}
+		})
+	}
+}
+
+func TestResolveTemplate_CodeownerRulesMerged(t *testing.T) {
+	all := map[string]repoSettings{
+		"template-go-api": {
+			template: true,
+			codeownerRules: []codeownerRule{
+				{pattern: "/infra/", owners: []string{"@org/devops-team"}},
+				{pattern: "*.sql", owners: []string{"@org/dba"}},
+			},
+		},
+		"my-api": {
+			from: "template-go-api",
+			codeownerRules: []codeownerRule{
+				{pattern: "/api/", owners: []string{"octocat"}},
+				{pattern: "/infra/", owners: []string{"allanice001"}},
+			},
+		},
+	}
+	resolved, err := resolveTemplate("my-api", all["my-api"], all, "myorg")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []codeownerRule{
+		{pattern: "/infra/", owners: []string{"@org/devops-team", "allanice001"}},
+		{pattern: "*.sql", owners: []string{"@org/dba"}},
+		{pattern: "/api/", owners: []string{"octocat"}},
+	}
+	if !reflect.DeepEqual(resolved.codeownerRules, want) {
+		t.Errorf("codeownerRules=%+v want %+v", resolved.codeownerRules, want)
+	}
+}
+
+func TestCollectRepoSettings_CodeownersMergedAcrossTeams(t *testing.T) {
+	cfg := &config.Root{Team: []config.TeamConfig{
+		{Name: "Backend", Repositories: map[string]any{
+			"api": map[string]any{"codeowners": []any{"@org/backend", map[string]any{"pattern": "*.sql", "owners": "@org/dba"}}},
+		}},
+		{Name: "Platform", Repositories: map[string]any{
+			"api": map[string]any{"codeowners": map[string]any{"/infra/": "@org/platform", "*.sql": "@org/platform"}},
+		}},
+	}}
+	all, _, err := collectRepoSettings(cfg, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := all["api"]
+	if !reflect.DeepEqual(got.codeowners, []string{"@org/backend"}) {
+		t.Errorf("codeowners=%v", got.codeowners)
+	}
+	want := []codeownerRule{
+		{pattern: "*.sql", owners: []string{"@org/dba", "@org/platform"}},
+		{pattern: "/infra/", owners: []string{"@org/platform"}},
+	}
+	if !reflect.DeepEqual(got.codeownerRules, want) {
+		t.Errorf("codeownerRules=%+v want %+v", got.codeownerRules, want)
+	}
+}
@@ -0,0 +1,110 @@
+package templates
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Marker text delimiting the gomgr-managed section of a block-mode file. It is
+// wrapped in comment syntax by blockMarkers, and only a line equal to that
+// full marker counts, so prose that merely mentions it is left alone.
+const (
+	blockBegin = "BEGIN gomgr"
+	blockEnd   = "END gomgr"
+)
+
+// blockMarkers returns the begin/end marker lines for a file, wrapped in the
+// comment syntax its extension implies. Unknown extensions (CODEOWNERS,
+// .gitignore, shell, YAML) get '#' comments.
+func blockMarkers(filePath string) (begin, end string) {
+	switch strings.ToLower(path.Ext(filePath)) {
+	case ".md", ".markdown", ".html", ".htm", ".xml":
+		return "<!-- " + blockBegin + " -->", "<!-- " + blockEnd + " -->"
+	default:
+		return "# " + blockBegin, "# " + blockEnd
+	}
+}
+
+// RenderBlock wraps body in begin/end markers suitable for filePath.
+func RenderBlock(filePath, body string) string {
+	begin, end := blockMarkers(filePath)
+	if body != "" && !strings.HasSuffix(body, "\n") {
+		body += "\n"
+	}
+	return begin + "\n" + body + end + "\n"
+}
+
+// findBlock returns the byte offsets of the managed block within content:
+// start is the beginning of the begin-marker line and stop is just past the
+// end-marker line (including its newline, if any). found is false when no
+// begin marker exists. Marker lines must equal the markers for filePath,
+// ignoring only the line ending. A begin marker without a matching end
+// marker, or a second block, is an error — splicing would risk eating
+// human-owned text.
+func findBlock(content, filePath string) (start, stop int, found bool, err error) {
+	begin, end := blockMarkers(filePath)
+	offset := 0
+	start = -1
+	for line := range strings.SplitAfterSeq(content, "\n") {
+		lineEnd := offset + len(line)
+		switch strings.TrimRight(line, "\r\n") {
+		case begin:
+			if start >= 0 || found {
+				return 0, 0, false, fmt.Errorf("multiple %q markers", begin)
+			}
+			start = offset
+		case end:
+			if start < 0 {
+				return 0, 0, false, fmt.Errorf("%q marker without preceding %q", end, begin)
+			}
+			if !found {
+				stop = lineEnd
+				found = true
+			}
+		}
+		offset = lineEnd
+	}
+	if start >= 0 && !found {
+		return 0, 0, false, fmt.Errorf("%q marker without matching %q", begin, end)
+	}
+	return start, stop, found, nil
+}
+
+// ExtractBlock returns the managed block (markers included) from content, or
+// "" when the file has no block yet.
+func ExtractBlock(content, filePath string) (string, error) {
+	start, stop, found, err := findBlock(content, filePath)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", filePath, err)
+	}
+	if !found {
+		return "", nil
+	}
+	return content[start:stop], nil
+}
+
+// SpliceBlock returns existing with its managed block replaced by body. When
+// existing has no block, one is appended at the end, separated from any
+// existing text by a newline. Text outside the markers is never touched.
+func SpliceBlock(existing, filePath, body string) (string, error) {
+	block := RenderBlock(filePath, body)
+	start, stop, found, err := findBlock(existing, filePath)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", filePath, err)
+	}
+	if !found {
+		if existing == "" {
+			return block, nil
+		}
+		if !strings.HasSuffix(existing, "\n") {
+			existing += "\n"
+		}
+		return existing + "\n" + block, nil
+	}
+	// Preserve a file that ended on the end marker without a trailing newline.
+	if !strings.HasSuffix(existing[start:stop], "\n") {
+		block = strings.TrimSuffix(block, "\n")
+	}
+	return existing[:start] + block + existing[stop:], nil
+}
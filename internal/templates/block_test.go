@@ -0,0 +1,117 @@
+package templates
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderBlock_CommentSyntaxByExtension(t *testing.T) {
+	got := RenderBlock(".github/CODEOWNERS", "* @org/platform")
+	want := "# BEGIN gomgr\n* @org/platform\n# END gomgr\n"
+	if got != want {
+		t.Errorf("CODEOWNERS block: got %q, want %q", got, want)
+	}
+	got = RenderBlock("README.md", "badge\n")
+	want = "<!-- BEGIN gomgr -->\nbadge\n<!-- END gomgr -->\n"
+	if got != want {
+		t.Errorf("README block: got %q, want %q", got, want)
+	}
+}
+
+func TestSpliceBlock(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		body     string
+		want     string
+	}{
+		{
+			name:     "empty file gets just the block",
+			existing: "",
+			body:     "node_modules/\n",
+			want:     "# BEGIN gomgr\nnode_modules/\n# END gomgr\n",
+		},
+		{
+			name:     "missing block is appended",
+			existing: "*.log",
+			body:     "node_modules/\n",
+			want:     "*.log\n\n# BEGIN gomgr\nnode_modules/\n# END gomgr\n",
+		},
+		{
+			name:     "existing block is replaced and surroundings kept",
+			existing: "top\n# BEGIN gomgr\nold\nstuff\n# END gomgr\nbottom\n",
+			body:     "new\n",
+			want:     "top\n# BEGIN gomgr\nnew\n# END gomgr\nbottom\n",
+		},
+		{
+			name:     "end marker at EOF without newline",
+			existing: "top\n# BEGIN gomgr\nold\n# END gomgr",
+			body:     "new\n",
+			want:     "top\n# BEGIN gomgr\nnew\n# END gomgr",
+		},
+		{
+			name:     "in-sync block is a fixed point",
+			existing: "mine\n# BEGIN gomgr\nsame\n# END gomgr\nalso mine\n",
+			body:     "same\n",
+			want:     "mine\n# BEGIN gomgr\nsame\n# END gomgr\nalso mine\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SpliceBlock(tt.existing, ".gitignore", tt.body)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpliceBlock_MalformedMarkers(t *testing.T) {
+	for _, existing := range []string{
+		"# BEGIN gomgr\nno end\n",
+		"# END gomgr\n",
+		"# BEGIN gomgr\na\n# END gomgr\n# BEGIN gomgr\nb\n# END gomgr\n",
+	} {
+		if _, err := SpliceBlock(existing, ".gitignore", "x\n"); err == nil {
+			t.Errorf("expected error for %q", existing)
+		}
+	}
+}
+
+func TestSpliceBlock_IgnoresMarkerMentions(t *testing.T) {
+	existing := "See # BEGIN gomgr below.\n# END gomgr is ours too\n"
+	got, err := SpliceBlock(existing, ".gitignore", "x\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := existing + "\n# BEGIN gomgr\nx\n# END gomgr\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// A '#' marker in a Markdown file is prose, not the block.
+	existing = "# BEGIN gomgr\ntext\n"
+	if got, err = SpliceBlock(existing, "README.md", "x\n"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(got, existing+"\n<!-- BEGIN gomgr -->\n") {
+		t.Errorf("expected appended block after untouched prose, got %q", got)
+	}
+}
+
+func TestExtractBlock(t *testing.T) {
+	got, err := ExtractBlock("a\n# BEGIN gomgr\r\nb\n# END gomgr\nc\n", ".gitignore")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(got, "# BEGIN gomgr") || !strings.HasSuffix(got, "# END gomgr\n") {
+		t.Errorf("unexpected block %q", got)
+	}
+	got, err = ExtractBlock("no markers\n", ".gitignore")
+	if err != nil || got != "" {
+		t.Errorf("expected empty block without error, got %q, %v", got, err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"path"
+	"strings"
 	"text/template"
 
 	"github.com/DragonSecurity/gomgr/internal/config"
@@ -17,8 +18,11 @@ type FileData struct {
 
 // RenderFile executes spec.Content as a text/template and returns the result.
 // Template errors are wrapped with the file's path so operators can trace the
-// offending entry.
+// offending entry. Raw specs are returned verbatim, byte for byte.
 func RenderFile(spec config.FileSpec, data FileData) (string, error) {
+	if spec.Raw {
+		return spec.Content, nil
+	}
 	tmpl, err := template.New(spec.Path).Option("missingkey=error").Parse(spec.Content)
 	if err != nil {
 		return "", fmt.Errorf("parse template for %s: %w", spec.Path, err)
@@ -30,15 +34,82 @@ func RenderFile(spec config.FileSpec, data FileData) (string, error) {
 	return buf.String(), nil
 }
 
-// MatchesRepo reports whether a FileSpec applies to the named repository.
-// An empty Only list matches every repo; otherwise any single glob match
-// (path.Match semantics) is sufficient.
-func MatchesRepo(spec config.FileSpec, repo string) bool {
-	if len(spec.Only) == 0 {
-		return true
+// RepoInfo describes a managed repository as resolved from config: the
+// attributes FileSpec.Match criteria are evaluated against.
+type RepoInfo struct {
+	Name       string
+	Visibility string   // public, private or internal; never empty
+	Topics     []string // desired topics, template inheritance applied
+	Teams      []string // slugs of every team granted access in config
+	Template   bool
+
+	// DefaultBranch is the repo's default branch as reported by GitHub, or
+	// empty when the repo does not exist yet.
+	DefaultBranch string
+}
+
+// MatchesRepo reports whether a FileSpec applies to the given repository.
+// Every configured selector must agree: the name must match one of the Only
+// globs (an empty Only matches every repo) and none of the Exclude globs
+// (path.Match semantics), and the repo must satisfy each Match criterion.
+func MatchesRepo(spec config.FileSpec, repo RepoInfo) bool {
+	if len(spec.Only) > 0 && !matchesAnyGlob(spec.Only, repo.Name) {
+		return false
+	}
+	if matchesAnyGlob(spec.Exclude, repo.Name) {
+		return false
+	}
+	if spec.Match != nil && !matchesCriteria(*spec.Match, repo) {
+		return false
+	}
+	return true
+}
+
+func matchesAnyGlob(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesCriteria evaluates attribute selectors. Within a list any value may
+// match (topics_all excepted); across fields all set criteria must hold.
+// Topic and team comparisons are case-insensitive.
+func matchesCriteria(m config.FileMatch, repo RepoInfo) bool {
+	if len(m.Visibility) > 0 && !containsFold(m.Visibility, repo.Visibility) {
+		return false
+	}
+	if len(m.TopicsAny) > 0 && !anyContained(m.TopicsAny, repo.Topics) {
+		return false
+	}
+	for _, topic := range m.TopicsAll {
+		if !containsFold(repo.Topics, topic) {
+			return false
+		}
+	}
+	if len(m.Teams) > 0 && !anyContained(m.Teams, repo.Teams) {
+		return false
+	}
+	if m.Template != nil && *m.Template != repo.Template {
+		return false
+	}
+	return true
+}
+
+func containsFold(list []string, v string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, v) {
+			return true
+		}
 	}
-	for _, pattern := range spec.Only {
-		if ok, _ := path.Match(pattern, repo); ok {
+	return false
+}
+
+func anyContained(want, have []string) bool {
+	for _, w := range want {
+		if containsFold(have, w) {
 			return true
 		}
 	}
@@ -52,6 +123,5 @@ func DefaultReadmeSpec() config.FileSpec {
 		Path:    "README.md",
 		Content: readmeTemplate,
 		Message: "chore: add default README",
-		Branch:  "main", // legacy default branch
 	}
 }
@@ -62,13 +62,49 @@ func TestMatchesRepo(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			spec := config.FileSpec{Path: "f", Content: "c", Only: tt.only}
-			if got := MatchesRepo(spec, tt.repo); got != tt.expected {
+			if got := MatchesRepo(spec, RepoInfo{Name: tt.repo}); got != tt.expected {
 				t.Errorf("MatchesRepo(%v, %q) = %v, want %v", tt.only, tt.repo, got, tt.expected)
 			}
 		})
 	}
 }
 
+func TestMatchesRepo_ExcludeAndCriteria(t *testing.T) {
+	yes, no := true, false
+	repo := RepoInfo{
+		Name:       "public-docs",
+		Visibility: "public",
+		Topics:     []string{"docs", "go"},
+		Teams:      []string{"platform"},
+	}
+	tests := []struct {
+		name     string
+		spec     config.FileSpec
+		expected bool
+	}{
+		{"exclude glob wins over only", config.FileSpec{Only: []string{"public-*"}, Exclude: []string{"*-docs"}}, false},
+		{"exclude no match", config.FileSpec{Exclude: []string{"legacy-*"}}, true},
+		{"visibility match", config.FileSpec{Match: &config.FileMatch{Visibility: []string{"public", "internal"}}}, true},
+		{"visibility mismatch", config.FileSpec{Match: &config.FileMatch{Visibility: []string{"private"}}}, false},
+		{"topics_any", config.FileSpec{Match: &config.FileMatch{TopicsAny: []string{"rust", "go"}}}, true},
+		{"topics_any none", config.FileSpec{Match: &config.FileMatch{TopicsAny: []string{"rust"}}}, false},
+		{"topics_all", config.FileSpec{Match: &config.FileMatch{TopicsAll: []string{"docs", "go"}}}, true},
+		{"topics_all missing one", config.FileSpec{Match: &config.FileMatch{TopicsAll: []string{"docs", "rust"}}}, false},
+		{"teams", config.FileSpec{Match: &config.FileMatch{Teams: []string{"Platform"}}}, true},
+		{"teams mismatch", config.FileSpec{Match: &config.FileMatch{Teams: []string{"backend"}}}, false},
+		{"template false", config.FileSpec{Match: &config.FileMatch{Template: &no}}, true},
+		{"template true", config.FileSpec{Match: &config.FileMatch{Template: &yes}}, false},
+		{"all criteria must hold", config.FileSpec{Match: &config.FileMatch{Visibility: []string{"public"}, Teams: []string{"backend"}}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchesRepo(tt.spec, repo); got != tt.expected {
+				t.Errorf("MatchesRepo() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
 func TestDefaultReadmeSpec_RendersBuiltInTemplate(t *testing.T) {
 	spec := DefaultReadmeSpec()
 	if spec.Path != "README.md" {
@@ -85,3 +121,15 @@ func TestDefaultReadmeSpec_RendersBuiltInTemplate(t *testing.T) {
 		t.Errorf("expected rendered clone URL, got %q", out)
 	}
 }
+
+func TestRenderFile_RawSkipsTemplating(t *testing.T) {
+	content := "name: ci\nrun: echo ${{ github.sha }}\n\x89PNG\x00"
+	spec := config.FileSpec{Path: "asset", Content: content, Raw: true}
+	got, err := RenderFile(spec, FileData{Org: "o", Repo: "r"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != content {
+		t.Errorf("expected raw content verbatim, got %q", got)
+	}
+}
@@ -0,0 +1,133 @@
+package templates
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/DragonSecurity/gomgr/internal/config"
+)
+
+// MergeStructured deep-merges the rendered document desired into existing
+// and returns the canonically formatted result. format is config.MergeJSON or
+// config.MergeYAML; arrays is config.MergeArraysReplace (the default when
+// empty) or config.MergeArraysUnion.
+//
+// Keys present in desired win; keys only present in existing are preserved,
+// so repos can carry local additions alongside gomgr-owned settings. changed
+// reports whether the merged document differs semantically from existing —
+// reformatting alone is never a reason to commit. An empty existing is
+// treated as an empty document so the same call renders a brand new file.
+func MergeStructured(existing, desired, format, arrays string) (merged string, changed bool, err error) {
+	want, err := decodeStructured(desired, format)
+	if err != nil {
+		return "", false, fmt.Errorf("parse rendered content as %s: %w", format, err)
+	}
+	var have any
+	if strings.TrimSpace(existing) != "" {
+		have, err = decodeStructured(existing, format)
+		if err != nil {
+			return "", false, fmt.Errorf("parse existing content as %s: %w", format, err)
+		}
+	}
+	result := deepMerge(have, want, arrays == config.MergeArraysUnion)
+	out, err := encodeStructured(result, format)
+	if err != nil {
+		return "", false, err
+	}
+	return out, have == nil || !reflect.DeepEqual(have, result), nil
+}
+
+func decodeStructured(s, format string) (any, error) {
+	var v any
+	switch format {
+	case config.MergeJSON:
+		dec := json.NewDecoder(strings.NewReader(s))
+		dec.UseNumber()
+		if err := dec.Decode(&v); err != nil {
+			return nil, err
+		}
+	case config.MergeYAML:
+		if err := yaml.Unmarshal([]byte(s), &v); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported merge format %q", format)
+	}
+	return v, nil
+}
+
+// encodeStructured renders v with two-space indentation, sorted map keys and
+// a trailing newline — the same bytes for the same document on every run.
+func encodeStructured(v any, format string) (string, error) {
+	var buf bytes.Buffer
+	switch format {
+	case config.MergeJSON:
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(v); err != nil {
+			return "", fmt.Errorf("encode json: %w", err)
+		}
+	case config.MergeYAML:
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(v); err != nil {
+			return "", fmt.Errorf("encode yaml: %w", err)
+		}
+		if err := enc.Close(); err != nil {
+			return "", fmt.Errorf("encode yaml: %w", err)
+		}
+	default:
+		return "", fmt.Errorf("unsupported merge format %q", format)
+	}
+	return buf.String(), nil
+}
+
+// deepMerge overlays want onto have. Objects merge key by key; arrays are
+// replaced by want unless union is set, in which case want's elements not
+// already present in have are appended; any other value is replaced.
+func deepMerge(have, want any, union bool) any {
+	switch w := want.(type) {
+	case map[string]any:
+		h, ok := have.(map[string]any)
+		if !ok {
+			return w
+		}
+		out := make(map[string]any, len(h)+len(w))
+		for k, v := range h {
+			out[k] = v
+		}
+		for k, v := range w {
+			out[k] = deepMerge(h[k], v, union)
+		}
+		return out
+	case []any:
+		h, ok := have.([]any)
+		if !union || !ok {
+			return w
+		}
+		out := append([]any{}, h...)
+		for _, item := range w {
+			if !containsValue(out, item) {
+				out = append(out, item)
+			}
+		}
+		return out
+	default:
+		return want
+	}
+}
+
+func containsValue(list []any, v any) bool {
+	for _, item := range list {
+		if reflect.DeepEqual(item, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package templates
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DragonSecurity/gomgr/internal/config"
+)
+
+func TestMergeStructured_JSONPreservesUnknownKeys(t *testing.T) {
+	existing := `{"extends": ["local"], "labels": ["deps"], "packageRules": [{"matchPackageNames": ["x"]}]}`
+	desired := `{"$schema": "https://docs.renovatebot.com/renovate-schema.json", "extends": ["github>org/presets"]}`
+
+	got, changed, err := MergeStructured(existing, desired, config.MergeJSON, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !changed {
+		t.Error("expected changed=true")
+	}
+	want := `{
+  "$schema": "https://docs.renovatebot.com/renovate-schema.json",
+  "extends": [
+    "github>org/presets"
+  ],
+  "labels": [
+    "deps"
+  ],
+  "packageRules": [
+    {
+      "matchPackageNames": [
+        "x"
+      ]
+    }
+  ]
+}
+`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMergeStructured_ArrayUnion(t *testing.T) {
+	got, _, err := MergeStructured(`{"extends": ["local", "shared"]}`, `{"extends": ["shared", "org"]}`, config.MergeJSON, config.MergeArraysUnion)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(got, `"local",`) || !strings.Contains(got, `"org"`) || strings.Count(got, `"shared"`) != 1 {
+		t.Errorf("expected union of arrays without duplicates, got:\n%s", got)
+	}
+}
+
+func TestMergeStructured_NestedObjects(t *testing.T) {
+	got, _, err := MergeStructured("a:\n  keep: 1\n  set: old\n", "a:\n  set: new\n", config.MergeYAML, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "a:\n  keep: 1\n  set: new\n" {
+		t.Errorf("unexpected merge result %q", got)
+	}
+}
+
+func TestMergeStructured_UnchangedIgnoresFormatting(t *testing.T) {
+	_, changed, err := MergeStructured(`{"b":1,"a":[1, 2]}`, `{"a": [1,2]}`, config.MergeJSON, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if changed {
+		t.Error("expected changed=false for a semantically identical document")
+	}
+}
+
+func TestMergeStructured_EmptyExistingRendersNewFile(t *testing.T) {
+	got, changed, err := MergeStructured("", `{"a":1}`, config.MergeJSON, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !changed || got != "{\n  \"a\": 1\n}\n" {
+		t.Errorf("expected canonical new file, got %q (changed=%v)", got, changed)
+	}
+}
+
+func TestMergeStructured_InvalidInput(t *testing.T) {
+	if _, _, err := MergeStructured(`{}`, `{not json`, config.MergeJSON, ""); err == nil {
+		t.Error("expected error for invalid rendered content")
+	}
+	if _, _, err := MergeStructured(`{broken`, `{}`, config.MergeJSON, ""); err == nil {
+		t.Error("expected error for invalid existing content")
+	}
+}
@@ -0,0 +1,142 @@
+// Package tracing wires gomgr into OpenTelemetry. Setup installs a global
+// tracer provider that exports spans over OTLP/HTTP or to a JSON-lines
+// file; without it every span is a no-op, so instrumented code pays next to
+// nothing when tracing is off.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/DragonSecurity/gomgr/internal/version"
+)
+
+// Exporters accepted by Options.Exporter and OTEL_TRACES_EXPORTER.
+const (
+	ExporterNone = "none"
+	ExporterOTLP = "otlp"
+	ExporterFile = "file"
+)
+
+const instrumentationName = "github.com/DragonSecurity/gomgr"
+
+// Options selects where spans go.
+type Options struct {
+	// Exporter is none, otlp or file. Empty falls back to the standard
+	// OTEL_TRACES_EXPORTER variable, then to file when File is set, then to
+	// none.
+	Exporter string
+	// File is the JSON-lines output of the file exporter.
+	File string
+}
+
+// Setup installs the tracer provider selected by opts and returns a function
+// that flushes and stops it; call it before the process exits. The OTLP
+// exporter is configured by the standard OTEL_EXPORTER_OTLP_* variables
+// (endpoint, headers, timeout, TLS) and OTEL_SERVICE_NAME and
+// OTEL_RESOURCE_ATTRIBUTES are honoured.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	noop := func(context.Context) error { return nil }
+
+	exporter := opts.Exporter
+	if exporter == "" {
+		exporter = os.Getenv("OTEL_TRACES_EXPORTER")
+	}
+	if exporter == "" && opts.File != "" {
+		exporter = ExporterFile
+	}
+
+	var (
+		exp    sdktrace.SpanExporter
+		closer func() error
+	)
+	switch exporter {
+	case "", ExporterNone:
+		return noop, nil
+	case ExporterOTLP:
+		if p := otlpProtocol(); p != "" && p != "http/protobuf" {
+			return nil, fmt.Errorf("tracing: OTLP protocol %q is not supported (use http/protobuf)", p)
+		}
+		e, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("tracing: otlp exporter: %w", err)
+		}
+		exp = e
+	case ExporterFile:
+		if opts.File == "" {
+			return nil, errors.New("tracing: --trace-file is required for the file exporter")
+		}
+		f, err := os.OpenFile(filepath.Clean(opts.File), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("tracing: open trace file: %w", err)
+		}
+		e, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("tracing: file exporter: %w", err)
+		}
+		exp, closer = e, f.Close
+	default:
+		return nil, fmt.Errorf("tracing: unknown exporter %q (must be none, otlp or file)", exporter)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		semconv.ServiceName("gomgr"),
+		semconv.ServiceVersion(version.GetBuildInfo().Version),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("tracing: resource: %w", err)
+	}
+	// resource.Default reads OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES;
+	// merge it last so the environment overrides the built-in name.
+	if env, err := resource.New(ctx, resource.WithFromEnv()); err == nil {
+		if merged, err := resource.Merge(res, env); err == nil {
+			res = merged
+		}
+	}
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	return func(ctx context.Context) error {
+		err := tp.Shutdown(ctx)
+		if closer != nil {
+			err = errors.Join(err, closer())
+		}
+		return err
+	}, nil
+}
+
+// otlpProtocol returns the configured OTLP protocol for traces, if any.
+func otlpProtocol() string {
+	if p := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL"); p != "" {
+		return p
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+}
+
+// Start begins a span named name as a child of any span in ctx.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records err (if any) on span and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
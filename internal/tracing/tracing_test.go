@@ -0,0 +1,85 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+)
+
+func TestSetup_FileExporter(t *testing.T) {
+	prev := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(prev)
+	t.Setenv("OTEL_TRACES_EXPORTER", "")
+
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	shutdown, err := Setup(context.Background(), Options{File: path})
+	if err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+	ctx, parent := Start(context.Background(), "parent")
+	_, child := Start(ctx, "child")
+	End(child, errors.New("boom"))
+	End(parent, nil)
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected one JSON line per span, got %d:\n%s", len(lines), b)
+	}
+	for _, want := range []string{`"Name":"child"`, `"Name":"parent"`, `"Description":"boom"`, `"Value":"gomgr"`} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("trace file missing %s:\n%s", want, b)
+		}
+	}
+}
+
+func TestSetup_Selection(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       map[string]string
+		opts      Options
+		errSubstr string
+	}{
+		{name: "disabled by default"},
+		{name: "explicit none", opts: Options{Exporter: ExporterNone, File: "ignored"}},
+		{name: "unknown exporter", opts: Options{Exporter: "jaeger"}, errSubstr: "unknown exporter"},
+		{name: "unknown exporter from env", env: map[string]string{"OTEL_TRACES_EXPORTER": "zipkin"}, errSubstr: "unknown exporter"},
+		{name: "file without path", opts: Options{Exporter: ExporterFile}, errSubstr: "--trace-file"},
+		{name: "grpc not supported", opts: Options{Exporter: ExporterOTLP},
+			env: map[string]string{"OTEL_EXPORTER_OTLP_PROTOCOL": "grpc"}, errSubstr: "not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OTEL_TRACES_EXPORTER", "")
+			t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "")
+			t.Setenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", "")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			shutdown, err := Setup(context.Background(), tt.opts)
+			if tt.errSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errSubstr) {
+					t.Fatalf("expected error containing %q, got %v", tt.errSubstr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Setup: %v", err)
+			}
+			if err := shutdown(context.Background()); err != nil {
+				t.Fatalf("shutdown: %v", err)
+			}
+		})
+	}
+}
@@ -18,6 +18,9 @@ type StateStats struct {
 	Repositories    StatePair `json:"repositories"`
 	RepoPermissions StatePair `json:"repo_permissions"`
 	CustomRoles     StatePair `json:"custom_roles"`
+	// Ignored counts unmanaged resources the ignore patterns kept out of
+	// cleanups.
+	Ignored int `json:"ignored,omitempty"`
 }
 
 type StatePair struct {
@@ -99,6 +102,9 @@ func PrintSummary(p Plan) {
 		printStatePair("Repositories:", p.Stats.Repositories)
 		printStatePair("Repo Permissions:", p.Stats.RepoPermissions)
 		printStatePair("Custom Roles:", p.Stats.CustomRoles)
+		if p.Stats.Ignored > 0 {
+			fmt.Printf("  %-20s %d\n", "Ignored:", p.Stats.Ignored)
+		}
 		fmt.Println()
 	}
 
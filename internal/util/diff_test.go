@@ -213,6 +213,16 @@ func TestPrintSummary(t *testing.T) {
 				"Total changes: 2",
 			},
 		},
+		{
+			name: "with ignored resources",
+			plan: Plan{
+				Stats: &StateStats{Teams: StatePair{Current: 2, Desired: 2}, Ignored: 4},
+			},
+			expectedContains: []string{
+				"Ignored:",
+				"No changes required - configuration is in sync",
+			},
+		},
 	}
 
 	for _, tt := range tests {
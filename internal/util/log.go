@@ -2,24 +2,22 @@ package util
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
 	"sync"
-	"time"
 )
 
-// AuditLog controls whether structured audit log entries are emitted to stderr.
-var AuditLog bool
-
 var (
 	levelVar   = new(slog.LevelVar)
 	showSource bool
-	logger     = slog.New(newSimpleHandler(os.Stdout, levelVar))
+	logger     = slog.New(newSimpleHandler(nil, nil, levelVar))
 )
 
 // Logger returns the package-level structured logger.
@@ -33,17 +31,107 @@ func EnableDebug() {
 	slog.SetDefault(logger)
 }
 
-// simpleHandler renders slog records as plain text without the key=value
-// prefix slog.TextHandler produces. Info records are emitted as bare messages
-// so CLI output stays readable; warn/error/debug get a short label.
+// Log formats accepted by LogOptions.Format.
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// LogOptions configures the package logger; see ConfigureLogging.
+type LogOptions struct {
+	// Format is LogFormatText (the default) or LogFormatJSON.
+	Format string
+	// Level is debug, info (the default), warn or error.
+	Level string
+	// File, when set, receives every record in addition to the console:
+	// JSON with LogFormatJSON, otherwise slog's text format with a time and
+	// level on every line. The file is appended to, never truncated.
+	File string
+}
+
+// ConfigureLogging replaces the package logger according to opts. Text
+// output goes to stdout (warnings and errors to stderr) exactly as before;
+// JSON output goes to stderr so it never interleaves with a plan printed on
+// stdout. The returned closer releases the log file and must be called once
+// logging is done; it is a no-op when no file was opened.
+func ConfigureLogging(opts LogOptions) (io.Closer, error) {
+	level, err := ParseLogLevel(opts.Level)
+	if err != nil {
+		return nil, err
+	}
+	var console slog.Handler
+	switch opts.Format {
+	case "", LogFormatText:
+		console = newSimpleHandler(nil, nil, levelVar)
+	case LogFormatJSON:
+		console = newJSONHandler(os.Stderr)
+	default:
+		return nil, fmt.Errorf("invalid log format %q (must be text or json)", opts.Format)
+	}
+
+	var closer io.Closer = nopCloser{}
+	handler := console
+	if opts.File != "" {
+		f, err := os.OpenFile(opts.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("open log file: %w", err)
+		}
+		var file slog.Handler = slog.NewTextHandler(f, &slog.HandlerOptions{Level: levelVar, AddSource: showSource})
+		if opts.Format == LogFormatJSON {
+			file = newJSONHandler(f)
+		}
+		handler = fanoutHandler{console, file}
+		closer = f
+	}
+
+	levelVar.Set(level)
+	logger = slog.New(handler)
+	slog.SetDefault(logger)
+	return closer, nil
+}
+
+// ParseLogLevel maps a --log-level value to a slog level. Empty means info.
+func ParseLogLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("invalid log level %q (must be debug, info, warn or error)", s)
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+func newJSONHandler(out io.Writer) slog.Handler {
+	return slog.NewJSONHandler(out, &slog.HandlerOptions{Level: levelVar, AddSource: showSource})
+}
+
+// simpleHandler renders slog records as plain text without the time/level
+// key=value prefix slog.TextHandler produces. Info records are emitted as bare
+// messages so CLI output stays readable; warn/error/debug get a short label.
+// Attributes follow the message as key=value pairs.
+//
+// A nil out or errOut resolves to os.Stdout/os.Stderr at write time, so
+// callers that redirect the standard streams (tests, mostly) still capture
+// console output.
 type simpleHandler struct {
-	out   io.Writer
-	level slog.Leveler
-	mu    sync.Mutex
+	out    io.Writer // debug and info
+	errOut io.Writer // warn and error
+	level  slog.Leveler
+	mu     *sync.Mutex
+	attrs  []slog.Attr // pre-qualified with any group prefix
+	group  string      // dotted prefix applied to record attrs
 }
 
-func newSimpleHandler(out io.Writer, level slog.Leveler) *simpleHandler {
-	return &simpleHandler{out: out, level: level}
+func newSimpleHandler(out, errOut io.Writer, level slog.Leveler) *simpleHandler {
+	return &simpleHandler{out: out, errOut: errOut, level: level, mu: &sync.Mutex{}}
 }
 
 func (h *simpleHandler) Enabled(_ context.Context, l slog.Level) bool {
@@ -52,31 +140,136 @@ func (h *simpleHandler) Enabled(_ context.Context, l slog.Level) bool {
 
 func (h *simpleHandler) Handle(_ context.Context, r slog.Record) error {
 	var prefix string
-	switch r.Level {
-	case slog.LevelDebug:
-		prefix = "DEBUG: "
-	case slog.LevelWarn:
-		prefix = "WARN: "
-	case slog.LevelError:
+	out := h.out
+	switch {
+	case r.Level >= slog.LevelError:
 		prefix = "ERROR: "
+		out = h.errOut
+	case r.Level >= slog.LevelWarn:
+		prefix = "WARNING: "
+		out = h.errOut
+	case r.Level < slog.LevelInfo:
+		prefix = "DEBUG: "
+	}
+	if out == nil {
+		out = os.Stdout
+		if r.Level >= slog.LevelWarn {
+			out = os.Stderr
+		}
 	}
 
-	var suffix string
+	var b strings.Builder
+	b.WriteString(prefix)
+	b.WriteString(r.Message)
+	for _, a := range h.attrs {
+		appendAttr(&b, "", a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		appendAttr(&b, h.group, a)
+		return true
+	})
 	if showSource && r.PC != 0 {
 		frames := runtime.CallersFrames([]uintptr{r.PC})
 		if frame, _ := frames.Next(); frame.File != "" {
-			suffix = fmt.Sprintf(" (%s:%d)", filepath.Base(frame.File), frame.Line)
+			fmt.Fprintf(&b, " (%s:%d)", filepath.Base(frame.File), frame.Line)
 		}
 	}
 
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	_, err := fmt.Fprintln(h.out, prefix+r.Message+suffix)
+	_, err := fmt.Fprintln(out, b.String())
 	return err
 }
 
-func (h *simpleHandler) WithAttrs(_ []slog.Attr) slog.Handler { return h }
-func (h *simpleHandler) WithGroup(_ string) slog.Handler      { return h }
+// appendAttr writes " key=value", flattening groups into dotted keys and
+// quoting values that contain spaces or quotes.
+func appendAttr(b *strings.Builder, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			appendAttr(b, prefix, ga)
+		}
+		return
+	}
+	v := a.Value.String()
+	if v == "" || strings.ContainsAny(v, " \t\n\"=") {
+		v = strconv.Quote(v)
+	}
+	b.WriteString(" ")
+	b.WriteString(prefix + a.Key)
+	b.WriteString("=")
+	b.WriteString(v)
+}
+
+func (h *simpleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := *h
+	h2.attrs = append([]slog.Attr{}, h.attrs...)
+	for _, a := range attrs {
+		if h.group != "" {
+			a.Key = h.group + a.Key
+		}
+		h2.attrs = append(h2.attrs, a)
+	}
+	return &h2
+}
+
+func (h *simpleHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.group = h.group + name + "."
+	return &h2
+}
+
+// fanoutHandler sends every record to each handler that accepts its level.
+type fanoutHandler []slog.Handler
+
+func (f fanoutHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	for _, h := range f {
+		if h.Enabled(ctx, l) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f fanoutHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range f {
+		if h.Enabled(ctx, r.Level) {
+			if err := h.Handle(ctx, r.Clone()); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f fanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make(fanoutHandler, len(f))
+	for i, h := range f {
+		out[i] = h.WithAttrs(attrs)
+	}
+	return out
+}
+
+func (f fanoutHandler) WithGroup(name string) slog.Handler {
+	out := make(fanoutHandler, len(f))
+	for i, h := range f {
+		out[i] = h.WithGroup(name)
+	}
+	return out
+}
 
 // Infof emits a formatted info-level log line via slog.
 func Infof(format string, args ...any) {
@@ -88,27 +281,8 @@ func Debugf(format string, args ...any) {
 	logger.Debug(fmt.Sprintf(format, args...))
 }
 
-// Warnf prints a warning message to stderr.
+// Warnf emits a formatted warn-level log line via slog. With the text format
+// it is printed to stderr with a WARNING: prefix.
 func Warnf(format string, v ...any) {
-	fmt.Fprintf(os.Stderr, "WARNING: "+format+"\n", v...)
-}
-
-// Audit emits a structured JSON audit log entry to stderr when AuditLog is enabled.
-func Audit(scope, target, action, status string) {
-	if !AuditLog {
-		return
-	}
-	entry := map[string]string{
-		"ts":     time.Now().UTC().Format(time.RFC3339),
-		"scope":  scope,
-		"target": target,
-		"action": action,
-		"status": status,
-	}
-	b, err := json.Marshal(entry)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "audit marshal error: %v\n", err)
-		return
-	}
-	fmt.Fprintln(os.Stderr, string(b))
+	logger.Warn(fmt.Sprintf(format, v...))
 }
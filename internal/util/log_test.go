@@ -7,6 +7,7 @@ import (
 	"io"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -33,73 +34,124 @@ func TestWarnf(t *testing.T) {
 	}
 }
 
-func TestAudit_Enabled(t *testing.T) {
-	oldVal := AuditLog
-	AuditLog = true
-	defer func() { AuditLog = oldVal }()
+func TestEnableDebug(t *testing.T) {
+	oldLevel := levelVar.Level()
+	defer levelVar.Set(oldLevel)
 
-	old := os.Stderr
-	r, w, _ := os.Pipe()
-	os.Stderr = w
+	EnableDebug()
 
-	Audit("team", "backend", "create", "ok")
+	if !Logger().Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("expected debug level enabled after EnableDebug")
+	}
+}
 
-	w.Close()
-	os.Stderr = old
+func TestSimpleHandler_KeepsAttrs(t *testing.T) {
+	defer withoutSource()()
+	var out bytes.Buffer
+	l := slog.New(newSimpleHandler(&out, &out, levelVar)).With("run", "r1").WithGroup("change")
+	l.Info("applied", "scope", "team", slog.Group("gh", "request_id", "ABC"), "msg", "two words")
 
-	var buf bytes.Buffer
-	_, _ = io.Copy(&buf, r)
-	output := strings.TrimSpace(buf.String())
+	want := `applied run=r1 change.scope=team change.gh.request_id=ABC change.msg="two words"`
+	if got := strings.TrimSpace(out.String()); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSimpleHandler_WarnGoesToErrOut(t *testing.T) {
+	defer withoutSource()()
+	var out, errOut bytes.Buffer
+	l := slog.New(newSimpleHandler(&out, &errOut, levelVar))
+	l.Warn("careful", "n", 2)
 
-	var entry map[string]string
-	if err := json.Unmarshal([]byte(output), &entry); err != nil {
-		t.Fatalf("expected valid JSON, got error: %v\nOutput: %s", err, output)
+	if out.Len() != 0 {
+		t.Errorf("expected nothing on out, got %q", out.String())
 	}
-	if entry["scope"] != "team" {
-		t.Errorf("expected scope=team, got %q", entry["scope"])
+	if got := strings.TrimSpace(errOut.String()); got != "WARNING: careful n=2" {
+		t.Errorf("unexpected warn output %q", got)
 	}
-	if entry["target"] != "backend" {
-		t.Errorf("expected target=backend, got %q", entry["target"])
+}
+
+func TestConfigureLogging_JSONFile(t *testing.T) {
+	defer withoutSource()()
+	oldLogger, oldLevel := logger, levelVar.Level()
+	defer func() {
+		logger = oldLogger
+		levelVar.Set(oldLevel)
+		slog.SetDefault(oldLogger)
+	}()
+
+	path := filepath.Join(t.TempDir(), "gomgr.log")
+	closer, err := ConfigureLogging(LogOptions{Format: LogFormatJSON, Level: "warn", File: path})
+	if err != nil {
+		t.Fatalf("ConfigureLogging: %v", err)
+	}
+	Logger().Info("dropped")
+	Logger().Warn("kept", "scope", "repo", "target", "api")
+	if err := closer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
 	}
-	if entry["action"] != "create" {
-		t.Errorf("expected action=create, got %q", entry["action"])
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected 1 record at warn level, got %d: %q", len(lines), data)
 	}
-	if entry["status"] != "ok" {
-		t.Errorf("expected status=ok, got %q", entry["status"])
+	var rec map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+		t.Fatalf("expected JSON record: %v", err)
 	}
-	if entry["ts"] == "" {
-		t.Error("expected non-empty ts field")
+	if rec["msg"] != "kept" || rec["scope"] != "repo" || rec["target"] != "api" {
+		t.Errorf("unexpected record %v", rec)
 	}
 }
 
-func TestAudit_Disabled(t *testing.T) {
-	oldVal := AuditLog
-	AuditLog = false
-	defer func() { AuditLog = oldVal }()
-
-	old := os.Stderr
-	r, w, _ := os.Pipe()
-	os.Stderr = w
-
-	Audit("team", "backend", "create", "ok")
-
-	w.Close()
-	os.Stderr = old
-
-	var buf bytes.Buffer
-	_, _ = io.Copy(&buf, r)
-	if buf.Len() != 0 {
-		t.Errorf("expected no output when audit disabled, got %q", buf.String())
+func TestConfigureLogging_Invalid(t *testing.T) {
+	if _, err := ConfigureLogging(LogOptions{Format: "xml"}); err == nil {
+		t.Error("expected error for unknown format")
+	}
+	if _, err := ConfigureLogging(LogOptions{Level: "loud"}); err == nil {
+		t.Error("expected error for unknown level")
 	}
 }
 
-func TestEnableDebug(t *testing.T) {
-	oldLevel := levelVar.Level()
-	defer levelVar.Set(oldLevel)
+// withoutSource turns off file:line suffixes (EnableDebug may have set them)
+// and returns a func restoring the previous setting.
+func withoutSource() func() {
+	old := showSource
+	showSource = false
+	return func() { showSource = old }
+}
 
-	EnableDebug()
+func TestConfigureLogging_TextFileHasTimeAndLevel(t *testing.T) {
+	defer withoutSource()()
+	oldLogger, oldLevel := logger, levelVar.Level()
+	defer func() {
+		logger = oldLogger
+		levelVar.Set(oldLevel)
+		slog.SetDefault(oldLogger)
+	}()
+
+	path := filepath.Join(t.TempDir(), "gomgr.log")
+	closer, err := ConfigureLogging(LogOptions{Format: LogFormatText, Level: "info", File: path})
+	if err != nil {
+		t.Fatalf("ConfigureLogging: %v", err)
+	}
+	Logger().Info("applied", "scope", "repo")
+	if err := closer.Close(); err != nil {
+		t.Fatal(err)
+	}
 
-	if !Logger().Enabled(context.Background(), slog.LevelDebug) {
-		t.Error("expected debug level enabled after EnableDebug")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := strings.TrimSpace(string(data))
+	for _, want := range []string{"time=", "level=INFO", "msg=applied", "scope=repo"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("expected %q in file record %q", want, line)
+		}
 	}
 }